@@ -0,0 +1,896 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	ov "github.com/shanecandoit/go_overcooker/pkg/overcooker"
+)
+
+// options are the flags shared by the commands, each command registers the ones it uses
+type options struct {
+	layout     string
+	learner    string
+	seed       int64
+	rewards    string
+	maxSteps   int
+	spawnEvery int
+	verbosity  string
+	load       string
+	greedy     bool
+	roster     ov.RosterSchedule
+	obsWidth   int // observation grid, 0 uses each layout's size
+	obsHeight  int
+
+	log   *ov.Logger
+	logTo io.Writer // where the log goes, stdout when nil
+	base  ov.Environment
+}
+
+func (o *options) addEnvFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.layout, "layout", "", "layout file drawn like Render output, empty for the built-in kitchen")
+	fs.Int64Var(&o.seed, "seed", 1, "random seed, the same seed replays the same run")
+	fs.StringVar(&o.rewards, "rewards", "", "JSON reward config, missing values keep their defaults")
+	fs.IntVar(&o.maxSteps, "max-steps", 200, "steps per episode")
+	fs.StringVar(&o.verbosity, "v", "info", "output verbosity: quiet, error, info or debug")
+	fs.Func("obs-grid", "pad observations to a WxH grid like 12x8, so one network fits layouts of different sizes", func(s string) error {
+		if _, err := fmt.Sscanf(s, "%dx%d", &o.obsWidth, &o.obsHeight); err != nil || o.obsWidth < 1 || o.obsHeight < 1 {
+			return fmt.Errorf("want a grid like 12x8, got %q", s)
+		}
+		return nil
+	})
+}
+
+// addRosterFlag lets agents join and leave during every episode
+func (o *options) addRosterFlag(fs *flag.FlagSet) {
+	fs.Func("roster", "agents joining and leaving, like 10:+a6:2:3,40:-a2: a6 joins at (2,3) after 10 steps, a2 leaves after 40", func(s string) error {
+		roster, err := ov.ParseRoster(s)
+		o.roster = roster
+		return err
+	})
+}
+
+func (o *options) addPolicyFlags(fs *flag.FlagSet, policies string) {
+	fs.StringVar(&o.learner, "learner", "policymap", policies)
+	fs.StringVar(&o.load, "load", "", "checkpoint to load (policymap and dqn learners)")
+}
+
+// setup parses the flags and loads the layout, rewards and logger
+func (o *options) setup(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected arguments %v", fs.Args())
+	}
+
+	level, err := parseLevel(o.verbosity)
+	if err != nil {
+		return err
+	}
+	out := io.Writer(os.Stdout)
+	if o.logTo != nil {
+		out = o.logTo
+	}
+	o.log = ov.NewLogger(out, level)
+
+	o.base, err = o.loadLayout(o.layout)
+	return err
+}
+
+// loadLayout loads a layout file, the built-in kitchen for "", with the -rewards and logger applied
+func (o *options) loadLayout(path string) (ov.Environment, error) {
+	env := ov.SimpleEnvironment()
+	if path != "" {
+		var err error
+		if env, err = ov.LoadLayout(path); err != nil {
+			return env, err
+		}
+	}
+	if o.rewards != "" {
+		rewards, err := ov.LoadRewardConfig(o.rewards)
+		if err != nil {
+			return env, err
+		}
+		env.Rewards = &rewards
+	}
+	env.Log = o.log
+	env.ObsWidth, env.ObsHeight = o.obsWidth, o.obsHeight
+	return env, nil
+}
+
+func parseLevel(name string) (ov.LogLevel, error) {
+	switch name {
+	case "quiet":
+		return ov.LogQuiet, nil
+	case "error":
+		return ov.LogError, nil
+	case "info":
+		return ov.LogInfo, nil
+	case "debug":
+		return ov.LogDebug, nil
+	}
+	return ov.LogQuiet, fmt.Errorf("unknown verbosity %q, want quiet, error, info or debug", name)
+}
+
+// newEnv builds a fresh copy of the layout whose spawns are driven by seed
+func (o *options) newEnv(seed int64) ov.Environment {
+	env := o.base.Clone()
+	env.Rand = rand.New(rand.NewSource(seed))
+	return env
+}
+
+// episodeSeed is the environment seed of the k-th episode of a run, so replay can rebuild any one of them
+func (o *options) episodeSeed(k int) int64 {
+	seed, _ := ov.EpisodeSeeds(o.seed, k)
+	return seed
+}
+
+var learnerKinds = strings.Join(ov.LearnerKinds, ", ")
+
+// newLearner creates a learner of the -learner kind with default settings, restoring -load when set
+func (o *options) newLearner() (ov.Learner, error) {
+	return ov.LoadLearner(o.learner, o.load, o.base, o.seed)
+}
+
+// policy builds per-episode controllers, they only draw from the source they're given
+// so every episode can be replayed from its seed
+type policy func(r *rand.Rand) ov.Controller
+
+// newPolicy returns the controller factory for -learner on the -layout,
+// which also accepts random, scripted and human here
+func (o *options) newPolicy() (policy, error) {
+	if o.learner == "human" {
+		c := &humanController{in: bufio.NewScanner(os.Stdin)}
+		return func(r *rand.Rand) ov.Controller { return c }, nil
+	}
+	controllers, err := o.controllers()
+	if err != nil {
+		return nil, err
+	}
+	// check the policy can be played once, so the factory can't fail
+	if _, err := controllers(o.base, o.greedy, nil); err != nil {
+		return nil, err
+	}
+	return func(r *rand.Rand) ov.Controller {
+		c, _ := controllers(o.base, o.greedy, r)
+		return c
+	}, nil
+}
+
+// controllers returns the controllers of -learner for any layout, random and scripted included
+func (o *options) controllers() (ov.ControllerFactory, error) {
+	return ov.PolicyControllers(o.learner, o.load, o.base, o.seed)
+}
+
+// humanController reads one line of actions per step from stdin, a letter per agent:
+// N S E W move, I interacts, anything else waits, end of input stops the episode
+type humanController struct {
+	in *bufio.Scanner
+}
+
+func (c *humanController) Actions(env *ov.Environment) []int {
+	fmt.Printf("actions for %d agents (N S E W I _)> ", len(env.Agents))
+	if !c.in.Scan() {
+		return nil
+	}
+	letters := strings.ToUpper(strings.Join(strings.Fields(c.in.Text()), ""))
+	actions := make([]int, len(env.Agents))
+	for i := range actions {
+		if i >= len(letters) {
+			break
+		}
+		switch letters[i] {
+		case 'N':
+			actions[i] = ov.Act_North
+		case 'S':
+			actions[i] = ov.Act_South
+		case 'E':
+			actions[i] = ov.Act_East
+		case 'W':
+			actions[i] = ov.Act_West
+		case 'I':
+			actions[i] = ov.Act_Interact
+		}
+	}
+	return actions
+}
+
+// stepInfo is what playEpisode reports after every step
+type stepInfo struct {
+	step    int
+	actions []int
+	rewards []float32
+	done    bool
+}
+
+// playEpisode drives the k-th episode of a run with a controller built for it
+// and returns the total reward, onStep is called after each step when set
+func (o *options) playEpisode(p policy, k int, onStep func(env *ov.Environment, info stepInfo)) float64 {
+	envSeed, controllerSeed := ov.EpisodeSeeds(o.seed, k)
+	env := o.newEnv(envSeed)
+	ctrl := p(rand.New(rand.NewSource(controllerSeed)))
+	if onStep != nil {
+		onStep(&env, stepInfo{})
+	}
+	for step := 1; step <= o.maxSteps; step++ {
+		if err := o.roster.Apply(&env, step-1); err != nil {
+			o.log.Errorf("roster: %v", err)
+			break
+		}
+		actions := ctrl.Actions(&env)
+		if actions == nil {
+			break
+		}
+		rewards, done := env.Step(actions)
+		if o.spawnEvery > 0 && step%o.spawnEvery == 0 {
+			env.EnvironmentSpawnRandomItemsForTraining()
+		}
+		if onStep != nil {
+			onStep(&env, stepInfo{step: step, actions: actions, rewards: rewards, done: done})
+		}
+		if done {
+			break
+		}
+	}
+	return env.TotalReward
+}
+
+// renderStep prints a step header and the grid at LogInfo
+func (o *options) renderStep(env *ov.Environment, info stepInfo) {
+	if !o.log.Enabled(ov.LogInfo) {
+		return
+	}
+	if info.step == 0 {
+		o.log.Infof("step 0, total %.2f", env.TotalReward)
+	} else {
+		o.log.Infof("step %d, actions %v, rewards %v, total %.2f", info.step, info.actions, info.rewards, env.TotalReward)
+	}
+	env.RenderTo(o.log.Writer(ov.LogInfo))
+	o.log.Debugf("events: %v", env.EventCountsmap)
+}
+
+func cmdTrain(args []string) error {
+	var o options
+	var episodes, steps, report int
+	var save string
+	fs := flag.NewFlagSet("train", flag.ContinueOnError)
+	o.addEnvFlags(fs)
+	fs.StringVar(&o.learner, "learner", "policymap", "learner: "+learnerKinds)
+	fs.StringVar(&o.load, "load", "", "checkpoint to continue from (policymap and dqn learners)")
+	fs.StringVar(&save, "save", "", "checkpoint to write when training ends (policymap and dqn learners)")
+	fs.IntVar(&episodes, "episodes", 100, "episodes to train, ignored when -steps is set")
+	fs.IntVar(&steps, "steps", 0, "environment steps to train instead of a number of episodes")
+	fs.IntVar(&report, "report", 10, "episodes between progress lines")
+	var metricsPath, dashboard string
+	fs.StringVar(&metricsPath, "metrics", "", "write per-episode metrics to this file, CSV for .csv and JSON lines otherwise")
+	fs.StringVar(&dashboard, "dashboard", "", "serve live charts of the training on this address, like localhost:8080")
+	o.addRosterFlag(fs)
+	record, minDeliveries := addRecordFlags(fs)
+	if err := o.setup(fs, args); err != nil {
+		return err
+	}
+	if err := o.roster.Check(o.base); err != nil {
+		return fmt.Errorf("roster: %w", err)
+	}
+	recorder, err := newEpisodeRecorder(*record, *minDeliveries, o.log)
+	if err != nil {
+		return err
+	}
+
+	learner, err := o.newLearner()
+	if err != nil {
+		return err
+	}
+	var checkpointer ov.Checkpointer
+	if save != "" {
+		var ok bool
+		if checkpointer, ok = learner.(ov.Checkpointer); !ok {
+			return fmt.Errorf("the %s learner has no checkpoints", o.learner)
+		}
+	}
+
+	k := 0
+	var seed int64
+	trainer := ov.NewTrainer(func() ov.Environment {
+		k++
+		seed = o.episodeSeed(k)
+		return o.newEnv(seed)
+	}, learner)
+	trainer.MaxEpisodeSteps = o.maxSteps
+	trainer.Roster = o.roster
+	if recorder != nil {
+		trainer.OnEpisodeStart = func(env *ov.Environment) { recorder.start(env, seed) }
+		trainer.OnStep = recorder.step
+	}
+
+	metrics := ov.NewMetricsRecorder(learner)
+	if metricsPath != "" {
+		w, err := ov.CreateMetricsFile(metricsPath)
+		if err != nil {
+			return err
+		}
+		metrics.Writers = append(metrics.Writers, w)
+	}
+	defer metrics.Close()
+	metrics.Attach(trainer)
+	if dashboard != "" {
+		if err := serveDashboard(dashboard, "training "+o.learner, metrics.Source(o.learner), o.log); err != nil {
+			return err
+		}
+	}
+
+	start := time.Now()
+	for {
+		if steps > 0 && trainer.TotalSteps >= steps || steps <= 0 && trainer.Episode >= episodes {
+			break
+		}
+		_, done := trainer.Step()
+		if done && recorder != nil {
+			if err := recorder.finish(trainer.Episode); err != nil {
+				return err
+			}
+		}
+		if done && report > 0 && trainer.Episode%report == 0 {
+			recent := trainer.Returns[max(0, len(trainer.Returns)-report):]
+			o.log.Infof("episode %d, steps %d, return %.2f, mean of last %d %.2f",
+				trainer.Episode, trainer.TotalSteps, recent[len(recent)-1], len(recent), mean(recent))
+		}
+	}
+	o.log.Infof("trained %d episodes, %d steps in %s, mean return %.2f",
+		trainer.Episode, trainer.TotalSteps, time.Since(start).Round(time.Millisecond), mean(trainer.Returns))
+	if err := metrics.Close(); err != nil {
+		return err
+	}
+
+	if checkpointer != nil {
+		if err := checkpointer.SaveCheckpoint(save); err != nil {
+			return err
+		}
+		o.log.Infof("saved %s", save)
+	}
+	return nil
+}
+
+// evalFlags shape an evaluation, eval and mappo share them
+type evalFlags struct {
+	episodes, bootstrap  int
+	seeds, layouts, mode string
+	confidence           float64
+	report               string
+}
+
+func (f *evalFlags) add(fs *flag.FlagSet, o *options) {
+	fs.StringVar(&f.mode, "mode", "greedy", "greedy takes each policy's most probable action, stochastic samples it, both runs both")
+	fs.IntVar(&o.spawnEvery, "spawn-every", 0, "spawn random items every this many steps, 0 never")
+	fs.IntVar(&f.episodes, "episodes", 20, "episodes to play per layout and seed")
+	fs.StringVar(&f.seeds, "seeds", "", "comma-separated seeds to play episodes from, replaces -seed")
+	fs.StringVar(&f.layouts, "layouts", "", "comma-separated layout files to play on, replaces -layout")
+	fs.IntVar(&f.bootstrap, "bootstrap", 1000, "bootstrap resamples for the confidence intervals, 0 skips them")
+	fs.Float64Var(&f.confidence, "confidence", 0.95, "coverage of the confidence intervals")
+	fs.StringVar(&f.report, "report", "", "write the full report, every episode included, to this JSON file")
+	o.addRosterFlag(fs)
+}
+
+// config returns the evaluation the flags ask for and the layouts to play it on, call it after setup
+func (f *evalFlags) config(o *options) (ov.EvalConfig, []ov.Environment, error) {
+	config := ov.EvalConfig{
+		Episodes:   f.episodes,
+		Seeds:      []int64{o.seed},
+		MaxSteps:   o.maxSteps,
+		SpawnEvery: o.spawnEvery,
+		Modes:      []string{f.mode},
+		Bootstrap:  f.bootstrap,
+		Confidence: f.confidence,
+		Roster:     o.roster,
+	}
+	if f.mode == "both" {
+		config.Modes = ov.EvalModes
+	}
+	if f.seeds != "" {
+		config.Seeds = nil
+		for _, field := range strings.Split(f.seeds, ",") {
+			seed, err := strconv.ParseInt(strings.TrimSpace(field), 10, 64)
+			if err != nil {
+				return config, nil, fmt.Errorf("bad seed %q in -seeds", field)
+			}
+			config.Seeds = append(config.Seeds, seed)
+		}
+	}
+	envs := []ov.Environment{o.base}
+	if f.layouts != "" {
+		envs = nil
+		for _, path := range strings.Split(f.layouts, ",") {
+			env, err := o.loadLayout(strings.TrimSpace(path))
+			if err != nil {
+				return config, nil, err
+			}
+			envs = append(envs, env)
+		}
+	}
+	return config, envs, nil
+}
+
+// finish prints the report and writes it to -report when set
+func (f *evalFlags) finish(o *options, result *ov.EvalReport) error {
+	printEvalReport(result)
+	if f.report == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(f.report, append(data, '\n'), 0o644); err != nil {
+		return err
+	}
+	o.log.Infof("wrote %s", f.report)
+	return nil
+}
+
+func cmdEval(args []string) error {
+	var o options
+	var ef evalFlags
+	fs := flag.NewFlagSet("eval", flag.ContinueOnError)
+	o.addEnvFlags(fs)
+	o.addPolicyFlags(fs, "policy: "+learnerKinds+", random or scripted")
+	ef.add(fs, &o)
+	record, minDeliveries := addRecordFlags(fs)
+	if err := o.setup(fs, args); err != nil {
+		return err
+	}
+	if o.learner == "human" {
+		return fmt.Errorf("use play to control agents yourself")
+	}
+
+	config, envs, err := ef.config(&o)
+	if err != nil {
+		return err
+	}
+	controllers, err := o.controllers()
+	if err != nil {
+		return err
+	}
+	recorder, err := newEpisodeRecorder(*record, *minDeliveries, o.log)
+	if err != nil {
+		return err
+	}
+
+	e := ov.Evaluator{Config: config, Layouts: envs, Controllers: controllers, Policy: o.learner}
+	if o.load != "" {
+		e.Policy += " " + o.load
+	}
+	index := 0
+	e.OnEpisodeStart = func(env *ov.Environment, ep ov.EvalEpisode) {
+		index = ep.Index
+		seed, _ := ov.EpisodeSeeds(ep.Seed, ep.Episode)
+		o.log.Debugf("%s episode %d on %s (seed %d)", ep.Mode, ep.Episode, ep.Layout, seed)
+		if recorder != nil {
+			recorder.start(env, seed)
+		}
+	}
+	var recordErr error
+	e.OnStep = func(env *ov.Environment, actions []int, rewards []float32, done bool) {
+		if recorder == nil {
+			return
+		}
+		recorder.step(env, actions, rewards, done)
+		if done && recordErr == nil {
+			recordErr = recorder.finish(index)
+		}
+	}
+	result, err := e.Run()
+	if err != nil {
+		return err
+	}
+	if recordErr != nil {
+		return recordErr
+	}
+	return ef.finish(&o, result)
+}
+
+// cmdMAPPO trains multi-agent PPO, which collects its own rollouts instead of learning in the Trainer,
+// then evaluates the trained actors like eval does
+func cmdMAPPO(args []string) error {
+	var o options
+	var ef evalFlags
+	var iterations, report int
+	config := ov.DefaultPPOConfig()
+	fs := flag.NewFlagSet("mappo", flag.ContinueOnError)
+	o.addEnvFlags(fs)
+	fs.IntVar(&iterations, "iterations", 50, "rollout and update iterations to train")
+	fs.IntVar(&config.NumEnvs, "envs", config.NumEnvs, "environments collecting rollouts in parallel")
+	fs.IntVar(&config.RolloutSteps, "rollout-steps", config.RolloutSteps, "steps per environment per iteration")
+	fs.BoolVar(&config.ShareActor, "share-actor", config.ShareActor, "train one actor for all agents, otherwise one per agent")
+	fs.IntVar(&report, "report-every", 5, "iterations between progress lines")
+	ef.add(fs, &o)
+	if err := o.setup(fs, args); err != nil {
+		return err
+	}
+	evalConfig, envs, err := ef.config(&o)
+	if err != nil {
+		return err
+	}
+	config.MaxEpisodeSteps = o.maxSteps
+	config.Seed = o.seed
+
+	// rollout workers reset their environments concurrently
+	var episodes atomic.Int64
+	mappo := ov.NewMAPPO(func() ov.Environment {
+		return o.newEnv(o.episodeSeed(int(episodes.Add(1))))
+	}, config)
+	start := time.Now()
+	for i := 1; i <= iterations; i++ {
+		stats := mappo.Iterate()
+		if report > 0 && i%report == 0 {
+			o.log.Infof("iteration %d, %d episodes, mean return %.2f, policy loss %.3f, value loss %.3f, entropy %.3f",
+				i, stats.Episodes, stats.MeanReturn, stats.PolicyLoss, stats.ValueLoss, stats.Entropy)
+		}
+	}
+	o.log.Infof("trained %d iterations in %s", iterations, time.Since(start).Round(time.Millisecond))
+
+	e := ov.Evaluator{Config: evalConfig, Layouts: envs, Controllers: mappo.Controllers(), Policy: "mappo"}
+	result, err := e.Run()
+	if err != nil {
+		return err
+	}
+	return ef.finish(&o, result)
+}
+
+// printEvalReport prints each mode's estimates, then the layouts and seeds when there are several
+func printEvalReport(report *ov.EvalReport) {
+	ci := int(math.Round(report.Config.Confidence * 100))
+	for _, result := range report.Results {
+		overall := result.Overall
+		fmt.Printf("%s: %d episodes, mean ± stderr [%d%% interval]\n", result.Mode, overall.Episodes, ci)
+		fmt.Printf("  %-16s %v\n", "return", overall.Return)
+		fmt.Printf("  %-16s %v\n", "deliveries", overall.Deliveries)
+		fmt.Printf("  %-16s %v\n", "invalid rate", overall.InvalidRate)
+		events := make([]string, 0, len(overall.Events))
+		for event := range overall.Events {
+			events = append(events, event)
+		}
+		sort.Strings(events)
+		for _, event := range events {
+			fmt.Printf("  %-16s %v\n", event, overall.Events[event])
+		}
+		if len(result.ByLayout) > 1 {
+			for _, s := range result.ByLayout {
+				fmt.Printf("  layout %-9s return %v, deliveries %.3f\n", s.Name, s.Return, s.Deliveries.Mean)
+			}
+		}
+		if len(result.BySeed) > 1 {
+			for _, s := range result.BySeed {
+				fmt.Printf("  seed %-11s return %v, deliveries %.3f\n", s.Name, s.Return, s.Deliveries.Mean)
+			}
+		}
+	}
+}
+
+func cmdPlay(args []string) error {
+	var o options
+	var delay time.Duration
+	fs := flag.NewFlagSet("play", flag.ContinueOnError)
+	o.addEnvFlags(fs)
+	o.addPolicyFlags(fs, "policy: "+learnerKinds+", random, scripted or human")
+	fs.BoolVar(&o.greedy, "greedy", false, "take each policy's most probable action instead of sampling")
+	fs.IntVar(&o.spawnEvery, "spawn-every", 0, "spawn random items every this many steps, 0 never")
+	fs.DurationVar(&delay, "delay", 200*time.Millisecond, "pause between steps")
+	var record string
+	fs.StringVar(&record, "record", "", "write the episode's trajectory to this file")
+	o.addRosterFlag(fs)
+	if err := o.setup(fs, args); err != nil {
+		return err
+	}
+	if err := o.roster.Check(o.base); err != nil {
+		return fmt.Errorf("roster: %w", err)
+	}
+	if o.learner == "human" {
+		delay = 0
+	}
+	p, err := o.newPolicy()
+	if err != nil {
+		return err
+	}
+
+	var trajectory *ov.Trajectory
+	total := o.playEpisode(p, 0, func(env *ov.Environment, info stepInfo) {
+		o.renderStep(env, info)
+		if info.step == 0 {
+			trajectory = ov.NewTrajectory(env, o.episodeSeed(0))
+			return
+		}
+		trajectory.Record(env, info.actions, info.rewards, info.done)
+		time.Sleep(delay)
+	})
+	fmt.Printf("return %.2f\n", total)
+	if record != "" {
+		return trajectory.Save(record)
+	}
+	return nil
+}
+
+func cmdRender(args []string) error {
+	var o options
+	fs := flag.NewFlagSet("render", flag.ContinueOnError)
+	fs.StringVar(&o.layout, "layout", "", "layout file, empty for the built-in kitchen")
+	o.verbosity = "info"
+	if err := o.setup(fs, args); err != nil {
+		return err
+	}
+	env := o.base
+	// the header is a comment so the output loads back with -layout,
+	// unless it says what the render lost, like agents stacked on one cell
+	fmt.Printf("# %s: %d agents, %d items, %d stations, %dx%d\n",
+		env.Name, len(env.Agents), len(env.Items), len(env.Stations), env.Width+1, env.Height+1)
+	for _, loss := range env.RenderLoss() {
+		fmt.Printf("# won't load back: %s\n", loss)
+	}
+	fmt.Print(env.RenderString())
+	return nil
+}
+
+func cmdReplay(args []string) error {
+	var o options
+	var episode, at int
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	o.addEnvFlags(fs)
+	o.addPolicyFlags(fs, "policy: "+learnerKinds+", random or scripted")
+	fs.BoolVar(&o.greedy, "greedy", true, "must match the run being replayed")
+	fs.IntVar(&o.spawnEvery, "spawn-every", 0, "must match the run being replayed")
+	fs.IntVar(&episode, "episode", 0, "which episode of the seeded run, as numbered by eval -v debug")
+	fs.IntVar(&at, "at", -1, "only show this step, -1 shows all of them")
+	var trajectory string
+	var delay time.Duration
+	fs.StringVar(&trajectory, "trajectory", "", "replay a recorded trajectory file instead of re-running the seed")
+	fs.DurationVar(&delay, "delay", 0, "pause between steps of a trajectory")
+	o.addRosterFlag(fs)
+	if err := o.setup(fs, args); err != nil {
+		return err
+	}
+	if trajectory != "" {
+		return replayTrajectory(&o, trajectory, at, delay)
+	}
+	if err := o.roster.Check(o.base); err != nil {
+		return fmt.Errorf("roster: %w", err)
+	}
+	if o.learner == "human" {
+		return fmt.Errorf("human episodes can't be replayed")
+	}
+	p, err := o.newPolicy()
+	if err != nil {
+		return err
+	}
+
+	o.log.Infof("replaying episode %d, seed %d", episode, o.episodeSeed(episode))
+	total := o.playEpisode(p, episode, func(env *ov.Environment, info stepInfo) {
+		if at < 0 || info.step == at {
+			o.renderStep(env, info)
+		}
+	})
+	fmt.Printf("return %.2f\n", total)
+	return nil
+}
+
+// replayTrajectory shows a recorded episode frame by frame
+func replayTrajectory(o *options, path string, at int, delay time.Duration) error {
+	t, err := ov.LoadTrajectory(path)
+	if err != nil {
+		return err
+	}
+	r := ov.NewTrajectoryReplayer(t)
+	o.log.Infof("replaying %s: %s, seed %d, %d steps, events %v", path, t.Header.Name, t.Header.Seed, r.Len(), t.Events())
+	for {
+		info := stepInfo{}
+		if frame := r.Current(); frame != nil {
+			info = stepInfo{step: frame.Step, actions: frame.Actions, rewards: frame.Rewards, done: frame.Done}
+		}
+		if at < 0 || info.step == at {
+			o.renderStep(&r.Env, info)
+			if info.step > 0 {
+				time.Sleep(delay)
+			}
+		}
+		if !r.Next() {
+			break
+		}
+	}
+	fmt.Printf("return %.2f\n", r.Env.TotalReward)
+	return nil
+}
+
+func cmdExperiment(args []string) error {
+	var verbosity, out string
+	var workers int
+	var dryRun bool
+	fs := flag.NewFlagSet("experiment", flag.ContinueOnError)
+	fs.StringVar(&out, "out", "runs", "directory the runs are written to, one subdirectory per experiment")
+	fs.IntVar(&workers, "workers", runtime.NumCPU(), "runs trained at the same time")
+	fs.BoolVar(&dryRun, "dry-run", false, "list the expanded runs without training")
+	fs.StringVar(&verbosity, "v", "info", "output verbosity: quiet, error, info or debug")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: overcooker experiment [flags] experiment.json...")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return fmt.Errorf("no experiment files")
+	}
+	level, err := parseLevel(verbosity)
+	if err != nil {
+		return err
+	}
+	log := ov.NewLogger(os.Stdout, level)
+
+	failed := 0
+	for _, path := range fs.Args() {
+		runs, err := ov.LoadExperiment(path)
+		if err != nil {
+			return err
+		}
+		dir := filepath.Join(out, runs[0].Config.Name)
+		log.Infof("%s: %d runs into %s", path, len(runs), dir)
+		if dryRun {
+			for _, run := range runs {
+				log.Infof("%s %v", run.Name, run.Params)
+			}
+			continue
+		}
+
+		results, err := ov.RunSweep(runs, dir, workers, log)
+		if err != nil {
+			return err
+		}
+		best := -1
+		for i, r := range results {
+			if r.Err != nil {
+				failed++
+			} else if best < 0 || r.FinalEval > results[best].FinalEval {
+				best = i
+			}
+		}
+		if best >= 0 {
+			log.Infof("best: %s %v, final eval %.2f", results[best].Run.Name, results[best].Run.Params, results[best].FinalEval)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d runs failed", failed)
+	}
+	return nil
+}
+
+// addRecordFlags registers the flags that keep trajectories of interesting episodes
+func addRecordFlags(fs *flag.FlagSet) (dir *string, minDeliveries *int) {
+	dir = fs.String("record", "", "directory to write trajectories of episodes that delivered soup")
+	minDeliveries = fs.Int("record-min-deliveries", 1, "deliveries an episode needs to be recorded, 0 records every episode")
+	return dir, minDeliveries
+}
+
+func cmdGym(args []string) error {
+	var o options
+	fs := flag.NewFlagSet("gym", flag.ContinueOnError)
+	o.addEnvFlags(fs)
+	fs.IntVar(&o.spawnEvery, "spawn-every", 0, "spawn random items every this many steps, 0 never")
+	o.verbosity = "error"
+	o.logTo = os.Stderr // stdout carries the protocol
+	if err := o.setup(fs, args); err != nil {
+		return err
+	}
+	o.log.Infof("serving %s on stdin and stdout, protocol %s version %d", o.base.Name, ov.GymProtocol, ov.GymProtocolVersion)
+	return ov.NewGymEnv(o.base, o.maxSteps, o.spawnEvery, o.seed).Serve(os.Stdin, os.Stdout)
+}
+
+func cmdServe(args []string) error {
+	var addr, layouts, origins, verbosity string
+	var config ov.ServerConfig
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	fs.StringVar(&addr, "addr", "localhost:8080", "address to serve on, keep it on localhost unless you mean to share")
+	fs.StringVar(&layouts, "layouts", "", "directory of layout files sessions can ask for by name")
+	fs.IntVar(&config.MaxSteps, "max-steps", 200, "steps per episode of sessions that don't ask for a length")
+	fs.IntVar(&config.SpawnEvery, "spawn-every", 0, "spawn random items every this many steps, for sessions that don't say")
+	fs.DurationVar(&config.IdleTimeout, "idle", 10*time.Minute, "close sessions without clients unused this long, 0 never")
+	fs.IntVar(&config.MaxSessions, "max-sessions", 64, "most sessions at once, 0 for no limit")
+	fs.StringVar(&origins, "allow-origin", "", "comma-separated browser origins that may open WebSockets besides this server, * for any")
+	fs.Int64Var(&config.Seed, "seed", 1, "seeds the seeds of sessions created without one")
+	fs.StringVar(&verbosity, "v", "info", "output verbosity: quiet, error, info or debug")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected arguments %v", fs.Args())
+	}
+	level, err := parseLevel(verbosity)
+	if err != nil {
+		return err
+	}
+	config.Log = ov.NewLogger(os.Stdout, level)
+	config.LayoutDir = layouts
+	if origins != "" {
+		config.AllowOrigins = strings.Split(origins, ",")
+	}
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	server := ov.NewServer(config)
+	defer server.Close()
+	config.Log.Infof("serving sessions on http://%s/", ln.Addr())
+	return http.Serve(ln, server)
+}
+
+func cmdDashboard(args []string) error {
+	var addr string
+	fs := flag.NewFlagSet("dashboard", flag.ContinueOnError)
+	fs.StringVar(&addr, "addr", "localhost:8080", "address to serve the dashboard on")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: overcooker dashboard [flags] metrics-file-or-run-dir...")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return fmt.Errorf("no metrics files, pass the -metrics file of train or an experiment run directory")
+	}
+	var paths []string
+	for _, path := range fs.Args() {
+		// an experiment run directory keeps its training metrics in train.csv
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			path = filepath.Join(path, "train.csv")
+		}
+		paths = append(paths, path)
+	}
+
+	log := ov.NewLogger(os.Stdout, ov.LogInfo)
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	log.Infof("dashboard on http://%s/, following %s", ln.Addr(), strings.Join(paths, ", "))
+	return http.Serve(ln, ov.NewDashboard("overcooker", ov.MetricsFiles(paths...)))
+}
+
+// serveDashboard serves live charts in the background for as long as the command runs
+func serveDashboard(addr, title string, source ov.MetricsSource, log *ov.Logger) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	log.Infof("dashboard on http://%s/", ln.Addr())
+	go func() {
+		if err := http.Serve(ln, ov.NewDashboard(title, source)); err != nil {
+			log.Errorf("dashboard: %v", err)
+		}
+	}()
+	return nil
+}
+
+func mean(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	total := 0.0
+	for _, v := range values {
+		total += v
+	}
+	return total / float64(len(values))
+}
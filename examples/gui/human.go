@@ -0,0 +1,277 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	ov "github.com/shanecandoit/go_overcooker/pkg/overcooker"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+)
+
+// KeyBindings are the keys of one player, any key of a list does it
+type KeyBindings struct {
+	North, South, East, West []ebiten.Key
+	Interact                 []ebiten.Key
+	Wait                     []ebiten.Key // chooses to stand still, turn-based play needs it
+}
+
+// KeyLayouts are the layouts players pick from, several players need different ones
+var KeyLayouts = map[string]KeyBindings{
+	"wasd": {
+		North: []ebiten.Key{ebiten.KeyW}, South: []ebiten.Key{ebiten.KeyS},
+		East: []ebiten.Key{ebiten.KeyD}, West: []ebiten.Key{ebiten.KeyA},
+		Interact: []ebiten.Key{ebiten.KeySpace}, Wait: []ebiten.Key{ebiten.KeyQ},
+	},
+	"arrows": {
+		North: []ebiten.Key{ebiten.KeyArrowUp}, South: []ebiten.Key{ebiten.KeyArrowDown},
+		East: []ebiten.Key{ebiten.KeyArrowRight}, West: []ebiten.Key{ebiten.KeyArrowLeft},
+		Interact: []ebiten.Key{ebiten.KeyEnter}, Wait: []ebiten.Key{ebiten.KeyShiftRight},
+	},
+	"numpad": {
+		North: []ebiten.Key{ebiten.KeyNumpad8}, South: []ebiten.Key{ebiten.KeyNumpad2},
+		East: []ebiten.Key{ebiten.KeyNumpad6}, West: []ebiten.Key{ebiten.KeyNumpad4},
+		Interact: []ebiten.Key{ebiten.KeyNumpad0}, Wait: []ebiten.Key{ebiten.KeyNumpad5},
+	},
+	// a single player can use either hand
+	"keyboard": {
+		North: []ebiten.Key{ebiten.KeyW, ebiten.KeyArrowUp}, South: []ebiten.Key{ebiten.KeyS, ebiten.KeyArrowDown},
+		East: []ebiten.Key{ebiten.KeyD, ebiten.KeyArrowRight}, West: []ebiten.Key{ebiten.KeyA, ebiten.KeyArrowLeft},
+		Interact: []ebiten.Key{ebiten.KeySpace, ebiten.KeyEnter}, Wait: []ebiten.Key{ebiten.KeyQ, ebiten.KeyShiftRight},
+	},
+}
+
+// defaultLayouts go to players without a layout of their own, in order
+var defaultLayouts = []string{"wasd", "arrows", "numpad"}
+
+// keyLayoutNames lists the layouts for flag help and errors
+func keyLayoutNames() string {
+	names := make([]string, 0, len(KeyLayouts))
+	for name := range KeyLayouts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// actionKeys is an action and the keys that choose it
+type actionKeys struct {
+	action int
+	keys   []ebiten.Key
+}
+
+func (b KeyBindings) actions() []actionKeys {
+	return []actionKeys{
+		{ov.Act_North, b.North}, {ov.Act_South, b.South}, {ov.Act_East, b.East}, {ov.Act_West, b.West},
+		{ov.Act_Interact, b.Interact}, {ov.Act_None, b.Wait},
+	}
+}
+
+// Player is a human controlling one agent, named because indexes shift as agents come and go
+type Player struct {
+	Agent  string
+	Layout string
+	Keys   KeyBindings
+
+	chosen bool // pressed a key since the last step
+	action int
+}
+
+// ParsePlayers reads players like "a1:wasd,a2:arrows", a lone player without a layout gets "keyboard"
+func ParsePlayers(s string) ([]*Player, error) {
+	var players []*Player
+	seen := map[string]bool{}
+	fields := strings.Split(s, ",")
+	for i, field := range fields {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		agent, layout, _ := strings.Cut(field, ":")
+		if seen[agent] {
+			return nil, fmt.Errorf("agent %s has two players", agent)
+		}
+		seen[agent] = true
+		if layout == "" {
+			switch {
+			case len(fields) == 1:
+				layout = "keyboard"
+			case i < len(defaultLayouts):
+				layout = defaultLayouts[i]
+			default:
+				return nil, fmt.Errorf("player %s needs a key layout, one of %s", agent, keyLayoutNames())
+			}
+		}
+		keys, ok := KeyLayouts[layout]
+		if !ok {
+			return nil, fmt.Errorf("unknown key layout %q for %s, want one of %s", layout, agent, keyLayoutNames())
+		}
+		players = append(players, &Player{Agent: agent, Layout: layout, Keys: keys})
+	}
+	return players, nil
+}
+
+// readKeys latches the action of a key pressed this tick, the last one pressed wins
+func (p *Player) readKeys() {
+	for _, a := range p.Keys.actions() {
+		for _, key := range a.keys {
+			if inpututil.IsKeyJustPressed(key) {
+				p.chosen, p.action = true, a.action
+			}
+		}
+	}
+}
+
+// held returns the action of a key held down, so moving on a tick doesn't need a press per cell
+func (p *Player) held() int {
+	for _, a := range p.Keys.actions() {
+		for _, key := range a.keys {
+			if ebiten.IsKeyPressed(key) {
+				return a.action
+			}
+		}
+	}
+	return ov.Act_None
+}
+
+// HumanPlay has people play agents of the kitchen while the policy plays the rest
+type HumanPlay struct {
+	NewEnv     func(seed int64) ov.Environment
+	NewPolicy  func(env ov.Environment, r *rand.Rand) (ov.Controller, error)
+	Players    []*Player
+	Tick       time.Duration // the kitchen steps every Tick, 0 waits until every player chose (turn-based)
+	MaxSteps   int
+	SpawnEvery int // spawn random items every this many steps, 0 never
+	Seed       int64
+	Record     string // directory to save each episode's trajectory in, empty saves nothing
+
+	Env        ov.Environment
+	Steps      int
+	Episode    int
+	policy     ov.Controller
+	trajectory *ov.Trajectory
+	lastStep   time.Time
+}
+
+// Reset starts episode k, seeded like the command line seeds its episodes
+func (h *HumanPlay) Reset(k int) error {
+	seed, controllerSeed := ov.EpisodeSeeds(h.Seed, k)
+	h.Env = h.NewEnv(seed)
+	for _, p := range h.Players {
+		if !h.has(p.Agent) {
+			return fmt.Errorf("no agent %s in %s", p.Agent, h.Env.Name)
+		}
+		p.chosen = false
+	}
+	policy, err := h.NewPolicy(h.Env, rand.New(rand.NewSource(controllerSeed)))
+	if err != nil {
+		return err
+	}
+	h.policy = policy
+	h.Episode, h.Steps = k, 0
+	h.trajectory = ov.NewTrajectory(&h.Env, seed)
+	h.lastStep = time.Now()
+	return nil
+}
+
+func (h *HumanPlay) has(agent string) bool {
+	for _, a := range h.Env.Agents {
+		if a.Name == agent {
+			return true
+		}
+	}
+	return false
+}
+
+// Over reports whether the episode reached MaxSteps
+func (h *HumanPlay) Over() bool {
+	return h.MaxSteps > 0 && h.Steps >= h.MaxSteps
+}
+
+// Waiting returns the players the kitchen waits for, only turn-based play waits
+func (h *HumanPlay) Waiting() []string {
+	var waiting []string
+	if h.Tick > 0 {
+		return nil
+	}
+	for _, p := range h.Players {
+		if !p.chosen {
+			waiting = append(waiting, p.Agent)
+		}
+	}
+	return waiting
+}
+
+// Update reads the keys and steps the kitchen when it's time, R restarts the episode
+func (h *HumanPlay) Update() error {
+	if inpututil.IsKeyJustPressed(ebiten.KeyR) {
+		return h.Reset(h.Episode + 1)
+	}
+	if h.Over() {
+		return nil
+	}
+	for _, p := range h.Players {
+		p.readKeys()
+	}
+	if h.Tick > 0 {
+		if time.Since(h.lastStep) < h.Tick {
+			return nil
+		}
+	} else if len(h.Waiting()) > 0 {
+		return nil
+	}
+	return h.step()
+}
+
+// step plays the players' choices and the policy's actions for everyone else
+func (h *HumanPlay) step() error {
+	actions := h.policy.Actions(&h.Env)
+	for _, p := range h.Players {
+		action := p.action
+		if !p.chosen {
+			action = p.held()
+		}
+		for i, agent := range h.Env.Agents {
+			if agent.Name == p.Agent {
+				actions[i] = action
+			}
+		}
+		p.chosen = false
+	}
+	rewards, done := h.Env.Step(actions)
+	h.Steps++
+	h.lastStep = time.Now()
+	if h.SpawnEvery > 0 && h.Steps%h.SpawnEvery == 0 {
+		h.Env.EnvironmentSpawnRandomItemsForTraining()
+	}
+	done = done || h.Over()
+	h.trajectory.Record(&h.Env, actions, rewards, done)
+	if done && h.Record != "" {
+		if err := os.MkdirAll(h.Record, 0o755); err != nil {
+			return err
+		}
+		return h.trajectory.Save(filepath.Join(h.Record, fmt.Sprintf("human-%05d.jsonl", h.Episode)))
+	}
+	return nil
+}
+
+// Status is the text shown under the counters: who plays with which keys and what the kitchen waits for
+func (h *HumanPlay) Status() []string {
+	lines := []string{}
+	for _, p := range h.Players {
+		lines = append(lines, fmt.Sprintf("%s: %s", p.Agent, p.Layout))
+	}
+	switch waiting := h.Waiting(); {
+	case h.Over():
+		lines = append(lines, "episode over, R plays again")
+	case len(waiting) > 0:
+		lines = append(lines, "waiting for "+strings.Join(waiting, ", "))
+	}
+	return lines
+}
@@ -1,10 +1,12 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"image"
 	_ "image/png"
 	"log"
+	"math/rand"
 	"os"
 	"time"
 
@@ -30,79 +32,40 @@ import (
 
 // Game implements ebiten.Game interface.
 type Game struct {
-	Environment ov.Environment
-	Step        int
-	// Create policies for agents
-	PolicyMap map[ov.Position]ov.Policy
-	Images    map[string]*ebiten.Image
-	MaxSteps  int
+	// Trainer owns the environment and the policy map learner
+	Trainer *ov.Trainer
+	// Replay, when set, plays a recorded trajectory instead of training
+	Replay *ov.TrajectoryReplayer
+	// Human, when set, lets people play agents alongside the policy instead of training
+	Human    *HumanPlay
+	Step     int
+	Images   map[string]*ebiten.Image
+	MaxSteps int
 }
 
 // Update proceeds the game state.
 // Update is called every tick (1/60 [s] by default).
 func (g *Game) Update() error {
-
-	// env := g.Environment
-
-	// Gather actions for each agent based on their policies
-	actions_list := make([]int, len(g.Environment.Agents))
-	prevPos := make([]ov.Position, len(g.Environment.Agents))
-	for i, agent := range g.Environment.Agents {
-		pos := ov.Position{X: agent.X, Y: agent.Y}
-		prevPos[i] = pos
-		policy := g.PolicyMap[pos]
-		actions_list[i] = policy.GetActionProba()
+	if g.Replay != nil {
+		return g.updateReplay()
+	}
+	if g.Human != nil {
+		err := g.Human.Update()
+		g.Step = g.Human.Steps
+		return err
 	}
 
-	// Apply actions
-	rewards, done := g.Environment.Step(actions_list)
+	// act, apply actions, update policy based on rewards
+	rewards, done := g.Trainer.Step()
 	fmt.Println("Rewards:", rewards)
 	fmt.Println("Done:", done)
 	// if done {
 	// 	break
 	// }
 
-	// update policy based on rewards
-	for i, agent := range g.Environment.Agents {
-		agentAction := actions_list[i]
-		agentReward := rewards[i]
-		agentPos := ov.Position{X: agent.X, Y: agent.Y}
-
-		// Update current position policy
-		agentPolicy := g.PolicyMap[agentPos]
-		agentPolicy = agentPolicy.Update(agentPos, agentAction, agentReward)
-		g.PolicyMap[agentPos] = agentPolicy
-
-		// Check if agent moved (position changed)
-		if prevPos[i].X != agentPos.X || prevPos[i].Y != agentPos.Y {
-			prevDeducedAction := whichAction(prevPos[i], agentPos)
-
-			// Get previous position's policy
-			prevPolicy := g.PolicyMap[prevPos[i]]
-
-			// Calculate a discounted reward for the previous action
-			// This creates a smooth reward gradient that flows backward
-			discountFactor := float32(0.5) // Adjustable parameter
-			discountedReward := agentReward * discountFactor
-
-			// Only backpropagate positive rewards to encourage positive behavior chains
-			// If we didn't move or the reward is negative, don't update the policy
-			if prevDeducedAction != ov.Act_None && discountedReward > 0 {
-				prevPolicy = prevPolicy.Update(prevPos[i], prevDeducedAction, discountedReward)
-				g.PolicyMap[prevPos[i]] = prevPolicy
-			}
-		}
-	}
-
-	// early on, spawn some items
-	// every 15th step, spawn some items
-	if g.Step < 1000 && g.Step%15 == 0 {
-		g.Environment.EnvironmentSpawnRandomItemsForTraining()
-	}
-
 	// Display current state
 	fmt.Printf("\nStep %d:\n", g.Step)
-	g.Environment.Render()
+	g.Trainer.Env.Render()
 
 	g.Step++
 
@@ -117,21 +80,24 @@ func (g *Game) Update() error {
 	return nil
 }
 
-func whichAction(prevPos, newPos ov.Position) int {
-	if prevPos.X == newPos.X {
-		if prevPos.Y > newPos.Y {
-			return ov.Act_North
-		} else {
-			return ov.Act_South
-		}
-	} else {
-		if prevPos.X > newPos.X {
-			return ov.Act_West
-		} else {
-			return ov.Act_East
-		}
+// updateReplay shows the next recorded frame, and stays on the last one
+func (g *Game) updateReplay() error {
+	if g.Replay.Next() {
+		g.Step = g.Replay.Frame
+		time.Sleep(100 * time.Millisecond)
 	}
-	return ov.Act_None
+	return nil
+}
+
+// env returns the environment being shown
+func (g *Game) env() *ov.Environment {
+	if g.Replay != nil {
+		return &g.Replay.Env
+	}
+	if g.Human != nil {
+		return &g.Human.Env
+	}
+	return &g.Trainer.Env
 }
 
 // Draw draws the game screen.
@@ -141,11 +107,13 @@ func (g *Game) Draw(screen *ebiten.Image) {
 	// Example: Draw a simple rectangle
 	// screen.Fill(color.RGBA{0x80, 0x80, 0xc0, 0xff}) // light blue
 
+	env := g.env()
+
 	// Draw the environment
-	for x := 0; x < g.Environment.Width+1; x++ {
-		for y := 0; y < g.Environment.Height+1; y++ {
+	for x := 0; x < env.Width+1; x++ {
+		for y := 0; y < env.Height+1; y++ {
 			// Draw stations
-			station := g.Environment.GetStationAt(x, y)
+			station := env.GetStationAt(x, y)
 			if station != nil {
 				op := &ebiten.DrawImageOptions{}
 				op.GeoM.Translate(float64(x*64), float64(y*64))
@@ -165,11 +133,11 @@ func (g *Game) Draw(screen *ebiten.Image) {
 			}
 
 			// Draw items
-			item := g.Environment.GetItemAt(x, y)
+			item := env.GetItemAt(x, y)
 			if item != nil {
 				op := &ebiten.DrawImageOptions{}
 				op.GeoM.Translate(float64(x*64), float64(y*64))
-				switch item.Name {
+				switch item.Name[0:1] {
 				case ov.ItemOnionRaw:
 					screen.DrawImage(g.Images["onion_raw_64x64.png"], op)
 				case ov.ItemOnionChopped:
@@ -182,7 +150,7 @@ func (g *Game) Draw(screen *ebiten.Image) {
 	}
 
 	// Draw the agents
-	for i, agent := range g.Environment.Agents {
+	for i, agent := range env.Agents {
 		x := agent.X
 		y := agent.Y
 		// ebitenutil.DebugPrintAt(screen, "A", x*64, y*64)
@@ -194,15 +162,23 @@ func (g *Game) Draw(screen *ebiten.Image) {
 		case 1:
 			screen.DrawImage(g.Images["chef-2_64x64.png"], op)
 		}
+		// name the agents people play
+		if g.Human != nil {
+			for _, p := range g.Human.Players {
+				if p.Agent == agent.Name {
+					ebitenutil.DebugPrintAt(screen, agent.Name, x*64+2, y*64+50)
+				}
+			}
+		}
 	}
 
 	// Display total reward
-	ebitenutil.DebugPrintAt(screen, fmt.Sprintf("Total Reward: %.2f", g.Environment.TotalReward), 0, 0)
+	ebitenutil.DebugPrintAt(screen, fmt.Sprintf("Total Reward: %.2f", env.TotalReward), 0, 0)
 
 	// draw the step number
 	ebitenutil.DebugPrintAt(screen, fmt.Sprintf("Step: %d", g.Step), 0, 20)
 	// draw number of things that happened
-	eventCounts := g.Environment.EventCountsmap
+	eventCounts := env.EventCountsmap
 	if eventCounts == nil {
 		eventCounts = make(map[string]int)
 	}
@@ -223,6 +199,13 @@ func (g *Game) Draw(screen *ebiten.Image) {
 		ebitenutil.DebugPrintAt(screen, fmt.Sprintf("Soup Deliver: %d", soupDeliverCount), 0, 100)
 	}
 
+	// who plays with which keys
+	if g.Human != nil {
+		for i, line := range g.Human.Status() {
+			ebitenutil.DebugPrintAt(screen, line, 0, 400+i*16)
+		}
+	}
+
 }
 
 // Layout takes the outside size (e.g., the window size) and returns the (logical) screen size.
@@ -269,17 +252,73 @@ func (g *Game) loadImages() error {
 }
 
 func main() {
+	trajectory := flag.String("trajectory", "", "replay a trajectory recorded by the overcooker command instead of training")
+	humans := flag.String("humans", "", "agents people play instead of training, like a1:wasd,a2:arrows, key layouts: "+keyLayoutNames())
+	tick := flag.Duration("tick", 300*time.Millisecond, "with -humans, the kitchen steps this often, 0 waits until every player chose")
+	learner := flag.String("learner", "scripted", "with -humans, the policy of the other agents: random, scripted or a learner kind with -load")
+	load := flag.String("load", "", "with -humans, checkpoint of the -learner policy")
+	greedy := flag.Bool("greedy", false, "with -humans, the other agents take their policy's most probable action")
+	layout := flag.String("layout", "", "with -humans, layout file, empty for the built-in kitchen")
+	seed := flag.Int64("seed", 1, "with -humans, seeds item spawning and the policy, the same seed replays the same episodes")
+	maxSteps := flag.Int("max-steps", 200, "with -humans, steps per episode")
+	spawnEvery := flag.Int("spawn-every", 0, "with -humans, spawn random items every this many steps, 0 never")
+	record := flag.String("record", "", "with -humans, directory to save every episode's trajectory in")
+	flag.Parse()
+
 	game := &Game{}
-	game.Environment = ov.SimpleEnvironment()
 	// Specify the window size as you like. Here, a doubled size is specified.
 	ebiten.SetWindowSize(800, 600)
 	ebiten.SetWindowTitle("Overcooker")
 
-	env := game.Environment
+	env := ov.SimpleEnvironment()
 	game.Step = 1
 	game.MaxSteps = 5000
 
-	game.PolicyMap = ov.NewPolicyMap(env)
+	if *trajectory != "" {
+		t, err := ov.LoadTrajectory(*trajectory)
+		if err != nil {
+			log.Fatal(err)
+		}
+		game.Replay = ov.NewTrajectoryReplayer(t)
+		game.Step = 0
+	} else if *humans != "" {
+		players, err := ParsePlayers(*humans)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if *layout != "" {
+			if env, err = ov.LoadLayout(*layout); err != nil {
+				log.Fatal(err)
+			}
+		}
+		policy, err := ov.PolicyControllers(*learner, *load, env, *seed)
+		if err != nil {
+			log.Fatal(err)
+		}
+		base := env
+		game.Human = &HumanPlay{
+			NewEnv: func(seed int64) ov.Environment {
+				env := base.Clone()
+				env.Rand = rand.New(rand.NewSource(seed))
+				return env
+			},
+			NewPolicy: func(env ov.Environment, r *rand.Rand) (ov.Controller, error) {
+				return policy(env, *greedy, r)
+			},
+			Players:    players,
+			Tick:       *tick,
+			MaxSteps:   *maxSteps,
+			SpawnEvery: *spawnEvery,
+			Seed:       *seed,
+			Record:     *record,
+		}
+		if err := game.Human.Reset(0); err != nil {
+			log.Fatal(err)
+		}
+		game.Step = 0
+	} else {
+		game.Trainer = ov.NewTrainer(ov.SimpleEnvironment, ov.NewPolicyMapLearner(env))
+	}
 
 	// Load images
 	if err := game.loadImages(); err != nil {
@@ -0,0 +1,85 @@
+"""Drive the overcooker environment from Python over the gym protocol.
+
+Starts `overcooker gym` as a subprocess and talks line-delimited JSON to it.
+Only the standard library is needed, wrap OvercookerEnv in your RL library's
+environment class as it expects.
+
+    go build -o overcooker ../..
+    python overcooker_gym.py ./overcooker -max-steps 100
+"""
+
+import json
+import random
+import subprocess
+import sys
+
+PROTOCOL_VERSION = 1
+
+
+class OvercookerEnv:
+    def __init__(self, command):
+        # command is the overcooker binary followed by flags for gym
+        self.proc = subprocess.Popen(
+            [command[0], "gym"] + list(command[1:]),
+            stdin=subprocess.PIPE,
+            stdout=subprocess.PIPE,
+            text=True,
+        )
+        self.spec = self._call("spec")["spec"]
+        if self.spec["version"] != PROTOCOL_VERSION:
+            raise RuntimeError("unsupported protocol version %d" % self.spec["version"])
+
+    def _call(self, cmd, **fields):
+        request = dict(fields, cmd=cmd, version=PROTOCOL_VERSION)
+        self.proc.stdin.write(json.dumps(request) + "\n")
+        self.proc.stdin.flush()
+        response = json.loads(self.proc.stdout.readline())
+        if not response["ok"]:
+            raise RuntimeError("%s: %s" % (cmd, response["error"]))
+        return response
+
+    def reset(self, seed=None):
+        fields = {} if seed is None else {"seed": seed}
+        response = self._call("reset", **fields)
+        return response["observations"], response["info"]
+
+    def step(self, actions):
+        response = self._call("step", actions=list(actions))
+        return (
+            response["observations"],
+            response["rewards"],
+            response.get("terminated", False),
+            response.get("truncated", False),
+            response["info"],
+        )
+
+    def valid_actions(self):
+        return self._call("valid_actions")["valid_actions"]
+
+    def render(self):
+        return self._call("render")["render"]
+
+    def close(self):
+        self._call("close")
+        self.proc.wait()
+
+
+def main():
+    env = OvercookerEnv(sys.argv[1:] or ["overcooker"])
+    print("agents", env.spec["agents"], "observation size", env.spec["observation_size"])
+    obs, info = env.reset(seed=1)
+    events = {}
+    while True:
+        actions = [random.choice(valid) for valid in env.valid_actions()]
+        obs, rewards, terminated, truncated, info = env.step(actions)
+        for event, n in info.get("events", {}).items():
+            events[event] = events.get(event, 0) + n
+        if terminated or truncated:
+            break
+    print(env.render())
+    print("steps", info["step"], "return", round(info["total_reward"], 2), "events", events)
+    env.close()
+
+
+if __name__ == "__main__":
+    main()
@@ -0,0 +1,64 @@
+package nn
+
+import "math"
+
+// Adam is the Adam optimizer
+type Adam struct {
+	LR           float32
+	Beta1, Beta2 float32
+	Epsilon      float32
+	MaxGradNorm  float32 // clip the global gradient norm, 0 disables clipping
+
+	params []*Tensor
+	m, v   [][]float32
+	t      int
+}
+
+// NewAdam creates an optimizer for params with the usual defaults
+func NewAdam(params []*Tensor, lr float32) *Adam {
+	a := &Adam{LR: lr, Beta1: 0.9, Beta2: 0.999, Epsilon: 1e-8, params: params}
+	for _, p := range params {
+		a.m = append(a.m, make([]float32, len(p.Data)))
+		a.v = append(a.v, make([]float32, len(p.Data)))
+	}
+	return a
+}
+
+// ZeroGrad clears the gradients of every parameter
+func (a *Adam) ZeroGrad() {
+	for _, p := range a.params {
+		p.ZeroGrad()
+	}
+}
+
+// Step updates the parameters from their gradients
+func (a *Adam) Step() {
+	scale := float32(1)
+	if a.MaxGradNorm > 0 {
+		norm := 0.0
+		for _, p := range a.params {
+			for _, g := range p.Grad {
+				norm += float64(g) * float64(g)
+			}
+		}
+		norm = math.Sqrt(norm)
+		if norm > float64(a.MaxGradNorm) {
+			scale = a.MaxGradNorm / float32(norm)
+		}
+	}
+
+	a.t++
+	correction1 := 1 - float32(math.Pow(float64(a.Beta1), float64(a.t)))
+	correction2 := 1 - float32(math.Pow(float64(a.Beta2), float64(a.t)))
+	for i, p := range a.params {
+		m, v := a.m[i], a.v[i]
+		for j, g := range p.Grad {
+			g *= scale
+			m[j] = a.Beta1*m[j] + (1-a.Beta1)*g
+			v[j] = a.Beta2*v[j] + (1-a.Beta2)*g*g
+			mHat := m[j] / correction1
+			vHat := v[j] / correction2
+			p.Data[j] -= a.LR * mHat / (float32(math.Sqrt(float64(vHat))) + a.Epsilon)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package nn
+
+import (
+	"encoding/gob"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+)
+
+// Activation is the non-linearity between hidden layers
+type Activation int
+
+const (
+	ActReLU Activation = iota
+	ActTanh
+	ActLinear
+)
+
+// apply runs the activation on x
+func (a Activation) apply(x *Tensor) *Tensor {
+	switch a {
+	case ActReLU:
+		return ReLU(x)
+	case ActTanh:
+		return Tanh(x)
+	}
+	return x
+}
+
+// Dense is a fully connected layer: x W + b
+type Dense struct {
+	W *Tensor // in x out
+	B *Tensor // 1 x out
+}
+
+// NewDense creates a layer with He initialized weights and zero bias
+func NewDense(in, out int, rng *rand.Rand) *Dense {
+	d := &Dense{W: NewParam(in, out), B: NewParam(1, out)}
+	std := math.Sqrt(2 / float64(in))
+	for i := range d.W.Data {
+		d.W.Data[i] = float32(rng.NormFloat64() * std)
+	}
+	return d
+}
+
+// Forward returns x W + b for a batch x with one sample per row
+func (d *Dense) Forward(x *Tensor) *Tensor {
+	return Add(MatMul(x, d.W), d.B)
+}
+
+// MLP is a stack of dense layers with an activation between them
+// the output layer is linear, apply Softmax or LogSoftmax for a policy
+type MLP struct {
+	Layers     []*Dense
+	Activation Activation
+}
+
+// NewMLP creates a network with the given layer sizes, input first, output last
+func NewMLP(sizes []int, activation Activation, rng *rand.Rand) *MLP {
+	if len(sizes) < 2 {
+		panic(fmt.Sprintf("nn: an MLP needs at least input and output sizes, got %v", sizes))
+	}
+	m := &MLP{Activation: activation}
+	for i := 0; i+1 < len(sizes); i++ {
+		m.Layers = append(m.Layers, NewDense(sizes[i], sizes[i+1], rng))
+	}
+	// a small output layer keeps early policies close to uniform and values close to zero
+	last := m.Layers[len(m.Layers)-1]
+	for i := range last.W.Data {
+		last.W.Data[i] *= 0.1
+	}
+	return m
+}
+
+// Forward runs a batch through the network
+func (m *MLP) Forward(x *Tensor) *Tensor {
+	for i, layer := range m.Layers {
+		x = layer.Forward(x)
+		if i+1 < len(m.Layers) {
+			x = m.Activation.apply(x)
+		}
+	}
+	return x
+}
+
+// Params returns every trainable tensor, weights then bias, layer by layer
+func (m *MLP) Params() []*Tensor {
+	params := make([]*Tensor, 0, 2*len(m.Layers))
+	for _, layer := range m.Layers {
+		params = append(params, layer.W, layer.B)
+	}
+	return params
+}
+
+// ZeroGrad clears the gradients of every parameter
+func (m *MLP) ZeroGrad() {
+	for _, p := range m.Params() {
+		p.ZeroGrad()
+	}
+}
+
+// CopyFrom overwrites the weights with other's, the networks must have the same shape
+func (m *MLP) CopyFrom(other *MLP) {
+	mine, theirs := m.Params(), other.Params()
+	if len(mine) != len(theirs) {
+		panic("nn: copying between networks of different shapes")
+	}
+	for i := range mine {
+		copy(mine[i].Data, theirs[i].Data)
+	}
+}
+
+// Clone returns a copy of the network with its own weights
+func (m *MLP) Clone() *MLP {
+	clone := &MLP{Activation: m.Activation}
+	for _, layer := range m.Layers {
+		clone.Layers = append(clone.Layers, &Dense{
+			W: NewParam(layer.W.Rows, layer.W.Cols),
+			B: NewParam(layer.B.Rows, layer.B.Cols),
+		})
+	}
+	clone.CopyFrom(m)
+	return clone
+}
+
+// mlpFile is the on-disk form of an MLP
+type mlpFile struct {
+	Activation Activation
+	Shapes     [][2]int
+	Weights    [][]float32
+}
+
+// Save writes the network with encoding/gob
+func (m *MLP) Save(w io.Writer) error {
+	file := mlpFile{Activation: m.Activation}
+	for _, p := range m.Params() {
+		file.Shapes = append(file.Shapes, [2]int{p.Rows, p.Cols})
+		file.Weights = append(file.Weights, p.Data)
+	}
+	return gob.NewEncoder(w).Encode(file)
+}
+
+// LoadMLP reads a network written by Save
+func LoadMLP(r io.Reader) (*MLP, error) {
+	var file mlpFile
+	if err := gob.NewDecoder(r).Decode(&file); err != nil {
+		return nil, fmt.Errorf("decoding network: %w", err)
+	}
+	if len(file.Shapes)%2 != 0 || len(file.Shapes) != len(file.Weights) {
+		return nil, fmt.Errorf("decoding network: %d shapes for %d weight tensors", len(file.Shapes), len(file.Weights))
+	}
+	m := &MLP{Activation: file.Activation}
+	for i := 0; i < len(file.Shapes); i += 2 {
+		layer := &Dense{
+			W: NewParam(file.Shapes[i][0], file.Shapes[i][1]),
+			B: NewParam(file.Shapes[i+1][0], file.Shapes[i+1][1]),
+		}
+		if len(file.Weights[i]) != len(layer.W.Data) || len(file.Weights[i+1]) != len(layer.B.Data) {
+			return nil, fmt.Errorf("decoding network: layer %d has the wrong number of weights", i/2)
+		}
+		copy(layer.W.Data, file.Weights[i])
+		copy(layer.B.Data, file.Weights[i+1])
+		m.Layers = append(m.Layers, layer)
+	}
+	return m, nil
+}
@@ -0,0 +1,396 @@
+package nn
+
+import (
+	"fmt"
+	"math"
+)
+
+// sameShape panics when two tensors can't be combined element by element
+func sameShape(op string, a, b *Tensor) {
+	if a.Rows != b.Rows || a.Cols != b.Cols {
+		panic(fmt.Sprintf("nn: %s of %dx%d and %dx%d", op, a.Rows, a.Cols, b.Rows, b.Cols))
+	}
+}
+
+// MatMul returns a x b
+func MatMul(a, b *Tensor) *Tensor {
+	if a.Cols != b.Rows {
+		panic(fmt.Sprintf("nn: matmul of %dx%d and %dx%d", a.Rows, a.Cols, b.Rows, b.Cols))
+	}
+	n, k, m := a.Rows, a.Cols, b.Cols
+	out := result(n, m, a, b)
+	for i := 0; i < n; i++ {
+		outRow := out.Data[i*m : (i+1)*m]
+		for p := 0; p < k; p++ {
+			av := a.Data[i*k+p]
+			if av == 0 {
+				continue // observations are mostly zeros
+			}
+			bRow := b.Data[p*m : (p+1)*m]
+			for j := range outRow {
+				outRow[j] += av * bRow[j]
+			}
+		}
+	}
+	if out.Grad == nil {
+		return out
+	}
+	out.backward = func() {
+		for i := 0; i < n; i++ {
+			gRow := out.Grad[i*m : (i+1)*m]
+			for p := 0; p < k; p++ {
+				bRow := b.Data[p*m : (p+1)*m]
+				if a.Grad != nil {
+					sum := float32(0)
+					for j, g := range gRow {
+						sum += g * bRow[j]
+					}
+					a.Grad[i*k+p] += sum
+				}
+				if b.Grad != nil {
+					av := a.Data[i*k+p]
+					if av == 0 {
+						continue
+					}
+					bGrad := b.Grad[p*m : (p+1)*m]
+					for j, g := range gRow {
+						bGrad[j] += av * g
+					}
+				}
+			}
+		}
+	}
+	return out
+}
+
+// Add returns a + b, b may also be a single row added to every row of a (a bias)
+func Add(a, b *Tensor) *Tensor {
+	return addScaled("add", a, b, 1)
+}
+
+// Sub returns a - b, b may also be a single row subtracted from every row of a
+func Sub(a, b *Tensor) *Tensor {
+	return addScaled("sub", a, b, -1)
+}
+
+func addScaled(op string, a, b *Tensor, sign float32) *Tensor {
+	broadcast := b.Rows == 1 && a.Rows != 1 && b.Cols == a.Cols
+	if !broadcast {
+		sameShape(op, a, b)
+	}
+	out := result(a.Rows, a.Cols, a, b)
+	for i := range out.Data {
+		bi := i
+		if broadcast {
+			bi = i % a.Cols
+		}
+		out.Data[i] = a.Data[i] + sign*b.Data[bi]
+	}
+	if out.Grad == nil {
+		return out
+	}
+	out.backward = func() {
+		for i, g := range out.Grad {
+			if a.Grad != nil {
+				a.Grad[i] += g
+			}
+			if b.Grad != nil {
+				bi := i
+				if broadcast {
+					bi = i % a.Cols
+				}
+				b.Grad[bi] += sign * g
+			}
+		}
+	}
+	return out
+}
+
+// Mul returns the element-wise product of a and b
+func Mul(a, b *Tensor) *Tensor {
+	sameShape("mul", a, b)
+	out := result(a.Rows, a.Cols, a, b)
+	for i := range out.Data {
+		out.Data[i] = a.Data[i] * b.Data[i]
+	}
+	if out.Grad == nil {
+		return out
+	}
+	out.backward = func() {
+		for i, g := range out.Grad {
+			if a.Grad != nil {
+				a.Grad[i] += g * b.Data[i]
+			}
+			if b.Grad != nil {
+				b.Grad[i] += g * a.Data[i]
+			}
+		}
+	}
+	return out
+}
+
+// Minimum returns the element-wise minimum of a and b
+func Minimum(a, b *Tensor) *Tensor {
+	sameShape("minimum", a, b)
+	out := result(a.Rows, a.Cols, a, b)
+	for i := range out.Data {
+		out.Data[i] = a.Data[i]
+		if b.Data[i] < a.Data[i] {
+			out.Data[i] = b.Data[i]
+		}
+	}
+	if out.Grad == nil {
+		return out
+	}
+	out.backward = func() {
+		for i, g := range out.Grad {
+			if a.Data[i] <= b.Data[i] {
+				if a.Grad != nil {
+					a.Grad[i] += g
+				}
+			} else if b.Grad != nil {
+				b.Grad[i] += g
+			}
+		}
+	}
+	return out
+}
+
+// Scale returns s * a
+func Scale(a *Tensor, s float32) *Tensor {
+	return unary(a, func(x float32) float32 { return s * x }, func(x, y float32) float32 { return s })
+}
+
+// ReLU returns max(0, a)
+func ReLU(a *Tensor) *Tensor {
+	return unary(a,
+		func(x float32) float32 {
+			if x > 0 {
+				return x
+			}
+			return 0
+		},
+		func(x, y float32) float32 {
+			if x > 0 {
+				return 1
+			}
+			return 0
+		})
+}
+
+// Tanh returns tanh(a)
+func Tanh(a *Tensor) *Tensor {
+	return unary(a,
+		func(x float32) float32 { return float32(math.Tanh(float64(x))) },
+		func(x, y float32) float32 { return 1 - y*y })
+}
+
+// Exp returns e^a
+func Exp(a *Tensor) *Tensor {
+	return unary(a,
+		func(x float32) float32 { return float32(math.Exp(float64(x))) },
+		func(x, y float32) float32 { return y })
+}
+
+// Clamp limits a to [lo, hi], no gradient flows through clamped values
+func Clamp(a *Tensor, lo, hi float32) *Tensor {
+	return unary(a,
+		func(x float32) float32 {
+			if x < lo {
+				return lo
+			}
+			if x > hi {
+				return hi
+			}
+			return x
+		},
+		func(x, y float32) float32 {
+			if x < lo || x > hi {
+				return 0
+			}
+			return 1
+		})
+}
+
+// unary applies f element-wise, df(x, f(x)) is its derivative
+func unary(a *Tensor, f func(x float32) float32, df func(x, y float32) float32) *Tensor {
+	out := result(a.Rows, a.Cols, a)
+	for i, x := range a.Data {
+		out.Data[i] = f(x)
+	}
+	if out.Grad == nil {
+		return out
+	}
+	out.backward = func() {
+		for i, g := range out.Grad {
+			a.Grad[i] += g * df(a.Data[i], out.Data[i])
+		}
+	}
+	return out
+}
+
+// Softmax returns the row-wise softmax of a
+func Softmax(a *Tensor) *Tensor {
+	out := result(a.Rows, a.Cols, a)
+	for i := 0; i < a.Rows; i++ {
+		softmaxRow(a.Row(i), out.Row(i))
+	}
+	if out.Grad == nil {
+		return out
+	}
+	out.backward = func() {
+		for i := 0; i < a.Rows; i++ {
+			y := out.Row(i)
+			g := out.Grad[i*a.Cols : (i+1)*a.Cols]
+			dot := float32(0)
+			for j := range y {
+				dot += g[j] * y[j]
+			}
+			for j := range y {
+				a.Grad[i*a.Cols+j] += y[j] * (g[j] - dot)
+			}
+		}
+	}
+	return out
+}
+
+// LogSoftmax returns the row-wise log of the softmax of a, computed stably
+func LogSoftmax(a *Tensor) *Tensor {
+	out := result(a.Rows, a.Cols, a)
+	probs := make([]float32, a.Cols)
+	for i := 0; i < a.Rows; i++ {
+		row := a.Row(i)
+		maxV := row[0]
+		for _, x := range row {
+			if x > maxV {
+				maxV = x
+			}
+		}
+		sum := 0.0
+		for _, x := range row {
+			sum += math.Exp(float64(x - maxV))
+		}
+		logSum := maxV + float32(math.Log(sum))
+		for j, x := range row {
+			out.Data[i*a.Cols+j] = x - logSum
+		}
+	}
+	if out.Grad == nil {
+		return out
+	}
+	out.backward = func() {
+		for i := 0; i < a.Rows; i++ {
+			g := out.Grad[i*a.Cols : (i+1)*a.Cols]
+			sum := float32(0)
+			for _, v := range g {
+				sum += v
+			}
+			for j := range probs {
+				probs[j] = float32(math.Exp(float64(out.Data[i*a.Cols+j])))
+				a.Grad[i*a.Cols+j] += g[j] - probs[j]*sum
+			}
+		}
+	}
+	return out
+}
+
+// softmaxRow writes the softmax of x into y
+func softmaxRow(x, y []float32) {
+	maxV := x[0]
+	for _, v := range x {
+		if v > maxV {
+			maxV = v
+		}
+	}
+	sum := float32(0)
+	for j, v := range x {
+		y[j] = float32(math.Exp(float64(v - maxV)))
+		sum += y[j]
+	}
+	for j := range y {
+		y[j] /= sum
+	}
+}
+
+// Gather picks one column per row, index[i] from row i, returning a column vector
+// e.g. the value or log probability of the action each sample took
+func Gather(a *Tensor, index []int) *Tensor {
+	if len(index) != a.Rows {
+		panic(fmt.Sprintf("nn: gather %d indices from %d rows", len(index), a.Rows))
+	}
+	out := result(a.Rows, 1, a)
+	for i, j := range index {
+		out.Data[i] = a.Data[i*a.Cols+j]
+	}
+	if out.Grad == nil {
+		return out
+	}
+	out.backward = func() {
+		for i, j := range index {
+			a.Grad[i*a.Cols+j] += out.Grad[i]
+		}
+	}
+	return out
+}
+
+// Sum returns the sum of all elements as a 1x1 tensor
+func Sum(a *Tensor) *Tensor {
+	out := result(1, 1, a)
+	for _, x := range a.Data {
+		out.Data[0] += x
+	}
+	if out.Grad == nil {
+		return out
+	}
+	out.backward = func() {
+		for i := range a.Grad {
+			a.Grad[i] += out.Grad[0]
+		}
+	}
+	return out
+}
+
+// Mean returns the mean of all elements as a 1x1 tensor
+func Mean(a *Tensor) *Tensor {
+	return Scale(Sum(a), 1/float32(len(a.Data)))
+}
+
+// MSE returns the mean squared error between pred and target
+func MSE(pred, target *Tensor) *Tensor {
+	diff := Sub(pred, target)
+	return Mean(Mul(diff, diff))
+}
+
+// Huber returns the element-wise Huber loss, quadratic within delta and linear outside
+func Huber(pred, target *Tensor, delta float32) *Tensor {
+	sameShape("huber", pred, target)
+	out := result(pred.Rows, pred.Cols, pred, target)
+	for i := range out.Data {
+		d := pred.Data[i] - target.Data[i]
+		if d < -delta || d > delta {
+			out.Data[i] = delta * (float32(math.Abs(float64(d))) - delta/2)
+		} else {
+			out.Data[i] = d * d / 2
+		}
+	}
+	if out.Grad == nil {
+		return out
+	}
+	out.backward = func() {
+		for i, g := range out.Grad {
+			d := pred.Data[i] - target.Data[i]
+			if d > delta {
+				d = delta
+			} else if d < -delta {
+				d = -delta
+			}
+			if pred.Grad != nil {
+				pred.Grad[i] += g * d
+			}
+			if target.Grad != nil {
+				target.Grad[i] -= g * d
+			}
+		}
+	}
+	return out
+}
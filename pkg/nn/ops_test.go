@@ -0,0 +1,134 @@
+package nn
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// randParam returns a rows x cols parameter with values in [-1, 1)
+func randParam(rng *rand.Rand, rows, cols int) *Tensor {
+	t := NewParam(rows, cols)
+	for i := range t.Data {
+		t.Data[i] = float32(rng.Float64()*2 - 1)
+	}
+	return t
+}
+
+// awayFromZero returns a parameter whose values are at least 0.2 from 0, so kinks at 0 aren't straddled
+func awayFromZero(rng *rand.Rand, rows, cols int) *Tensor {
+	t := randParam(rng, rows, cols)
+	for i, x := range t.Data {
+		t.Data[i] = float32(math.Copysign(0.2+math.Abs(float64(x)), float64(x)))
+	}
+	return t
+}
+
+// weighted reduces out to a scalar loss with fixed random weights,
+// so every element of out gets a different upstream gradient
+func weighted(rng *rand.Rand, out *Tensor) func(*Tensor) *Tensor {
+	w := New(out.Rows, out.Cols)
+	for i := range w.Data {
+		w.Data[i] = float32(rng.Float64()*2 - 1)
+	}
+	return func(out *Tensor) *Tensor { return Sum(Mul(out, w)) }
+}
+
+// checkGrad compares the gradient Backward gives every input element
+// with a central finite difference of loss
+func checkGrad(t *testing.T, name string, loss func() *Tensor, inputs ...*Tensor) {
+	t.Helper()
+	for _, in := range inputs {
+		in.ZeroGrad()
+	}
+	loss().Backward()
+
+	const eps = 1e-2
+	for n, in := range inputs {
+		analytic := append([]float32(nil), in.Grad...)
+		for i := range in.Data {
+			x := in.Data[i]
+			in.Data[i] = x + eps
+			plus := float64(loss().Item())
+			in.Data[i] = x - eps
+			minus := float64(loss().Item())
+			in.Data[i] = x
+
+			numeric := (plus - minus) / (2 * eps)
+			got := float64(analytic[i])
+			if diff := math.Abs(got - numeric); diff > 1e-2+1e-2*math.Max(math.Abs(got), math.Abs(numeric)) {
+				t.Errorf("%s: input %d element %d: backward gives %.5f, finite difference %.5f", name, n, i, got, numeric)
+			}
+		}
+	}
+}
+
+func TestGradients(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+
+	a, b := randParam(rng, 3, 4), randParam(rng, 4, 5)
+	sum := weighted(rng, New(3, 5))
+	checkGrad(t, "MatMul", func() *Tensor { return sum(MatMul(a, b)) }, a, b)
+
+	x, y, bias := randParam(rng, 3, 4), randParam(rng, 3, 4), randParam(rng, 1, 4)
+	sum = weighted(rng, x)
+	checkGrad(t, "Add", func() *Tensor { return sum(Add(x, y)) }, x, y)
+	checkGrad(t, "Add bias", func() *Tensor { return sum(Add(x, bias)) }, x, bias)
+	checkGrad(t, "Sub", func() *Tensor { return sum(Sub(x, y)) }, x, y)
+	checkGrad(t, "Sub bias", func() *Tensor { return sum(Sub(x, bias)) }, x, bias)
+	checkGrad(t, "Mul", func() *Tensor { return sum(Mul(x, y)) }, x, y)
+	checkGrad(t, "Scale", func() *Tensor { return sum(Scale(x, -1.5)) }, x)
+	checkGrad(t, "Tanh", func() *Tensor { return sum(Tanh(x)) }, x)
+	checkGrad(t, "Exp", func() *Tensor { return sum(Exp(x)) }, x)
+	checkGrad(t, "Softmax", func() *Tensor { return sum(Softmax(x)) }, x)
+	checkGrad(t, "LogSoftmax", func() *Tensor { return sum(LogSoftmax(x)) }, x)
+	checkGrad(t, "Sum", func() *Tensor { return Sum(x) }, x)
+	checkGrad(t, "Mean", func() *Tensor { return Mean(x) }, x)
+	checkGrad(t, "MSE", func() *Tensor { return MSE(x, y) }, x, y)
+
+	kinked := awayFromZero(rng, 3, 4)
+	checkGrad(t, "ReLU", func() *Tensor { return sum(ReLU(kinked)) }, kinked)
+	// clamped to [-0.1, 0.1], so no value sits on a bound
+	checkGrad(t, "Clamp", func() *Tensor { return sum(Clamp(kinked, -0.1, 0.1)) }, kinked)
+	offset, other := awayFromZero(rng, 3, 4), NewParam(3, 4)
+	for i := range other.Data {
+		other.Data[i] = kinked.Data[i] + offset.Data[i]
+	}
+	checkGrad(t, "Minimum", func() *Tensor { return sum(Minimum(kinked, other)) }, kinked, other)
+
+	// differences within and beyond delta, none close to it
+	pred, target := NewParam(2, 4), NewParam(2, 4)
+	for i, d := range []float32{0.3, -0.6, 1.5, -2, 0.1, -0.2, 3, -1.4} {
+		pred.Data[i] = float32(rng.Float64())
+		target.Data[i] = pred.Data[i] - d
+	}
+	sum = weighted(rng, pred)
+	checkGrad(t, "Huber", func() *Tensor { return sum(Huber(pred, target, 1)) }, pred, target)
+
+	logits := randParam(rng, 4, 3)
+	sum = weighted(rng, New(4, 1))
+	checkGrad(t, "Gather", func() *Tensor { return sum(Gather(logits, []int{2, 0, 1, 2})) }, logits)
+}
+
+// a tensor used twice must collect the gradient of both uses
+func TestBackwardAccumulatesSharedInputs(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	x := randParam(rng, 2, 3)
+	checkGrad(t, "x*x+x", func() *Tensor { return Sum(Add(Mul(x, x), x)) }, x)
+}
+
+func TestMLPGradients(t *testing.T) {
+	rng := rand.New(rand.NewSource(3))
+	for _, activation := range []Activation{ActTanh, ActReLU} {
+		net := NewMLP([]int{5, 8, 4}, activation, rng)
+		input := New(3, 5)
+		for i := range input.Data {
+			input.Data[i] = float32(rng.Float64()*2 - 1)
+		}
+		actions := []int{0, 3, 1}
+		loss := func() *Tensor {
+			return Mean(Gather(LogSoftmax(net.Forward(input)), actions))
+		}
+		checkGrad(t, "MLP", loss, net.Params()...)
+	}
+}
@@ -0,0 +1,121 @@
+// Package nn is a small dependency-free neural network library
+// dense layers, a few activations, Adam, and reverse-mode autodiff over float32 slices
+// it runs on the CPU and is meant for the small networks the kitchen needs
+package nn
+
+import "fmt"
+
+// Tensor is a row-major matrix of float32, one row per sample in a batch
+// tensors produced by operations remember how to pass gradients back to their inputs
+type Tensor struct {
+	Rows, Cols int
+	Data       []float32
+	Grad       []float32 // nil unless the tensor needs a gradient
+
+	parents  []*Tensor
+	backward func()
+}
+
+// New returns a zero tensor that doesn't need a gradient, like an input batch
+func New(rows, cols int) *Tensor {
+	return &Tensor{Rows: rows, Cols: cols, Data: make([]float32, rows*cols)}
+}
+
+// FromSlice wraps data as a rows x cols tensor without copying
+func FromSlice(rows, cols int, data []float32) *Tensor {
+	if len(data) != rows*cols {
+		panic(fmt.Sprintf("nn: %d values for a %dx%d tensor", len(data), rows, cols))
+	}
+	return &Tensor{Rows: rows, Cols: cols, Data: data}
+}
+
+// NewParam returns a zero tensor that collects gradients, like a weight matrix
+func NewParam(rows, cols int) *Tensor {
+	t := New(rows, cols)
+	t.Grad = make([]float32, rows*cols)
+	return t
+}
+
+// At returns the value at row i, column j
+func (t *Tensor) At(i, j int) float32 {
+	return t.Data[i*t.Cols+j]
+}
+
+// Row returns row i, sharing memory with the tensor
+func (t *Tensor) Row(i int) []float32 {
+	return t.Data[i*t.Cols : (i+1)*t.Cols]
+}
+
+// Item returns the value of a 1x1 tensor, like a loss
+func (t *Tensor) Item() float32 {
+	return t.Data[0]
+}
+
+// RequiresGrad reports whether gradients flow into this tensor
+func (t *Tensor) RequiresGrad() bool {
+	return t.Grad != nil
+}
+
+// ZeroGrad clears the accumulated gradient
+func (t *Tensor) ZeroGrad() {
+	for i := range t.Grad {
+		t.Grad[i] = 0
+	}
+}
+
+// Detach returns a copy of the values that is cut off from the graph
+func (t *Tensor) Detach() *Tensor {
+	data := make([]float32, len(t.Data))
+	copy(data, t.Data)
+	return FromSlice(t.Rows, t.Cols, data)
+}
+
+// result creates the output of an operation over parents
+// it only tracks gradients when one of the parents does
+func result(rows, cols int, parents ...*Tensor) *Tensor {
+	out := New(rows, cols)
+	for _, p := range parents {
+		if p.RequiresGrad() {
+			out.Grad = make([]float32, rows*cols)
+			out.parents = parents
+			break
+		}
+	}
+	return out
+}
+
+// Backward computes the gradient of t, a 1x1 loss, with respect to every tensor it depends on
+// gradients accumulate, so zero the parameters' gradients between steps
+func (t *Tensor) Backward() {
+	if !t.RequiresGrad() {
+		return
+	}
+	if len(t.Data) != 1 {
+		panic(fmt.Sprintf("nn: backward from a %dx%d tensor, expected a 1x1 loss", t.Rows, t.Cols))
+	}
+
+	// topological order, parents before children
+	order := []*Tensor{}
+	visited := map[*Tensor]bool{}
+	var visit func(*Tensor)
+	visit = func(n *Tensor) {
+		if visited[n] {
+			return
+		}
+		visited[n] = true
+		for _, p := range n.parents {
+			if p.RequiresGrad() {
+				visit(p)
+			}
+		}
+		order = append(order, n)
+	}
+	visit(t)
+
+	t.Grad[0] = 1
+	for i := len(order) - 1; i >= 0; i-- {
+		if order[i].backward != nil {
+			order[i].backward()
+		}
+	}
+}
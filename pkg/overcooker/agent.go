@@ -2,7 +2,7 @@ package overcooker
 
 // Agent is a person or a robot in the environment
 type Agent struct {
-	Name string
+	Name string // unique in the kitchen, it identifies the agent as others join and leave
 	X, Y int
 
 	// agent inventory, only 1 object at a time
@@ -22,3 +22,6 @@ const Act_South = 2
 const Act_East = 3
 const Act_West = 4
 const Act_Interact = 5
+
+// ActionNames names the actions by number
+var ActionNames = []string{"none", "north", "south", "east", "west", "interact"}
@@ -0,0 +1,192 @@
+package overcooker
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// CEMConfig configures the cross-entropy method
+type CEMConfig struct {
+	Samples       int     `json:"samples"`       // policy maps sampled and evaluated per iteration
+	EliteFrac     float64 `json:"elite_frac"`    // share of the samples the distribution is refit to
+	Concentration float64 `json:"concentration"` // Dirichlet concentration, higher samples closer to the mean
+	Smoothing     float64 `json:"smoothing"`     // weight of the elite mean when refitting, 1 replaces the mean
+	Seed          int64   `json:"-"`
+}
+
+// DefaultCEMConfig returns a robust starting configuration
+func DefaultCEMConfig() CEMConfig {
+	return CEMConfig{
+		Samples:       20,
+		EliteFrac:     0.2,
+		Concentration: 6,
+		Smoothing:     0.7,
+		Seed:          1,
+	}
+}
+
+// CEMIterationStats summarizes one CEM iteration
+type CEMIterationStats struct {
+	Iteration  int
+	MeanReturn float64 // over all samples
+	EliteMean  float64 // over the elite samples
+	EliteMax   float64
+}
+
+// CEMLearner is a cross-entropy method optimizer over policy maps
+// every cell holds a Dirichlet distribution around Mean, each episode plays one
+// sampled map, and after Samples episodes the distribution is refit to the elites
+// it plugs into the Trainer like any other Learner, one episode per sample
+type CEMLearner struct {
+	Config CEMConfig
+	Mean   PolicyMap
+
+	Samples   []PolicyMap // maps of the current iteration
+	returns   []float64
+	current   int // sample being played
+	Iteration int
+	History   []CEMIterationStats
+
+	// OnIteration, when set, is called after each refit
+	OnIteration func(CEMIterationStats)
+
+	rng *rand.Rand
+}
+
+// NewCEMLearner creates a learner centered on the uniform policy map for env
+func NewCEMLearner(env Environment, config CEMConfig) *CEMLearner {
+	if config.Samples < 1 {
+		config.Samples = 1
+	}
+	if config.Concentration <= 0 {
+		config.Concentration = DefaultCEMConfig().Concentration
+	}
+	if config.Smoothing <= 0 || config.Smoothing > 1 {
+		config.Smoothing = 1
+	}
+	l := &CEMLearner{
+		Config: config,
+		Mean:   NewPolicyMap(env),
+		rng:    rand.New(rand.NewSource(config.Seed)),
+	}
+	l.sampleMaps()
+	return l
+}
+
+// Act plays the current sample
+func (l *CEMLearner) Act(env *Environment) []int {
+	return PolicyMapController{Map: l.Samples[l.current], Rand: l.rng}.Actions(env)
+}
+
+// Learn does nothing, CEM only looks at episode returns
+func (l *CEMLearner) Learn(env *Environment, actions []int, rewards []float32, done, truncated bool) {
+}
+
+// EndEpisode scores the current sample and refits once all samples are scored
+func (l *CEMLearner) EndEpisode(episodeReturn float64) {
+	l.returns[l.current] = episodeReturn
+	l.current++
+	if l.current < len(l.Samples) {
+		return
+	}
+
+	stats := l.refit()
+	l.History = append(l.History, stats)
+	if l.OnIteration != nil {
+		l.OnIteration(stats)
+	}
+	l.Iteration++
+	l.sampleMaps()
+}
+
+// sampleMaps draws a new batch of policy maps from the distribution
+func (l *CEMLearner) sampleMaps() {
+	l.Samples = make([]PolicyMap, l.Config.Samples)
+	l.returns = make([]float64, l.Config.Samples)
+	l.current = 0
+	for i := range l.Samples {
+		sample := make(PolicyMap, len(l.Mean))
+		for _, pos := range sortedPositions(l.Mean) {
+			sample[pos] = l.sampleDirichlet(l.Mean[pos])
+		}
+		l.Samples[i] = sample
+	}
+}
+
+// sampleDirichlet draws a policy from Dirichlet(Concentration * mean)
+func (l *CEMLearner) sampleDirichlet(mean Policy) Policy {
+	policy := make(Policy, Act_Interact+1)
+	for a := Act_None; a <= Act_Interact; a++ {
+		alpha := l.Config.Concentration * float64(mean[a]) * (Act_Interact + 1)
+		if alpha < 1e-3 {
+			alpha = 1e-3
+		}
+		policy[a] = float32(sampleGamma(l.rng, alpha))
+	}
+	policy.Normalize()
+	return policy
+}
+
+// refit moves the mean toward the average of the elite samples
+func (l *CEMLearner) refit() CEMIterationStats {
+	order := make([]int, len(l.Samples))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return l.returns[order[a]] > l.returns[order[b]] })
+
+	numElites := int(math.Ceil(l.Config.EliteFrac * float64(len(l.Samples))))
+	if numElites < 1 {
+		numElites = 1
+	}
+	if numElites > len(l.Samples) {
+		numElites = len(l.Samples)
+	}
+
+	stats := CEMIterationStats{Iteration: l.Iteration, EliteMax: l.returns[order[0]]}
+	for _, ret := range l.returns {
+		stats.MeanReturn += ret
+	}
+	stats.MeanReturn /= float64(len(l.returns))
+	for _, i := range order[:numElites] {
+		stats.EliteMean += l.returns[i]
+	}
+	stats.EliteMean /= float64(numElites)
+
+	smoothing := float32(l.Config.Smoothing)
+	for pos, mean := range l.Mean {
+		for a := Act_None; a <= Act_Interact; a++ {
+			eliteProb := float32(0.0)
+			for _, i := range order[:numElites] {
+				eliteProb += l.Samples[i][pos][a]
+			}
+			eliteProb /= float32(numElites)
+			mean[a] = (1-smoothing)*mean[a] + smoothing*eliteProb
+		}
+		mean.Normalize()
+	}
+	return stats
+}
+
+// sampleGamma draws from Gamma(shape, 1) with Marsaglia and Tsang's method
+func sampleGamma(r *rand.Rand, shape float64) float64 {
+	if shape < 1 {
+		// boost small shapes: Gamma(a) = Gamma(a+1) * U^(1/a)
+		return sampleGamma(r, shape+1) * math.Pow(r.Float64(), 1/shape)
+	}
+	d := shape - 1.0/3
+	c := 1 / math.Sqrt(9*d)
+	for {
+		x := r.NormFloat64()
+		v := 1 + c*x
+		if v <= 0 {
+			continue
+		}
+		v = v * v * v
+		u := r.Float64()
+		if math.Log(u) < 0.5*x*x+d-d*v+d*math.Log(v) {
+			return d * v
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package overcooker
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+// the same seed samples the same maps
+func TestCEMLearnerIsReproducible(t *testing.T) {
+	env := quietEnvironment()
+	a := NewCEMLearner(env, DefaultCEMConfig())
+	b := NewCEMLearner(env, DefaultCEMConfig())
+	for iteration := 0; iteration < 2; iteration++ {
+		if !reflect.DeepEqual(a.Samples, b.Samples) {
+			t.Fatalf("iteration %d: the samples differ", iteration)
+		}
+		for i := range a.Samples {
+			a.EndEpisode(float64(i))
+			b.EndEpisode(float64(i))
+		}
+		if !reflect.DeepEqual(a.Mean, b.Mean) {
+			t.Fatalf("iteration %d: the refit means differ", iteration)
+		}
+	}
+}
+
+// the mean moves toward the average of the best samples and stays normalized
+func TestCEMLearnerRefitsToElites(t *testing.T) {
+	env := quietEnvironment()
+	config := DefaultCEMConfig()
+	l := NewCEMLearner(env, config)
+	samples := l.Samples
+	for i, pm := range samples {
+		checkPolicyMapNormalized(t, pm, "sample", i)
+	}
+
+	// the last samples score best
+	for i := range samples {
+		l.EndEpisode(float64(i))
+	}
+	numElites := int(math.Ceil(config.EliteFrac * float64(len(samples))))
+	elites := samples[len(samples)-numElites:]
+
+	stats := l.History[0]
+	if stats.EliteMax != float64(len(samples)-1) {
+		t.Errorf("EliteMax = %v, want %v", stats.EliteMax, len(samples)-1)
+	}
+	checkPolicyMapNormalized(t, l.Mean, "mean", 0)
+	for pos, mean := range l.Mean {
+		for a := Act_None; a <= Act_Interact; a++ {
+			elite := float32(0)
+			for _, pm := range elites {
+				elite += pm[pos][a]
+			}
+			elite /= float32(numElites)
+			want := (1-float32(config.Smoothing))*NewPolicy()[a] + float32(config.Smoothing)*elite
+			if math.Abs(float64(mean[a]-want)) > 1e-5 {
+				t.Fatalf("mean at %v for action %d = %v, want %v", pos, a, mean[a], want)
+			}
+		}
+	}
+	if l.Iteration != 1 || len(l.Samples) != config.Samples {
+		t.Errorf("after a refit: iteration %d with %d samples, want 1 with %d", l.Iteration, len(l.Samples), config.Samples)
+	}
+}
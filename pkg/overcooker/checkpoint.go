@@ -0,0 +1,87 @@
+package overcooker
+
+import (
+	"encoding/gob"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Checkpointer is a learner that can be saved to a file and restored from it
+type Checkpointer interface {
+	SaveCheckpoint(path string) error
+	LoadCheckpoint(path string) error
+}
+
+// Save writes the policy map to w
+func (pm PolicyMap) Save(w io.Writer) error {
+	return gob.NewEncoder(w).Encode(pm)
+}
+
+// LoadPolicyMap reads a policy map written by PolicyMap.Save
+func LoadPolicyMap(r io.Reader) (PolicyMap, error) {
+	var pm PolicyMap
+	if err := gob.NewDecoder(r).Decode(&pm); err != nil {
+		return nil, fmt.Errorf("decoding policy map: %w", err)
+	}
+	return pm, nil
+}
+
+// policyMapCheckpoint is the on-disk form of a policy map learner
+type policyMapCheckpoint struct {
+	Map          PolicyMap
+	Sharing      MapSharing
+	Roles        map[string]string
+	Maps         map[string]PolicyMap
+	LearningRate float32
+}
+
+// SaveCheckpoint writes the learner's maps and settings to path
+func (l *PolicyMapLearner) SaveCheckpoint(path string) error {
+	checkpoint := policyMapCheckpoint{
+		Map:          l.Map,
+		Sharing:      l.Sharing,
+		Roles:        l.Roles,
+		Maps:         l.Maps,
+		LearningRate: l.LearningRate,
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("creating checkpoint %s: %w", path, err)
+	}
+	defer f.Close()
+	if err := gob.NewEncoder(f).Encode(checkpoint); err != nil {
+		return fmt.Errorf("writing checkpoint %s: %w", path, err)
+	}
+	return f.Close()
+}
+
+// LoadCheckpoint restores maps and settings written by SaveCheckpoint
+func (l *PolicyMapLearner) LoadCheckpoint(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("opening checkpoint %s: %w", path, err)
+	}
+	defer f.Close()
+
+	var checkpoint policyMapCheckpoint
+	if err := gob.NewDecoder(f).Decode(&checkpoint); err != nil {
+		return fmt.Errorf("reading checkpoint %s: %w", path, err)
+	}
+	if checkpoint.Map == nil {
+		return fmt.Errorf("checkpoint %s has no policy map", path)
+	}
+	l.Map = checkpoint.Map
+	l.Sharing = checkpoint.Sharing
+	l.Roles = checkpoint.Roles
+	l.Maps = checkpoint.Maps
+	if l.Maps == nil {
+		l.Maps = map[string]PolicyMap{}
+	}
+	l.LearningRate = checkpoint.LearningRate
+	if l.LearningRate == 0 {
+		l.LearningRate = DefaultPolicyLearningRate // checkpoints from before it was saved
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package overcooker
+
+import "math/rand"
+
+// Controller picks one action for every agent in the environment
+// it's how planners, rollouts and evaluation drive agents without learning
+type Controller interface {
+	Actions(env *Environment) []int
+}
+
+// RandomController picks uniformly random actions
+type RandomController struct {
+	Rand *rand.Rand // nil uses the global source
+}
+
+// Actions returns a random action per agent
+func (c RandomController) Actions(env *Environment) []int {
+	actions := make([]int, len(env.Agents))
+	for i := range actions {
+		if c.Rand != nil {
+			actions[i] = c.Rand.Intn(Act_Interact + 1)
+		} else {
+			actions[i] = rand.Intn(Act_Interact + 1)
+		}
+	}
+	return actions
+}
+
+// PolicyMapController follows a policy map, every agent reads the policy under its feet
+type PolicyMapController struct {
+	Map    PolicyMap
+	Greedy bool       // take the most probable action instead of sampling
+	Rand   *rand.Rand // nil uses the global source
+}
+
+// Actions returns the policy map's action for each agent
+func (c PolicyMapController) Actions(env *Environment) []int {
+	actions := make([]int, len(env.Agents))
+	for i, agent := range env.Agents {
+		policy := c.Map[Position{X: agent.X, Y: agent.Y}]
+		switch {
+		case c.Greedy:
+			actions[i] = policy.GetActionBest()
+		case c.Rand != nil:
+			actions[i] = policy.GetActionProbaRand(c.Rand)
+		default:
+			actions[i] = policy.GetActionProba()
+		}
+	}
+	return actions
+}
+
+// ScriptedController walks each agent through the onion soup recipe
+// onion box -> chopping -> stove -> delivery, going to the nearest station each time
+type ScriptedController struct{}
+
+// nextStation returns the kind of station an agent holding item should visit
+func nextStation(item string) string {
+	switch item {
+	case "":
+		return StationOnion
+	case ItemOnionRaw:
+		return StationChop
+	case ItemOnionChopped:
+		return StationStove
+	case ItemSoup:
+		return StationDelivery
+	}
+	return ""
+}
+
+// Actions returns the next recipe step for each agent
+func (c ScriptedController) Actions(env *Environment) []int {
+	actions := make([]int, len(env.Agents))
+	for i, agent := range env.Agents {
+		actions[i] = Act_None
+
+		kind := nextStation(agent.Inventory.Name)
+		if kind == "" {
+			continue // holding something the recipe can't use
+		}
+		pos := Position{X: agent.X, Y: agent.Y}
+		station, _ := env.NearestStation(pos, kind)
+		if station == nil {
+			continue
+		}
+		goal := Position{X: station.X, Y: station.Y}
+		if pos == goal {
+			actions[i] = Act_Interact
+			continue
+		}
+
+		// route around the other agents, fall back to the static route when boxed in
+		if path, ok := env.FindPath(pos, goal, true); ok && len(path) > 0 {
+			actions[i] = ActionBetween(pos, path[0])
+		} else {
+			actions[i] = env.DistanceFieldTo(goal, false).BestAction(pos.X, pos.Y)
+		}
+	}
+	return actions
+}
+
+// RunEpisode drives env with the controller for up to steps steps
+// and returns the total reward collected during the episode
+func RunEpisode(env *Environment, c Controller, steps int) float64 {
+	start := env.TotalReward
+	for step := 0; step < steps; step++ {
+		_, done := env.Step(c.Actions(env))
+		if done {
+			break
+		}
+	}
+	return env.TotalReward - start
+}
+
+// AgentMapsController gives each agent its own policy map, keyed by agent name
+// agents without a map of their own use Fallback
+type AgentMapsController struct {
+	Maps     map[string]PolicyMap
+	Fallback PolicyMap
+	Greedy   bool
+	Rand     *rand.Rand // nil uses the global source
+}
+
+// Actions returns each agent's action from its own map
+func (c AgentMapsController) Actions(env *Environment) []int {
+	actions := make([]int, len(env.Agents))
+	for i, agent := range env.Agents {
+		pm, ok := c.Maps[agent.Name]
+		if !ok {
+			pm = c.Fallback
+		}
+		policy := pm[Position{X: agent.X, Y: agent.Y}]
+		switch {
+		case c.Greedy:
+			actions[i] = policy.GetActionBest()
+		case c.Rand != nil:
+			actions[i] = policy.GetActionProbaRand(c.Rand)
+		default:
+			actions[i] = policy.GetActionProba()
+		}
+	}
+	return actions
+}
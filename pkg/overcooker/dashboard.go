@@ -0,0 +1,210 @@
+package overcooker
+
+import (
+	"encoding/json"
+	"errors"
+	"html/template"
+	"io/fs"
+	"net/http"
+)
+
+// MetricsRun is one named series of episodes on the dashboard
+type MetricsRun struct {
+	Name     string           `json:"name"`
+	Episodes []EpisodeMetrics `json:"episodes"`
+}
+
+// MetricsSource returns the runs to chart, the dashboard calls it on every refresh
+type MetricsSource func() ([]MetricsRun, error)
+
+// MetricsFiles charts metrics logs, re-reading them on every refresh so the charts follow training
+// a log that doesn't exist yet shows as an empty run
+func MetricsFiles(paths ...string) MetricsSource {
+	return func() ([]MetricsRun, error) {
+		runs := make([]MetricsRun, len(paths))
+		for i, path := range paths {
+			episodes, err := ReadMetricsFile(path)
+			if err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return nil, err
+			}
+			runs[i] = MetricsRun{Name: path, Episodes: episodes}
+		}
+		return runs, nil
+	}
+}
+
+// Source charts the episodes the recorder has seen so far
+func (m *MetricsRecorder) Source(name string) MetricsSource {
+	return func() ([]MetricsRun, error) {
+		return []MetricsRun{{Name: name, Episodes: m.History()}}, nil
+	}
+}
+
+// NewDashboard serves a page of live learning curves at / and the data behind it at /metrics
+func NewDashboard(title string, source MetricsSource) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		dashboardPage.Execute(w, map[string]interface{}{"Title": title, "Events": MetricEvents})
+	})
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		runs, err := source()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(runs)
+	})
+	return mux
+}
+
+// dashboardPage draws the charts itself so the dashboard works offline
+var dashboardPage = template.Must(template.New("dashboard").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; margin: 1em 2em; background: #fafafa; color: #222; }
+#charts { display: grid; grid-template-columns: repeat(auto-fill, minmax(460px, 1fr)); gap: 1em; }
+.chart { background: #fff; border: 1px solid #ddd; padding: 0.5em; }
+.chart h3 { margin: 0 0 0.3em; font-size: 0.95em; font-weight: normal; }
+#legend span { margin-right: 1.5em; }
+#status { color: #888; font-size: 0.85em; }
+</style>
+</head>
+<body>
+<h2>{{.Title}}</h2>
+<p>
+<label>smoothing <input id="window" type="number" min="1" value="10" style="width:4em"> episodes</label>
+<span id="status"></span>
+</p>
+<p id="legend"></p>
+<div id="charts"></div>
+<script>
+const events = [{{range $i, $e := .Events}}{{if $i}}, {{end}}{{$e}}{{end}}];
+const charts = [
+  {title: "return", value: m => m.return},
+  {title: "deliveries", value: m => m.deliveries},
+  {title: "invalid action rate", value: m => m.invalid_action_rate},
+  {title: "policy entropy (nats)", value: m => m.policy_entropy},
+  {title: "steps / sec", value: m => m.steps_per_sec},
+].concat(events.map(e => ({title: "events: " + e, value: m => (m.events || {})[e] || 0})));
+const colors = ["#1f77b4", "#d62728", "#2ca02c", "#ff7f0e", "#9467bd", "#8c564b", "#e377c2", "#17becf"];
+
+const container = document.getElementById("charts");
+for (const chart of charts) {
+  const div = document.createElement("div");
+  div.className = "chart";
+  const h = document.createElement("h3");
+  h.textContent = chart.title;
+  chart.canvas = document.createElement("canvas");
+  chart.canvas.width = 460;
+  chart.canvas.height = 220;
+  div.append(h, chart.canvas);
+  container.append(div);
+}
+
+function smooth(ys, n) {
+  const out = [];
+  let sum = 0, count = 0;
+  for (let i = 0; i < ys.length; i++) {
+    if (ys[i] !== undefined) { sum += ys[i]; count++; }
+    if (i >= n && ys[i - n] !== undefined) { sum -= ys[i - n]; count--; }
+    out.push(count ? sum / count : undefined);
+  }
+  return out;
+}
+
+function draw(chart, runs, window) {
+  const c = chart.canvas, ctx = c.getContext("2d");
+  const pad = {l: 50, r: 10, t: 10, b: 25};
+  ctx.clearRect(0, 0, c.width, c.height);
+  const series = runs.map(run => {
+    const xs = run.episodes.map(m => m.episode);
+    const ys = run.episodes.map(m => chart.value(m));
+    return {xs, ys, smooth: smooth(ys, window)};
+  });
+  let xmin = Infinity, xmax = -Infinity, ymin = Infinity, ymax = -Infinity;
+  for (const s of series) {
+    s.xs.forEach((x, i) => {
+      if (s.ys[i] === undefined) return;
+      xmin = Math.min(xmin, x); xmax = Math.max(xmax, x);
+      ymin = Math.min(ymin, s.ys[i]); ymax = Math.max(ymax, s.ys[i]);
+    });
+  }
+  ctx.fillStyle = "#888";
+  ctx.font = "11px sans-serif";
+  if (xmin > xmax) { ctx.fillText("no data yet", pad.l, c.height / 2); return; }
+  if (xmin === xmax) xmax = xmin + 1;
+  if (ymin === ymax) { ymin -= 1; ymax += 1; }
+  const px = x => pad.l + (x - xmin) / (xmax - xmin) * (c.width - pad.l - pad.r);
+  const py = y => c.height - pad.b - (y - ymin) / (ymax - ymin) * (c.height - pad.t - pad.b);
+
+  ctx.strokeStyle = "#ccc";
+  ctx.beginPath();
+  ctx.moveTo(pad.l, pad.t); ctx.lineTo(pad.l, c.height - pad.b); ctx.lineTo(c.width - pad.r, c.height - pad.b);
+  ctx.stroke();
+  ctx.textAlign = "right";
+  ctx.fillText(ymax.toPrecision(3), pad.l - 4, pad.t + 8);
+  ctx.fillText(ymin.toPrecision(3), pad.l - 4, c.height - pad.b);
+  ctx.textAlign = "center";
+  ctx.fillText("episode " + xmin, pad.l + 30, c.height - 8);
+  ctx.fillText(String(xmax), c.width - pad.r - 15, c.height - 8);
+
+  series.forEach((s, k) => {
+    const color = colors[k % colors.length];
+    for (const [ys, alpha, width] of [[s.ys, 0.25, 1], [s.smooth, 1, 2]]) {
+      ctx.strokeStyle = color;
+      ctx.globalAlpha = alpha;
+      ctx.lineWidth = width;
+      ctx.beginPath();
+      let drawing = false;
+      s.xs.forEach((x, i) => {
+        if (ys[i] === undefined) { drawing = false; return; }
+        if (drawing) ctx.lineTo(px(x), py(ys[i])); else ctx.moveTo(px(x), py(ys[i]));
+        drawing = true;
+      });
+      ctx.stroke();
+    }
+    ctx.globalAlpha = 1;
+    ctx.lineWidth = 1;
+  });
+}
+
+async function refresh() {
+  const status = document.getElementById("status");
+  try {
+    const resp = await fetch("metrics");
+    if (!resp.ok) throw new Error(await resp.text());
+    const runs = await resp.json();
+    const window = Math.max(1, parseInt(document.getElementById("window").value) || 1);
+    const legend = document.getElementById("legend");
+    legend.innerHTML = "";
+    runs.forEach((run, k) => {
+      const span = document.createElement("span");
+      span.style.color = colors[k % colors.length];
+      const last = run.episodes[run.episodes.length - 1];
+      span.textContent = run.name + " (" + run.episodes.length + " episodes" +
+        (last ? ", last return " + last.return.toFixed(2) : "") + ")";
+      legend.append(span);
+    });
+    for (const chart of charts) draw(chart, runs, window);
+    status.textContent = "updated " + new Date().toLocaleTimeString();
+  } catch (err) {
+    status.textContent = "refresh failed: " + err.message;
+  }
+}
+refresh();
+setInterval(refresh, 2000);
+document.getElementById("window").addEventListener("change", refresh);
+</script>
+</body>
+</html>
+`))
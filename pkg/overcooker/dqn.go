@@ -0,0 +1,381 @@
+package overcooker
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"sort"
+
+	"github.com/shanecandoit/go_overcooker/pkg/nn"
+)
+
+// DQNConfig configures the DQN learner
+type DQNConfig struct {
+	Hidden       []int   `json:"hidden"`        // hidden layer sizes
+	LearningRate float32 `json:"learning_rate"` // Adam step size
+	Gamma        float64 `json:"gamma"`
+	BatchSize    int     `json:"batch_size"`
+
+	BufferSize     int `json:"buffer_size"`
+	LearningStarts int `json:"learning_starts"` // transitions stored before the first update
+	TrainEvery     int `json:"train_every"`     // environment steps between updates
+	TargetSync     int `json:"target_sync"`     // environment steps between target network syncs
+
+	DoubleDQN bool `json:"double_dqn"` // pick the next action with the online network, score it with the target
+	NSteps    int  `json:"n_steps"`    // n-step returns, 1 is plain TD
+
+	EpsilonStart      float64 `json:"epsilon_start"`
+	EpsilonEnd        float64 `json:"epsilon_end"`
+	EpsilonDecaySteps int     `json:"epsilon_decay_steps"` // linear decay from start to end over this many steps
+
+	Prioritized   bool    `json:"prioritized"`    // prioritized replay instead of uniform
+	PriorityAlpha float64 `json:"priority_alpha"` // how much priorities shape sampling
+	PriorityBeta  float64 `json:"priority_beta"`  // importance sampling correction, annealed to 1 over the decay
+
+	// ShareParameters trains one network for all agents,
+	// otherwise every agent (by name) gets its own network and replay buffer
+	ShareParameters bool `json:"share_parameters"`
+
+	Seed int64 `json:"-"`
+}
+
+// DefaultDQNConfig returns a standard small DQN setup
+func DefaultDQNConfig() DQNConfig {
+	return DQNConfig{
+		Hidden:            []int{64, 64},
+		LearningRate:      1e-3,
+		Gamma:             0.95,
+		BatchSize:         32,
+		BufferSize:        20000,
+		LearningStarts:    500,
+		TrainEvery:        4,
+		TargetSync:        500,
+		DoubleDQN:         true,
+		NSteps:            3,
+		EpsilonStart:      1,
+		EpsilonEnd:        0.05,
+		EpsilonDecaySteps: 20000,
+		PriorityAlpha:     0.6,
+		PriorityBeta:      0.4,
+		ShareParameters:   true,
+		Seed:              1,
+	}
+}
+
+// sharedNetworkKey is the network key when parameters are shared
+const sharedNetworkKey = "*"
+
+// dqnNetwork is one Q network with its target, optimizer and experience
+type dqnNetwork struct {
+	online *nn.MLP
+	target *nn.MLP
+	opt    *nn.Adam
+	buffer *ReplayBuffer
+}
+
+// nStepEntry is a step waiting in an agent's n-step window
+type nStepEntry struct {
+	obs    []float32
+	action int
+	reward float32
+}
+
+// DQNLearner is deep Q-learning over the grid observations
+// it has experience replay, a target network, double DQN and n-step returns
+type DQNLearner struct {
+	Config   DQNConfig
+	Networks map[string]*dqnNetwork // keyed by agent name, or sharedNetworkKey
+
+	Steps   int // environment steps seen, drives epsilon and syncing
+	Updates int
+
+	obsSize int
+	prevObs [][]float32
+	windows map[string][]nStepEntry // per agent name
+	rng     *rand.Rand
+}
+
+// NewDQNLearner creates a learner sized for env's observations
+func NewDQNLearner(env Environment, config DQNConfig) *DQNLearner {
+	if config.NSteps < 1 {
+		config.NSteps = 1
+	}
+	if config.TrainEvery < 1 {
+		config.TrainEvery = 1
+	}
+	return &DQNLearner{
+		Config:   config,
+		Networks: map[string]*dqnNetwork{},
+		obsSize:  env.ObservationSize(),
+		windows:  map[string][]nStepEntry{},
+		rng:      rand.New(rand.NewSource(config.Seed)),
+	}
+}
+
+// networkKey returns which network an agent uses
+func (l *DQNLearner) networkKey(agentName string) string {
+	if l.Config.ShareParameters {
+		return sharedNetworkKey
+	}
+	return agentName
+}
+
+// network returns an agent's network, creating it on first use
+func (l *DQNLearner) network(agentName string) *dqnNetwork {
+	key := l.networkKey(agentName)
+	if net, ok := l.Networks[key]; ok {
+		return net
+	}
+	sizes := append([]int{l.obsSize}, l.Config.Hidden...)
+	sizes = append(sizes, Act_Interact+1)
+	online := nn.NewMLP(sizes, nn.ActReLU, l.rng)
+	net := l.newNetwork(online)
+	l.Networks[key] = net
+	return net
+}
+
+func (l *DQNLearner) newNetwork(online *nn.MLP) *dqnNetwork {
+	opt := nn.NewAdam(online.Params(), l.Config.LearningRate)
+	opt.MaxGradNorm = 10
+	return &dqnNetwork{
+		online: online,
+		target: online.Clone(),
+		opt:    opt,
+		buffer: NewReplayBuffer(l.Config.BufferSize, l.Config.Prioritized, l.Config.PriorityAlpha),
+	}
+}
+
+// Epsilon returns the current exploration rate
+func (l *DQNLearner) Epsilon() float64 {
+	if l.Config.EpsilonDecaySteps <= 0 || l.Steps >= l.Config.EpsilonDecaySteps {
+		return l.Config.EpsilonEnd
+	}
+	frac := float64(l.Steps) / float64(l.Config.EpsilonDecaySteps)
+	return l.Config.EpsilonStart + frac*(l.Config.EpsilonEnd-l.Config.EpsilonStart)
+}
+
+// Act picks epsilon-greedy actions from each agent's Q network
+func (l *DQNLearner) Act(env *Environment) []int {
+	actions := make([]int, len(env.Agents))
+	l.prevObs = l.prevObs[:0]
+	epsilon := l.Epsilon()
+	for i, agent := range env.Agents {
+		obs := env.Observe(i)
+		l.prevObs = append(l.prevObs, obs)
+		if l.rng.Float64() < epsilon {
+			actions[i] = l.rng.Intn(Act_Interact + 1)
+			continue
+		}
+		q := l.network(agent.Name).online.Forward(nn.FromSlice(1, l.obsSize, obs))
+		actions[i] = argmax(q.Data)
+	}
+	return actions
+}
+
+// GreedyActions returns the highest valued action per agent without exploring or learning
+func (l *DQNLearner) GreedyActions(env *Environment) []int {
+	actions := make([]int, len(env.Agents))
+	for i, agent := range env.Agents {
+		q := l.network(agent.Name).online.Forward(nn.FromSlice(1, l.obsSize, env.Observe(i)))
+		actions[i] = argmax(q.Data)
+	}
+	return actions
+}
+
+// Learn stores each agent's experience and trains every TrainEvery steps
+func (l *DQNLearner) Learn(env *Environment, actions []int, rewards []float32, done, truncated bool) {
+	for i, agent := range env.Agents {
+		if i >= len(l.prevObs) || i >= len(rewards) {
+			continue // joined after Act, it has no previous observation
+		}
+		net := l.network(agent.Name)
+		window := append(l.windows[agent.Name], nStepEntry{obs: l.prevObs[i], action: actions[i], reward: rewards[i]})
+		nextObs := env.Observe(i)
+
+		// emit the oldest step once the window is full, and everything at the end
+		for len(window) >= l.Config.NSteps || (done && len(window) > 0) {
+			ret, discount := float32(0), float32(1)
+			for _, entry := range window {
+				ret += discount * entry.reward
+				discount *= float32(l.Config.Gamma)
+			}
+			net.buffer.Add(Transition{
+				Obs:       window[0].obs,
+				Action:    window[0].action,
+				Reward:    ret,
+				NextObs:   nextObs,
+				Done:      done,
+				Truncated: truncated,
+				Discount:  discount,
+			})
+			window = window[1:]
+		}
+		l.windows[agent.Name] = window
+	}
+	// the steps of agents that left have no next observation, drop them
+	if len(l.windows) > len(env.Agents) {
+		for name := range l.windows {
+			if env.agentIndex(name) < 0 {
+				delete(l.windows, name)
+			}
+		}
+	}
+
+	l.Steps++
+	if l.Steps%l.Config.TrainEvery == 0 {
+		for _, key := range l.networkKeys() {
+			net := l.Networks[key]
+			if net.buffer.Len() >= l.Config.LearningStarts && net.buffer.Len() >= l.Config.BatchSize {
+				l.update(net)
+			}
+		}
+	}
+	if l.Config.TargetSync > 0 && l.Steps%l.Config.TargetSync == 0 {
+		for _, net := range l.Networks {
+			net.target.CopyFrom(net.online)
+		}
+	}
+}
+
+// EndEpisode clears the n-step windows, Learn already flushed them on done
+func (l *DQNLearner) EndEpisode(episodeReturn float64) {
+	l.windows = map[string][]nStepEntry{}
+}
+
+// networkKeys lists the networks in a fixed order so seeded runs repeat
+func (l *DQNLearner) networkKeys() []string {
+	keys := make([]string, 0, len(l.Networks))
+	for key := range l.Networks {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// update does one gradient step on a sampled minibatch
+func (l *DQNLearner) update(net *dqnNetwork) {
+	beta := l.Config.PriorityBeta
+	if l.Config.EpsilonDecaySteps > 0 {
+		beta += (1 - beta) * math.Min(1, float64(l.Steps)/float64(l.Config.EpsilonDecaySteps))
+	}
+	indices, batch, weights := net.buffer.Sample(l.Config.BatchSize, beta, l.rng)
+
+	n := len(batch)
+	obs := nn.New(n, l.obsSize)
+	nextObs := nn.New(n, l.obsSize)
+	actions := make([]int, n)
+	for i, t := range batch {
+		copy(obs.Row(i), t.Obs)
+		copy(nextObs.Row(i), t.NextObs)
+		actions[i] = t.Action
+	}
+
+	// bootstrap targets, no gradient flows through them
+	targetQ := net.target.Forward(nextObs)
+	var onlineNextQ *nn.Tensor
+	if l.Config.DoubleDQN {
+		onlineNextQ = net.online.Forward(nextObs)
+	}
+	targets := nn.New(n, 1)
+	for i, t := range batch {
+		y := t.Reward
+		if !t.Done || t.Truncated {
+			var next float32
+			if l.Config.DoubleDQN {
+				next = targetQ.At(i, argmax(onlineNextQ.Row(i)))
+			} else {
+				next = targetQ.Row(i)[argmax(targetQ.Row(i))]
+			}
+			y += t.Discount * next
+		}
+		targets.Data[i] = y
+	}
+
+	net.opt.ZeroGrad()
+	q := nn.Gather(net.online.Forward(obs), actions)
+	loss := nn.Mean(nn.Mul(nn.FromSlice(n, 1, weights), nn.Huber(q, targets, 1)))
+	loss.Backward()
+	net.opt.Step()
+	l.Updates++
+
+	tdErrors := make([]float32, n)
+	for i := range tdErrors {
+		tdErrors[i] = targets.Data[i] - q.Data[i]
+	}
+	net.buffer.UpdatePriorities(indices, tdErrors)
+}
+
+// argmax returns the index of the largest value, the first on ties
+func argmax(values []float32) int {
+	best := 0
+	for i, v := range values {
+		if v > values[best] {
+			best = i
+		}
+	}
+	return best
+}
+
+// dqnCheckpoint is the on-disk form of a DQN learner
+type dqnCheckpoint struct {
+	Config   DQNConfig
+	Steps    int
+	Updates  int
+	Networks map[string][]byte // nn.MLP.Save output per network key
+}
+
+// SaveCheckpoint writes the online networks and counters to path
+// replay buffers are not saved, they refill quickly
+func (l *DQNLearner) SaveCheckpoint(path string) error {
+	checkpoint := dqnCheckpoint{Config: l.Config, Steps: l.Steps, Updates: l.Updates, Networks: map[string][]byte{}}
+	for key, net := range l.Networks {
+		var buf bytes.Buffer
+		if err := net.online.Save(&buf); err != nil {
+			return fmt.Errorf("saving network %s: %w", key, err)
+		}
+		checkpoint.Networks[key] = buf.Bytes()
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("creating checkpoint %s: %w", path, err)
+	}
+	defer f.Close()
+	if err := gob.NewEncoder(f).Encode(checkpoint); err != nil {
+		return fmt.Errorf("writing checkpoint %s: %w", path, err)
+	}
+	return f.Close()
+}
+
+// LoadCheckpoint restores networks and counters written by SaveCheckpoint
+func (l *DQNLearner) LoadCheckpoint(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("opening checkpoint %s: %w", path, err)
+	}
+	defer f.Close()
+
+	var checkpoint dqnCheckpoint
+	if err := gob.NewDecoder(f).Decode(&checkpoint); err != nil {
+		return fmt.Errorf("reading checkpoint %s: %w", path, err)
+	}
+	networks := map[string]*dqnNetwork{}
+	for key, data := range checkpoint.Networks {
+		online, err := nn.LoadMLP(bytes.NewReader(data))
+		if err != nil {
+			return fmt.Errorf("loading network %s: %w", key, err)
+		}
+		if rows := online.Layers[0].W.Rows; rows != l.obsSize {
+			return fmt.Errorf("network %s expects %d observations, this layout has %d, load it with the observation grid it was trained on", key, rows, l.obsSize)
+		}
+		networks[key] = l.newNetwork(online)
+	}
+	l.Config = checkpoint.Config
+	l.Steps = checkpoint.Steps
+	l.Updates = checkpoint.Updates
+	l.Networks = networks
+	return nil
+}
@@ -0,0 +1,70 @@
+package overcooker
+
+import (
+	"math"
+	"testing"
+)
+
+// playDQN feeds the learner one lone agent's rewards, the last step ends the episode
+func playDQN(l *DQNLearner, env *Environment, rewards []float32, truncated bool) {
+	for step, reward := range rewards {
+		actions := l.Act(env)
+		done := step == len(rewards)-1
+		l.Learn(env, actions, []float32{reward}, done, done && truncated)
+	}
+	l.EndEpisode(0)
+}
+
+// n-step returns are cut short at the end of the episode
+func TestDQNNStepReturnsTruncateAtEpisodeEnd(t *testing.T) {
+	config := DefaultDQNConfig()
+	config.NSteps = 3
+	config.Gamma = 0.5
+	config.Hidden = []int{4}
+	config.LearningStarts = 1000 // store without training
+	env := Environment{Agents: []Agent{{Name: "a1"}}, Width: 2, Height: 2, Log: NewLogger(nil, LogQuiet)}
+
+	tests := []struct {
+		name      string
+		rewards   []float32
+		truncated bool
+		want      []Transition // Reward, Discount, Done and Truncated
+	}{
+		{"longer than n", []float32{1, 2, 3, 4}, false, []Transition{
+			{Reward: 1 + 0.5*2 + 0.25*3, Discount: 0.125},
+			{Reward: 2 + 0.5*3 + 0.25*4, Discount: 0.125, Done: true},
+			{Reward: 3 + 0.5*4, Discount: 0.25, Done: true},
+			{Reward: 4, Discount: 0.5, Done: true},
+		}},
+		{"shorter than n", []float32{1, 2}, false, []Transition{
+			{Reward: 1 + 0.5*2, Discount: 0.25, Done: true},
+			{Reward: 2, Discount: 0.5, Done: true},
+		}},
+		{"cut off by the step limit", []float32{1, 2, 3}, true, []Transition{
+			{Reward: 1 + 0.5*2 + 0.25*3, Discount: 0.125, Done: true, Truncated: true},
+			{Reward: 2 + 0.5*3, Discount: 0.25, Done: true, Truncated: true},
+			{Reward: 3, Discount: 0.5, Done: true, Truncated: true},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewDQNLearner(env, config)
+			playDQN(l, &env, tt.rewards, tt.truncated)
+			// a second episode starts with an empty window, nothing leaks across
+			playDQN(l, &env, tt.rewards, tt.truncated)
+
+			buffer := l.network("a1").buffer
+			if buffer.Len() != 2*len(tt.want) {
+				t.Fatalf("stored %d transitions, want %d", buffer.Len(), 2*len(tt.want))
+			}
+			for i, got := range buffer.items {
+				want := tt.want[i%len(tt.want)]
+				if math.Abs(float64(got.Reward-want.Reward)) > 1e-6 || got.Discount != want.Discount ||
+					got.Done != want.Done || got.Truncated != want.Truncated {
+					t.Errorf("transition %d: reward %v, discount %v, done %v, truncated %v, want %v, %v, %v, %v", i,
+						got.Reward, got.Discount, got.Done, got.Truncated, want.Reward, want.Discount, want.Done, want.Truncated)
+				}
+			}
+		})
+	}
+}
@@ -1,8 +1,9 @@
 package overcooker
 
 import (
-	"fmt"
+	"io"
 	"math/rand"
+	"strings"
 )
 
 // Environment is the world where agents interact
@@ -20,6 +21,36 @@ type Environment struct {
 	EventCountsmap map[string]int
 
 	TotalReward float64
+	// InvalidActions counts blocked moves and interactions that did nothing
+	InvalidActions int
+
+	// Log receives renders and diagnostics, nil prints renders to stdout
+	Log *Logger
+	// Rewards overrides the reward values, nil uses DefaultRewardConfig
+	Rewards *RewardConfig
+	// ObsWidth and ObsHeight fix the grid observations and the global state cover, 0 uses the kitchen's size
+	// kitchens smaller than the grid are padded with empty cells and larger ones cut off,
+	// so one network fits kitchens of different sizes
+	ObsWidth, ObsHeight int
+	// Rand drives item spawning, nil uses the global source, seed it for repeatable episodes
+	Rand *rand.Rand
+
+	// rewards is reused by every Step so stepping doesn't allocate
+	rewards []float32
+
+	// spatial is the occupancy grid behind the GetXAt getters, built on first use
+	spatial *spatialIndex
+	// distances is the all-pairs table behind Distances, built on first use
+	// it only depends on the grid, so clones and copies share it
+	distances *DistanceTable
+}
+
+// logger returns the environment's logger, stdout when none was set
+func (env *Environment) logger() *Logger {
+	if env.Log == nil {
+		return stdoutLogger
+	}
+	return env.Log
 }
 
 func SimpleEnvironment() Environment {
@@ -80,10 +111,30 @@ func SimpleEnvironment() Environment {
 	return env
 }
 
+// Clone returns a deep copy of the environment
+// the copy can be stepped without touching the original, planners use it as a simulator
+func (env *Environment) Clone() Environment {
+	clone := *env
+	clone.rewards = nil
+	clone.spatial = nil
+	// Rand is shared, a *rand.Rand can't be copied
+	clone.Agents = append([]Agent(nil), env.Agents...)
+	clone.Items = append([]Item(nil), env.Items...)
+	clone.Stations = append([]Station(nil), env.Stations...)
+	if env.EventCountsmap != nil {
+		clone.EventCountsmap = make(map[string]int, len(env.EventCountsmap))
+		for k, v := range env.EventCountsmap {
+			clone.EventCountsmap[k] = v
+		}
+	}
+	return clone
+}
+
 // Item is a generic object in the environment
 type Item struct {
-	Name string
-	X, Y int
+	Name string `json:"name"`
+	X    int    `json:"x"`
+	Y    int    `json:"y"`
 }
 
 // Items
@@ -96,21 +147,45 @@ const ItemSoup = "s"
 
 // Station is a place where agents can interact with items
 type Station struct {
-	Name string
-	X, Y int
+	Name string `json:"name"`
+	X    int    `json:"x"`
+	Y    int    `json:"y"`
 }
 
 type Position struct {
 	X, Y int
 }
 
+// Move returns the position reached by taking a movement action
+// non-movement actions return the same position
+func (p Position) Move(action int) Position {
+	switch action {
+	case Act_North:
+		p.Y--
+	case Act_South:
+		p.Y++
+	case Act_East:
+		p.X++
+	case Act_West:
+		p.X--
+	}
+	return p
+}
+
 // Stations
 const StationOnion = "O"    // Station for getting onions
 const StationChop = "C"     // Station for chopping onions
 const StationStove = "S"    // Station for stove
 const StationDelivery = "D" // Station for delivery
 
+// GetAgentAt returns the agent on x, y, the first one when several share the cell
 func (env *Environment) GetAgentAt(x, y int) *Agent {
+	if cell, ok := env.cell(x, y); ok {
+		if i := env.spatialIndex().agents[cell]; i > 0 {
+			return &env.Agents[i-1]
+		}
+		return nil
+	}
 	for i := range env.Agents {
 		if env.Agents[i].X == x && env.Agents[i].Y == y {
 			return &env.Agents[i] // Returns pointer to actual agent
@@ -119,7 +194,14 @@ func (env *Environment) GetAgentAt(x, y int) *Agent {
 	return nil
 }
 
+// GetItemAt returns the item lying on x, y
 func (env *Environment) GetItemAt(x, y int) *Item {
+	if cell, ok := env.cell(x, y); ok {
+		if i := env.spatialIndex().items[cell]; i > 0 {
+			return &env.Items[i-1]
+		}
+		return nil
+	}
 	for i := range env.Items {
 		if env.Items[i].X == x && env.Items[i].Y == y {
 			return &env.Items[i]
@@ -128,7 +210,14 @@ func (env *Environment) GetItemAt(x, y int) *Item {
 	return nil
 }
 
+// GetStationAt returns the station on x, y
 func (env *Environment) GetStationAt(x, y int) *Station {
+	if cell, ok := env.cell(x, y); ok {
+		if i := env.spatialIndex().stations[cell]; i > 0 {
+			return &env.Stations[i-1]
+		}
+		return nil
+	}
 	for i := range env.Stations {
 		if env.Stations[i].X == x && env.Stations[i].Y == y {
 			return &env.Stations[i]
@@ -137,11 +226,43 @@ func (env *Environment) GetStationAt(x, y int) *Station {
 	return nil
 }
 
-// Render displays the environment in the console
+// ActionBetween returns the move that leads from prev to next
+// Act_None when next is not a neighbour of prev
+func ActionBetween(prev, next Position) int {
+	for _, action := range moveActions {
+		if prev.Move(action) == next {
+			return action
+		}
+	}
+	return Act_None
+}
+
+// InBounds reports whether x, y is a walkable cell of the kitchen
+// the grid is Width+1 by Height+1, there is no other terrain yet
+func (env *Environment) InBounds(x, y int) bool {
+	return x >= 0 && x < env.Width+1 && y >= 0 && y < env.Height+1
+}
+
+// Render displays the environment on the logger at LogInfo, the console by default
 func (env *Environment) Render() {
-	// each object may take 2 characters
+	log := env.logger()
+	if !log.Enabled(LogInfo) {
+		return
+	}
+	log.Debugf("Environment: %v", env)
+	env.RenderTo(log.Writer(LogInfo))
+}
+
+// RenderString returns the grid Render displays
+func (env *Environment) RenderString() string {
+	var sb strings.Builder
+	env.RenderTo(&sb)
+	return sb.String()
+}
 
-	fmt.Println("Environment:", env)
+// RenderTo writes the grid to w
+func (env *Environment) RenderTo(w io.Writer) {
+	// each object may take 2 characters
 	maxY := env.Height + 1
 	maxX := env.Width + 1
 	for y := 0; y < maxY; y++ {
@@ -150,23 +271,28 @@ func (env *Environment) Render() {
 			resource := env.GetItemAt(x, y)
 			station := env.GetStationAt(x, y)
 			if agent != nil {
-				fmt.Print(agent.Name)
+				io.WriteString(w, agent.Name)
 			} else if resource != nil {
-				fmt.Print(resource.Name)
+				io.WriteString(w, resource.Name)
 			} else if station != nil {
-				fmt.Print(station.Name)
+				io.WriteString(w, station.Name)
 			} else {
-				fmt.Print(". ")
+				io.WriteString(w, ". ")
 			}
 		}
-		fmt.Println()
+		io.WriteString(w, "\n")
 	}
 }
 
 // Step moves the environment forward by applying the given actions
+// Step does no I/O and doesn't allocate once warmed up: the returned rewards
+// are reused by the next Step, copy them to keep them
 func (env *Environment) Step(actions []int) (rewards []float32, done bool) {
 
-	rewards = make([]float32, len(env.Agents))
+	if cap(env.rewards) < len(env.Agents) {
+		env.rewards = make([]float32, len(env.Agents))
+	}
+	rewards = env.rewards[:len(env.Agents)]
 	// right not no done?
 	done = false
 
@@ -175,34 +301,36 @@ func (env *Environment) Step(actions []int) (rewards []float32, done bool) {
 		panic("Number of actions must match number of agents")
 	}
 
+	values := env.rewardConfig()
+
 	// Apply actions for each agent
 	for i, action := range actions {
 		agent := &env.Agents[i]
-		reward := RewardStalling
+		reward := values.Stalling
 		// default to a small negative reward w RewardStalling
 
 		// Handle movement
-		newX, newY := agent.X, agent.Y
-		switch action {
-		case Act_North:
-			newY--
-		case Act_South:
-			newY++
-		case Act_East:
-			newX++
-		case Act_West:
-			newX--
-		case Act_Interact:
-			reward = env.handleInteraction(agent)
+		newPos := Position{X: agent.X, Y: agent.Y}.Move(action)
+		newX, newY := newPos.X, newPos.Y
+		if action == Act_Interact {
+			var ok bool
+			reward, ok = env.handleInteraction(agent)
+			if !ok {
+				env.InvalidActions++
+			}
 		}
 
 		// Check if movement is valid
-		if newX >= 0 && newX < env.Width+1 &&
-			newY >= 0 && newY < env.Height+1 &&
-			env.GetAgentAt(newX, newY) == nil {
-			agent.X, agent.Y = newX, newY
-		} else {
-			reward = RewardInvalidAction
+		// only moves can be blocked, waiting and interacting keep their reward
+		if newPos != (Position{X: agent.X, Y: agent.Y}) {
+			if env.InBounds(newX, newY) &&
+				env.GetAgentAt(newX, newY) == nil {
+				env.moveAgent(i, Position{X: agent.X, Y: agent.Y}, newPos)
+				agent.X, agent.Y = newX, newY
+			} else {
+				reward = values.InvalidAction
+				env.InvalidActions++
+			}
 		}
 
 		// set rewards
@@ -220,46 +348,52 @@ func (env *Environment) CheckEventCountsmap() {
 }
 
 // handleInteraction processes an agent's attempt to interact
-func (env *Environment) handleInteraction(agent *Agent) float64 {
+// ok is false when there was nothing to do
+func (env *Environment) handleInteraction(agent *Agent) (reward float64, ok bool) {
 
 	// check env.EventCountsmap
 	env.CheckEventCountsmap()
 
 	// Check if agent is at a station
 	station := env.GetStationAt(agent.X, agent.Y)
-	reward := RewardInvalidAction
+	values := env.rewardConfig()
+	reward = values.InvalidAction
 	if station != nil {
 		switch station.Name[0:1] {
 		case StationOnion:
 			// If agent doesn't have an item, give them an onion
 			if agent.Inventory.Name == "" {
 				agent.Inventory = Item{Name: ItemOnionRaw, X: -1, Y: -1} // -1 indicates in inventory
-				reward = RewardOnionGet
+				reward = values.OnionGet
 				env.EventCountsmap["onion_get"]++
+				ok = true
 			}
 		case StationChop:
 			// If agent has an onion, chop it
 			if agent.Inventory.Name == ItemOnionRaw {
 				agent.Inventory.Name = ItemOnionChopped
-				reward = RewardOnionChop
+				reward = values.OnionChop
 				env.EventCountsmap["onion_chop"]++
+				ok = true
 			}
 		case StationStove:
 			// If agent has a chopped onion, cook it
 			if agent.Inventory.Name == ItemOnionChopped {
 				agent.Inventory.Name = ItemSoup
-				reward = RewardOnionCook
+				reward = values.OnionCook
 				env.EventCountsmap["onion_cook"]++
+				ok = true
 			}
 		case StationDelivery:
 			// If agent has a cooked soup, deliver it
 			if agent.Inventory.Name == ItemSoup {
 				agent.Inventory = Item{} // Reset inventory
-				reward = RewardDeliverSoup
+				reward = values.DeliverSoup
 				env.EventCountsmap["soup_deliver"]++
+				ok = true
 			}
 		}
-		return reward
+		return reward, ok
 	}
 
 	// Check if there's an item to pick up
@@ -270,10 +404,12 @@ func (env *Environment) handleInteraction(agent *Agent) float64 {
 		for i, it := range env.Items {
 			if it.X == item.X && it.Y == item.Y {
 				env.Items = append(env.Items[:i], env.Items[i+1:]...)
+				env.reindexItems()
 				break
 			}
 		}
-		reward = RewardPickup
+		reward = values.Pickup
+		ok = true
 	} else if item == nil && agent.Inventory.Name != "" {
 		// NOTE: Dropping items is not allowed in v1
 		// 	// Drop the item
@@ -282,7 +418,43 @@ func (env *Environment) handleInteraction(agent *Agent) float64 {
 		// 	env.Items = append(env.Items, droppedItem)
 		// 	agent.Inventory = Item{} // Reset inventory
 	}
-	return reward
+	return reward, ok
+}
+
+// ValidActions returns the actions that would do something for the agent at index agent:
+// waiting, moves into free cells and interactions with something to interact with
+// it's judged on the current state, an agent moving away in the same step can still free a cell
+func (env *Environment) ValidActions(agent int) []int {
+	a := env.Agents[agent]
+	valid := []int{Act_None}
+	for _, action := range []int{Act_North, Act_South, Act_East, Act_West} {
+		to := Position{X: a.X, Y: a.Y}.Move(action)
+		if env.InBounds(to.X, to.Y) && env.GetAgentAt(to.X, to.Y) == nil {
+			valid = append(valid, action)
+		}
+	}
+	if env.canInteract(a) {
+		valid = append(valid, Act_Interact)
+	}
+	return valid
+}
+
+// canInteract mirrors handleInteraction without changing anything
+func (env *Environment) canInteract(agent Agent) bool {
+	if station := env.GetStationAt(agent.X, agent.Y); station != nil {
+		switch station.Name[0:1] {
+		case StationOnion:
+			return agent.Inventory.Name == ""
+		case StationChop:
+			return agent.Inventory.Name == ItemOnionRaw
+		case StationStove:
+			return agent.Inventory.Name == ItemOnionChopped
+		case StationDelivery:
+			return agent.Inventory.Name == ItemSoup
+		}
+		return false
+	}
+	return agent.Inventory.Name == "" && env.GetItemAt(agent.X, agent.Y) != nil
 }
 
 func (env *Environment) EnvironmentSpawnRandomItemsForTraining() {
@@ -301,21 +473,21 @@ func (env *Environment) EnvironmentSpawnRandomItemsForTraining() {
 			rawOnionCount++
 			if rawOnionCount > rawOnionMax {
 				env.Items = append(env.Items[:i], env.Items[i+1:]...)
-				fmt.Println("deleting raw onion")
+				env.Log.Debugf("deleting raw onion")
 			}
 		}
 		if env.Items[i].Name == ItemOnionChopped {
 			choppedOnionCount++
 			if choppedOnionCount > choppedOnionMax {
 				env.Items = append(env.Items[:i], env.Items[i+1:]...)
-				fmt.Println("deleting chopped onion")
+				env.Log.Debugf("deleting chopped onion")
 			}
 		}
 		if env.Items[i].Name == ItemSoup {
 			soupCount++
 			if soupCount > soupMax {
 				env.Items = append(env.Items[:i], env.Items[i+1:]...)
-				fmt.Println("deleting soup")
+				env.Log.Debugf("deleting soup")
 			}
 		}
 	}
@@ -330,19 +502,23 @@ func (env *Environment) EnvironmentSpawnRandomItemsForTraining() {
 	}
 
 	// shuffle the listOfEmptyPositions
-	rand.Shuffle(len(listOfEmptyPositions), func(i, j int) {
+	shuffle := rand.Shuffle
+	if env.Rand != nil {
+		shuffle = env.Rand.Shuffle
+	}
+	shuffle(len(listOfEmptyPositions), func(i, j int) {
 		listOfEmptyPositions[i], listOfEmptyPositions[j] = listOfEmptyPositions[j], listOfEmptyPositions[i]
 	})
 
 	countEmptyPositions := len(listOfEmptyPositions)
-	fmt.Println("countEmptyPositions:", countEmptyPositions)
+	env.Log.Debugf("countEmptyPositions: %d", countEmptyPositions)
 	if countEmptyPositions < 3 {
-		fmt.Println("Not enough empty positions")
+		env.Log.Debugf("Not enough empty positions")
 		return
 	}
 
 	// print the first 5 positions
-	fmt.Println("listOfEmptyPositions:", listOfEmptyPositions[:5])
+	env.Log.Debugf("listOfEmptyPositions: %v", listOfEmptyPositions[:min(5, countEmptyPositions)])
 
 	// we spawn some items, not stations
 	// we want to learn to interact with things
@@ -354,10 +530,11 @@ func (env *Environment) EnvironmentSpawnRandomItemsForTraining() {
 	env.Items = append(env.Items, Item{Name: ItemSoup, X: listOfEmptyPositions[0].X, Y: listOfEmptyPositions[0].Y})
 	env.Items = append(env.Items, Item{Name: ItemOnionRaw, X: listOfEmptyPositions[1].X, Y: listOfEmptyPositions[1].Y})
 	env.Items = append(env.Items, Item{Name: ItemOnionChopped, X: listOfEmptyPositions[2].X, Y: listOfEmptyPositions[2].Y})
+	env.reindexItems()
 
 }
 
-// RewardValues defines the point values for different actions
+// RewardValues defines the default point values for different actions, see RewardConfig
 const (
 	RewardPickup        = 0.1  // Small reward for picking up items
 	RewardOnionGet      = 0.2  // Getting an onion from station
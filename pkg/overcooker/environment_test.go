@@ -0,0 +1,103 @@
+package overcooker
+
+import "testing"
+
+func quietEnvironment() Environment {
+	env := SimpleEnvironment()
+	env.Log = NewLogger(nil, LogQuiet)
+	return env
+}
+
+// Step reuses its rewards slice so training loops don't allocate per step
+func TestStepDoesNotAllocate(t *testing.T) {
+	env := quietEnvironment()
+	actions := make([]int, len(env.Agents))
+	env.Reindex()
+	env.Step(actions) // builds the rewards buffer
+
+	step := 0
+	allocs := testing.AllocsPerRun(200, func() {
+		for i := range actions {
+			actions[i] = (step + i) % (Act_Interact + 1)
+		}
+		step++
+		env.Step(actions)
+	})
+	if allocs != 0 {
+		t.Errorf("Step allocates %.1f times per call, want 0", allocs)
+	}
+}
+
+// the returned rewards are overwritten by the next Step, a Clone has its own
+func TestStepRewardsAreReused(t *testing.T) {
+	env := quietEnvironment()
+	actions := make([]int, len(env.Agents))
+	first, _ := env.Step(actions)
+	second, _ := env.Step(actions)
+	if &first[0] != &second[0] {
+		t.Errorf("Step returned a new rewards slice, want the reused one")
+	}
+
+	clone := env.Clone()
+	cloned, _ := clone.Step(actions)
+	if &cloned[0] == &second[0] {
+		t.Errorf("a clone shares the rewards slice of the environment it was cloned from")
+	}
+}
+
+func BenchmarkStep(b *testing.B) {
+	env := quietEnvironment()
+	actions := make([]int, len(env.Agents))
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		for i := range actions {
+			actions[i] = (n + i) % (Act_Interact + 1)
+		}
+		env.Step(actions)
+	}
+}
+
+// only moves can be blocked: waiting or interacting against a wall keeps its own reward
+func TestStepOnlyBlocksMoves(t *testing.T) {
+	rewards := DefaultRewardConfig()
+	rewards.Stalling = -0.01 // tell stalling apart from an invalid action
+	tests := []struct {
+		name    string
+		action  int
+		station bool
+		reward  float64
+		invalid int
+		moved   bool
+	}{
+		{"wait", Act_None, false, rewards.Stalling, 0, false},
+		{"interact at a station", Act_Interact, true, rewards.OnionGet, 0, false},
+		{"interact with nothing", Act_Interact, false, rewards.InvalidAction, 1, false},
+		{"move into the wall", Act_North, false, rewards.InvalidAction, 1, false},
+		{"move along the wall", Act_East, false, rewards.Stalling, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// a single agent in the top left corner, walls to the north and west
+			env := Environment{
+				Agents:  []Agent{{Name: "a1", X: 0, Y: 0}},
+				Width:   3,
+				Height:  3,
+				Rewards: &rewards,
+				Log:     NewLogger(nil, LogQuiet),
+			}
+			if tt.station {
+				env.Stations = []Station{{Name: StationOnion + "1", X: 0, Y: 0}}
+			}
+			got, _ := env.Step([]int{tt.action})
+			if got[0] != float32(tt.reward) {
+				t.Errorf("reward = %v, want %v", got[0], float32(tt.reward))
+			}
+			if env.InvalidActions != tt.invalid {
+				t.Errorf("InvalidActions = %d, want %d", env.InvalidActions, tt.invalid)
+			}
+			if moved := env.Agents[0].X != 0 || env.Agents[0].Y != 0; moved != tt.moved {
+				t.Errorf("agent at (%d,%d), moved = %v, want %v", env.Agents[0].X, env.Agents[0].Y, moved, tt.moved)
+			}
+		})
+	}
+}
@@ -0,0 +1,360 @@
+package overcooker
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+)
+
+// EvalModes are the ways a policy can be evaluated:
+// greedy takes each policy's best action (GetActionBest), stochastic samples it (GetActionProba)
+var EvalModes = []string{"greedy", "stochastic"}
+
+// EvalConfig says which episodes an evaluation plays and how they're summarized
+type EvalConfig struct {
+	Episodes   int      `json:"episodes"`    // per layout, seed and mode
+	Seeds      []int64  `json:"seeds"`       // episode k of seed s is seeded with EpisodeSeeds(s, k), like the command line runs
+	MaxSteps   int      `json:"max_steps"`   // steps per episode
+	SpawnEvery int      `json:"spawn_every"` // spawn random items every this many steps, 0 never
+	Modes      []string `json:"modes"`       // greedy, stochastic or both
+	Bootstrap  int      `json:"bootstrap"`   // resamples for the confidence intervals, 0 skips them
+	Confidence float64  `json:"confidence"`  // coverage of the confidence intervals
+	// Roster has agents join and leave during every episode, nil keeps the layout's team
+	Roster RosterSchedule `json:"roster,omitempty"`
+}
+
+// DefaultEvalConfig returns a greedy evaluation of 20 episodes on one seed with 95% intervals
+func DefaultEvalConfig() EvalConfig {
+	return EvalConfig{
+		Episodes:   20,
+		Seeds:      []int64{1},
+		MaxSteps:   200,
+		Modes:      []string{"greedy"},
+		Bootstrap:  1000,
+		Confidence: 0.95,
+	}
+}
+
+// ControllerFactory builds the controller of one evaluation episode for env,
+// it must draw randomness only from r so every episode can be replayed from its seed
+type ControllerFactory func(env Environment, greedy bool, r *rand.Rand) (Controller, error)
+
+// LearnerControllers plays a learner's current policy without learning, see ControllerFor
+func LearnerControllers(learner Learner) ControllerFactory {
+	return func(env Environment, greedy bool, r *rand.Rand) (Controller, error) {
+		return ControllerFor(learner, env, greedy, r)
+	}
+}
+
+// PolicyControllers returns the controllers of a policy kind: random, scripted,
+// or a learner kind restored from the checkpoint at load, see LoadLearner
+func PolicyControllers(kind, load string, env Environment, seed int64) (ControllerFactory, error) {
+	switch kind {
+	case "random":
+		return func(env Environment, greedy bool, r *rand.Rand) (Controller, error) {
+			return RandomController{Rand: r}, nil
+		}, nil
+	case "scripted":
+		return func(env Environment, greedy bool, r *rand.Rand) (Controller, error) {
+			return ScriptedController{}, nil
+		}, nil
+	}
+	learner, err := LoadLearner(kind, load, env, seed)
+	if err != nil {
+		return nil, err
+	}
+	return LearnerControllers(learner), nil
+}
+
+// Estimate is a sample mean and how far to trust it
+type Estimate struct {
+	N      int     `json:"n"`
+	Mean   float64 `json:"mean"`
+	Std    float64 `json:"std"`
+	Stderr float64 `json:"stderr"`
+	Low    float64 `json:"ci_low"` // percentile bootstrap interval of the mean
+	High   float64 `json:"ci_high"`
+	Min    float64 `json:"min"`
+	Max    float64 `json:"max"`
+}
+
+// String formats the estimate as mean ± stderr [low, high]
+func (e Estimate) String() string {
+	return fmt.Sprintf("%.3f ± %.3f [%.3f, %.3f]", e.Mean, e.Stderr, e.Low, e.High)
+}
+
+// bootstrapSeed makes the intervals of a report repeatable
+const bootstrapSeed = 1
+
+// NewEstimate summarizes values, resampling them bootstrap times for a confidence interval
+// without resamples the interval is just the mean
+func NewEstimate(values []float64, bootstrap int, confidence float64) Estimate {
+	e := Estimate{N: len(values)}
+	if len(values) == 0 {
+		return e
+	}
+	e.Mean, e.Std = meanStd(values)
+	e.Stderr = e.Std / math.Sqrt(float64(len(values)))
+	e.Min, e.Max = minFloat(values), maxFloat(values)
+	e.Low, e.High = e.Mean, e.Mean
+	if bootstrap <= 0 || len(values) < 2 {
+		return e
+	}
+
+	r := rand.New(rand.NewSource(bootstrapSeed))
+	means := make([]float64, bootstrap)
+	for b := range means {
+		total := 0.0
+		for range values {
+			total += values[r.Intn(len(values))]
+		}
+		means[b] = total / float64(len(values))
+	}
+	sort.Float64s(means)
+	alpha := (1 - confidence) / 2
+	e.Low = means[int(alpha*float64(bootstrap-1))]
+	e.High = means[int(math.Ceil((1-alpha)*float64(bootstrap-1)))]
+	return e
+}
+
+// EvalEpisode is one played episode, it's episode Episode of the run seeded with Seed,
+// so replay -seed Seed -episode Episode on its layout and mode rebuilds it
+type EvalEpisode struct {
+	Index       int            `json:"index"`
+	Layout      string         `json:"layout"`
+	Mode        string         `json:"mode"`
+	Seed        int64          `json:"seed"`
+	Episode     int            `json:"episode"`
+	Return      float64        `json:"return"`
+	Steps       int            `json:"steps"`
+	Deliveries  int            `json:"deliveries"`
+	InvalidRate float64        `json:"invalid_action_rate"`
+	Events      map[string]int `json:"events"`
+	// AgentReturns is each agent's share of the return, by name
+	AgentReturns map[string]float64 `json:"agent_returns,omitempty"`
+}
+
+// EvalSummary summarizes a group of episodes
+type EvalSummary struct {
+	Name        string              `json:"name,omitempty"` // the layout or seed of the group, empty for every episode
+	Episodes    int                 `json:"episodes"`
+	Return      Estimate            `json:"return"`
+	Deliveries  Estimate            `json:"deliveries"`
+	InvalidRate Estimate            `json:"invalid_action_rate"`
+	Events      map[string]Estimate `json:"events"`
+}
+
+// EvalResult is the evaluation of one mode, overall and broken down by layout and seed
+type EvalResult struct {
+	Mode     string        `json:"mode"`
+	Overall  EvalSummary   `json:"overall"`
+	ByLayout []EvalSummary `json:"by_layout"`
+	BySeed   []EvalSummary `json:"by_seed"`
+}
+
+// EvalReport is everything an evaluation found, ready to be saved as JSON
+type EvalReport struct {
+	Policy   string        `json:"policy"`
+	Config   EvalConfig    `json:"config"`
+	Layouts  []string      `json:"layouts"`
+	Results  []EvalResult  `json:"results"`
+	Episodes []EvalEpisode `json:"episodes"`
+}
+
+// Result returns the result of a mode, nil when it wasn't evaluated
+func (r *EvalReport) Result(mode string) *EvalResult {
+	for i := range r.Results {
+		if r.Results[i].Mode == mode {
+			return &r.Results[i]
+		}
+	}
+	return nil
+}
+
+// Evaluator plays a frozen policy over every layout, seed and mode of its config
+type Evaluator struct {
+	Config      EvalConfig
+	Layouts     []Environment // each is cloned for every episode, named after Name
+	Controllers ControllerFactory
+	Policy      string // names the policy in the report
+
+	// OnEpisodeStart, when set, sees each episode's environment before the first step,
+	// the episode has its index, layout, mode and seed filled in
+	OnEpisodeStart func(env *Environment, episode EvalEpisode)
+	// OnStep, when set, is called after every step and after items spawn, done is set on the last step
+	OnStep func(env *Environment, actions []int, rewards []float32, done bool)
+}
+
+// Run plays every episode and summarizes them
+func (e *Evaluator) Run() (*EvalReport, error) {
+	config := e.Config
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	if len(e.Layouts) == 0 {
+		return nil, fmt.Errorf("evaluation needs a layout")
+	}
+	report := &EvalReport{Policy: e.Policy, Config: config}
+	for _, layout := range e.Layouts {
+		if err := config.Roster.Check(layout); err != nil {
+			return nil, fmt.Errorf("roster: %w", err)
+		}
+		report.Layouts = append(report.Layouts, layout.Name)
+	}
+
+	for _, mode := range config.Modes {
+		for _, layout := range e.Layouts {
+			for _, seed := range config.Seeds {
+				for k := 0; k < config.Episodes; k++ {
+					episode := EvalEpisode{Index: len(report.Episodes), Layout: layout.Name, Mode: mode, Seed: seed, Episode: k}
+					if err := e.play(layout, &episode); err != nil {
+						return nil, fmt.Errorf("%s episode %d on %s, seed %d: %w", mode, k, layout.Name, seed, err)
+					}
+					report.Episodes = append(report.Episodes, episode)
+				}
+			}
+		}
+	}
+
+	for _, mode := range config.Modes {
+		result := EvalResult{Mode: mode}
+		result.Overall = config.summarize("", report.Episodes, func(ep EvalEpisode) bool { return ep.Mode == mode })
+		for _, layout := range report.Layouts {
+			result.ByLayout = append(result.ByLayout, config.summarize(layout, report.Episodes, func(ep EvalEpisode) bool {
+				return ep.Mode == mode && ep.Layout == layout
+			}))
+		}
+		for _, seed := range config.Seeds {
+			result.BySeed = append(result.BySeed, config.summarize(strconv.FormatInt(seed, 10), report.Episodes, func(ep EvalEpisode) bool {
+				return ep.Mode == mode && ep.Seed == seed
+			}))
+		}
+		report.Results = append(report.Results, result)
+	}
+	return report, nil
+}
+
+// EpisodeSeeds derives the seeds of the k-th episode of a run seeded with seed,
+// one for the environment's spawns and one for the controller
+// they're hashed so runs with nearby seeds don't share episodes and the two streams differ
+func EpisodeSeeds(seed int64, k int) (envSeed, controllerSeed int64) {
+	h := splitmix64(splitmix64(uint64(seed)) ^ uint64(k))
+	return int64(h), int64(splitmix64(h))
+}
+
+// splitmix64 scrambles x, a step of the SplitMix64 generator
+func splitmix64(x uint64) uint64 {
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
+
+// play runs one episode the way the command line plays them, so replay can rebuild it
+func (e *Evaluator) play(layout Environment, episode *EvalEpisode) error {
+	envSeed, controllerSeed := EpisodeSeeds(episode.Seed, episode.Episode)
+	env := layout.Clone()
+	env.Rand = rand.New(rand.NewSource(envSeed))
+	c, err := e.Controllers(env, episode.Mode == "greedy", rand.New(rand.NewSource(controllerSeed)))
+	if err != nil {
+		return err
+	}
+	if e.OnEpisodeStart != nil {
+		e.OnEpisodeStart(&env, *episode)
+	}
+	metrics := NewMetricsRecorder(nil)
+	metrics.StartEpisode(&env)
+	for step := 1; step <= e.Config.MaxSteps; step++ {
+		if err := e.Config.Roster.Apply(&env, step-1); err != nil {
+			return err
+		}
+		actions := c.Actions(&env)
+		if len(actions) != len(env.Agents) {
+			return fmt.Errorf("controller gave %d actions for %d agents", len(actions), len(env.Agents))
+		}
+		rewards, done := env.Step(actions)
+		if e.Config.SpawnEvery > 0 && step%e.Config.SpawnEvery == 0 {
+			env.EnvironmentSpawnRandomItemsForTraining()
+		}
+		done = done || step == e.Config.MaxSteps
+		if e.OnStep != nil {
+			e.OnStep(&env, actions, rewards, done)
+		}
+		metrics.Step(&env, actions, rewards, done)
+		if done {
+			break
+		}
+	}
+
+	m := metrics.History()[0]
+	episode.Return = m.Return
+	episode.Steps = m.Steps
+	episode.Deliveries = m.Deliveries
+	episode.InvalidRate = m.InvalidRate
+	episode.Events = m.Events
+	episode.AgentReturns = m.AgentReturns
+	return nil
+}
+
+func (c EvalConfig) validate() error {
+	if c.Episodes <= 0 || c.MaxSteps <= 0 {
+		return fmt.Errorf("evaluation needs episodes and max steps, got %d and %d", c.Episodes, c.MaxSteps)
+	}
+	if len(c.Seeds) == 0 {
+		return fmt.Errorf("evaluation needs a seed")
+	}
+	if len(c.Modes) == 0 {
+		return fmt.Errorf("evaluation needs a mode, want %v", EvalModes)
+	}
+	for _, mode := range c.Modes {
+		if mode != "greedy" && mode != "stochastic" {
+			return fmt.Errorf("unknown evaluation mode %q, want %v", mode, EvalModes)
+		}
+	}
+	if c.Confidence <= 0 || c.Confidence >= 1 {
+		return fmt.Errorf("confidence must be between 0 and 1, got %g", c.Confidence)
+	}
+	return nil
+}
+
+// summarize estimates every metric over the episodes that match
+func (c EvalConfig) summarize(name string, episodes []EvalEpisode, match func(EvalEpisode) bool) EvalSummary {
+	var returns, deliveries, invalid []float64
+	events := map[string][]float64{}
+	for _, event := range MetricEvents {
+		events[event] = nil
+	}
+	for _, ep := range episodes {
+		if !match(ep) {
+			continue
+		}
+		returns = append(returns, ep.Return)
+		deliveries = append(deliveries, float64(ep.Deliveries))
+		invalid = append(invalid, ep.InvalidRate)
+		for event := range ep.Events {
+			if _, ok := events[event]; !ok {
+				events[event] = nil
+			}
+		}
+	}
+	summary := EvalSummary{
+		Name:        name,
+		Episodes:    len(returns),
+		Return:      NewEstimate(returns, c.Bootstrap, c.Confidence),
+		Deliveries:  NewEstimate(deliveries, c.Bootstrap, c.Confidence),
+		InvalidRate: NewEstimate(invalid, c.Bootstrap, c.Confidence),
+		Events:      map[string]Estimate{},
+	}
+	for event := range events {
+		var counts []float64
+		for _, ep := range episodes {
+			if match(ep) {
+				counts = append(counts, float64(ep.Events[event]))
+			}
+		}
+		summary.Events[event] = NewEstimate(counts, c.Bootstrap, c.Confidence)
+	}
+	return summary
+}
@@ -0,0 +1,57 @@
+package overcooker
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// the bootstrap interval holds the mean and narrows as episodes are added
+func TestNewEstimateBootstrapInterval(t *testing.T) {
+	r := rand.New(rand.NewSource(4))
+	returns := make([]float64, 640)
+	for i := range returns {
+		returns[i] = 10 + 3*r.NormFloat64()
+	}
+
+	lastWidth := math.Inf(1)
+	for _, n := range []int{10, 40, 160, 640} {
+		e := NewEstimate(returns[:n], 1000, 0.95)
+		if e.N != n {
+			t.Errorf("n %d: N = %d", n, e.N)
+		}
+		if e.Low > e.Mean || e.Mean > e.High {
+			t.Errorf("n %d: the interval [%v, %v] doesn't hold the mean %v", n, e.Low, e.High, e.Mean)
+		}
+		width := e.High - e.Low
+		if width >= lastWidth {
+			t.Errorf("n %d: the interval is %v wide, with fewer episodes it was %v", n, width, lastWidth)
+		}
+		lastWidth = width
+		// a 95% interval of a mean is about 4 standard errors wide
+		if ratio := width / (2 * 1.96 * e.Stderr); ratio < 0.7 || ratio > 1.3 {
+			t.Errorf("n %d: the interval is %.2f times the normal one", n, ratio)
+		}
+
+		if again := NewEstimate(returns[:n], 1000, 0.95); again != e {
+			t.Errorf("n %d: the same values give %v, then %v", n, e, again)
+		}
+		if wider := NewEstimate(returns[:n], 1000, 0.99); wider.High-wider.Low <= width {
+			t.Errorf("n %d: the 99%% interval isn't wider than the 95%% one", n)
+		}
+	}
+}
+
+func TestNewEstimateWithoutResamples(t *testing.T) {
+	for name, e := range map[string]Estimate{
+		"no resamples": NewEstimate([]float64{1, 2, 3, 6}, 0, 0.95),
+		"one value":    NewEstimate([]float64{3}, 1000, 0.95),
+	} {
+		if e.Low != e.Mean || e.High != e.Mean {
+			t.Errorf("%s: interval [%v, %v], want just the mean %v", name, e.Low, e.High, e.Mean)
+		}
+	}
+	if e := NewEstimate(nil, 1000, 0.95); e != (Estimate{}) {
+		t.Errorf("no values: %+v, want the zero estimate", e)
+	}
+}
@@ -0,0 +1,606 @@
+package overcooker
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ExperimentConfig describes one training run: kitchen, learner, rewards and evaluation
+// an experiment file is this as JSON plus an optional "sweep" section
+type ExperimentConfig struct {
+	Name   string `json:"name"`
+	Layout string `json:"layout,omitempty"` // layout file, relative to the experiment file, empty for SimpleEnvironment
+	Agents int    `json:"agents,omitempty"` // keep only the first Agents agents of the layout, 0 keeps all
+	// observation grid, 0 uses the layout's size, see Environment.ObsWidth
+	ObsWidth  int   `json:"obs_width,omitempty"`
+	ObsHeight int   `json:"obs_height,omitempty"`
+	Seed      int64 `json:"seed"`
+
+	Episodes        int `json:"episodes"`
+	MaxEpisodeSteps int `json:"max_episode_steps"`
+	SpawnEvery      int `json:"spawn_every"` // the Trainer's item spawning curriculum
+	SpawnUntil      int `json:"spawn_until"`
+
+	Rewards RewardConfig  `json:"rewards"`
+	Learner LearnerConfig `json:"learner"`
+	Eval    EvalSchedule  `json:"eval"`
+}
+
+// EvalSchedule says when and how a run is evaluated, the last episode is always evaluated
+type EvalSchedule struct {
+	Every    int  `json:"every"`    // training episodes between evaluations, 0 only evaluates at the end
+	Episodes int  `json:"episodes"` // evaluation episodes, played without learning or spawning
+	Greedy   bool `json:"greedy"`   // take the most probable actions instead of sampling
+}
+
+// SweepConfig expands an experiment into many runs
+// keys are dotted paths into the experiment, like "learner.dqn.learning_rate" or "seed"
+type SweepConfig struct {
+	Grid    map[string][]interface{} `json:"grid"`    // every combination of these values
+	Random  map[string]ParamRange    `json:"random"`  // drawn independently for each sample
+	Samples int                      `json:"samples"` // random draws, per grid combination
+}
+
+// ParamRange is a distribution a random sweep draws a value from
+type ParamRange struct {
+	Values []interface{} `json:"values,omitempty"` // pick one of these, otherwise draw from [Min, Max]
+	Min    float64       `json:"min"`
+	Max    float64       `json:"max"`
+	Log    bool          `json:"log"` // uniform in log space, for learning rates
+	Int    bool          `json:"int"` // round to an integer
+}
+
+// ExperimentRun is one expanded configuration of an experiment
+type ExperimentRun struct {
+	Name   string                 // directory name of the run
+	Params map[string]interface{} // the sweep values that made this run
+	Config ExperimentConfig
+}
+
+// ExperimentResult is what a finished run reports
+type ExperimentResult struct {
+	Run        ExperimentRun
+	Dir        string
+	FinalEval  float64 // mean evaluation return after training
+	BestEval   float64
+	MeanReturn float64 // mean training return
+	Duration   time.Duration
+	Err        error
+}
+
+// DefaultExperimentConfig returns the values every experiment file starts from
+func DefaultExperimentConfig() ExperimentConfig {
+	return ExperimentConfig{
+		Name:            "experiment",
+		Seed:            1,
+		Episodes:        200,
+		MaxEpisodeSteps: 200,
+		SpawnEvery:      15,
+		SpawnUntil:      1000,
+		Rewards:         DefaultRewardConfig(),
+		Learner:         DefaultLearnerConfig("policymap"),
+		Eval:            EvalSchedule{Every: 50, Episodes: 10, Greedy: true},
+	}
+}
+
+// LoadExperiment reads an experiment file and expands its sweep into runs
+func LoadExperiment(path string) ([]ExperimentRun, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading experiment %s: %w", path, err)
+	}
+	runs, err := ParseExperiment(data)
+	if err != nil {
+		return nil, fmt.Errorf("experiment %s: %w", path, err)
+	}
+	for i := range runs {
+		if layout := runs[i].Config.Layout; layout != "" && !filepath.IsAbs(layout) {
+			runs[i].Config.Layout = filepath.Join(filepath.Dir(path), layout)
+		}
+	}
+	return runs, nil
+}
+
+// ParseExperiment decodes an experiment and expands its sweep, grid first, then random samples
+// without a sweep there is a single run
+func ParseExperiment(data []byte) ([]ExperimentRun, error) {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("parsing: %w", err)
+	}
+	var sweep SweepConfig
+	if section, ok := raw["sweep"]; ok {
+		if err := remarshal(section, &sweep); err != nil {
+			return nil, fmt.Errorf("parsing sweep: %w", err)
+		}
+		delete(raw, "sweep")
+	}
+	base := DefaultExperimentConfig()
+	if err := remarshal(raw, &base); err != nil {
+		return nil, fmt.Errorf("parsing: %w", err)
+	}
+
+	var runs []ExperimentRun
+	r := rand.New(rand.NewSource(base.Seed))
+	for _, point := range gridPoints(sweep.Grid) {
+		samples := []map[string]interface{}{{}}
+		if len(sweep.Random) > 0 {
+			samples = samples[:0]
+			for i := 0; i < max(1, sweep.Samples); i++ {
+				samples = append(samples, randomPoint(sweep.Random, r))
+			}
+		}
+		for _, sample := range samples {
+			params := map[string]interface{}{}
+			for k, v := range point {
+				params[k] = v
+			}
+			for k, v := range sample {
+				params[k] = v
+			}
+			config, err := applyParams(raw, params)
+			if err != nil {
+				return nil, err
+			}
+			runs = append(runs, ExperimentRun{Name: fmt.Sprintf("run-%03d", len(runs)), Params: params, Config: config})
+		}
+	}
+	return runs, nil
+}
+
+// remarshal decodes a generic JSON value into out
+func remarshal(value interface{}, out interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
+
+// gridPoints returns every combination of the grid values, the last key varying fastest
+func gridPoints(grid map[string][]interface{}) []map[string]interface{} {
+	keys := make([]string, 0, len(grid))
+	for key := range grid {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	points := []map[string]interface{}{{}}
+	for _, key := range keys {
+		var next []map[string]interface{}
+		for _, point := range points {
+			for _, value := range grid[key] {
+				extended := map[string]interface{}{key: value}
+				for k, v := range point {
+					extended[k] = v
+				}
+				next = append(next, extended)
+			}
+		}
+		points = next
+	}
+	return points
+}
+
+// randomPoint draws one value for every random parameter, in key order so seeds repeat
+func randomPoint(ranges map[string]ParamRange, r *rand.Rand) map[string]interface{} {
+	keys := make([]string, 0, len(ranges))
+	for key := range ranges {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	point := map[string]interface{}{}
+	for _, key := range keys {
+		p := ranges[key]
+		if len(p.Values) > 0 {
+			point[key] = p.Values[r.Intn(len(p.Values))]
+			continue
+		}
+		var v float64
+		if p.Log && p.Min > 0 && p.Max > 0 {
+			v = math.Exp(math.Log(p.Min) + r.Float64()*(math.Log(p.Max)-math.Log(p.Min)))
+		} else {
+			v = p.Min + r.Float64()*(p.Max-p.Min)
+		}
+		if p.Int {
+			v = math.Round(v)
+		}
+		point[key] = v
+	}
+	return point
+}
+
+// applyParams sets the sweep values on a copy of the raw experiment and decodes it
+func applyParams(raw map[string]interface{}, params map[string]interface{}) (ExperimentConfig, error) {
+	var copied map[string]interface{}
+	if err := remarshal(raw, &copied); err != nil {
+		return ExperimentConfig{}, err
+	}
+	if copied == nil {
+		copied = map[string]interface{}{}
+	}
+	for path, value := range params {
+		if err := setPath(copied, path, value); err != nil {
+			return ExperimentConfig{}, err
+		}
+	}
+
+	config := DefaultExperimentConfig()
+	if err := remarshal(copied, &config); err != nil {
+		return config, fmt.Errorf("applying %v: %w", params, err)
+	}
+	learner, err := config.Learner.Resolve()
+	if err != nil {
+		return config, err
+	}
+	config.Learner = learner
+	return config, config.validate()
+}
+
+// setPath sets a dotted path in nested JSON objects, creating objects on the way
+// keys match case-insensitively like encoding/json does, so a path can't shadow a key
+func setPath(m map[string]interface{}, path string, value interface{}) error {
+	parts := strings.Split(path, ".")
+	for i, part := range parts {
+		key := part
+		for existing := range m {
+			if strings.EqualFold(existing, part) {
+				key = existing
+				break
+			}
+		}
+		if i == len(parts)-1 {
+			m[key] = value
+			return nil
+		}
+		child, ok := m[key].(map[string]interface{})
+		if !ok {
+			if m[key] != nil {
+				return fmt.Errorf("sweep path %s: %s is not an object", path, key)
+			}
+			child = map[string]interface{}{}
+			m[key] = child
+		}
+		m = child
+	}
+	return nil
+}
+
+func (c ExperimentConfig) validate() error {
+	switch {
+	case c.Episodes < 1:
+		return fmt.Errorf("episodes must be positive")
+	case c.MaxEpisodeSteps < 1:
+		return fmt.Errorf("max_episode_steps must be positive, episodes never end otherwise")
+	case c.Agents < 0:
+		return fmt.Errorf("agents can't be negative")
+	}
+	return nil
+}
+
+// NewEnvironment builds the run's kitchen with its agents and rewards
+func (c ExperimentConfig) NewEnvironment() (Environment, error) {
+	env := SimpleEnvironment()
+	if c.Layout != "" {
+		var err error
+		if env, err = LoadLayout(c.Layout); err != nil {
+			return env, err
+		}
+	}
+	if c.Agents > 0 {
+		if c.Agents > len(env.Agents) {
+			return env, fmt.Errorf("%d agents asked for, the layout has %d", c.Agents, len(env.Agents))
+		}
+		env.Agents = env.Agents[:c.Agents]
+	}
+	rewards := c.Rewards
+	env.Rewards = &rewards
+	env.ObsWidth, env.ObsHeight = c.ObsWidth, c.ObsHeight
+	return env, nil
+}
+
+// evalSeedOffset keeps evaluation episodes apart from training episodes
+const evalSeedOffset = 1_000_000
+
+// RunExperiment trains and evaluates one run, writing into dir:
+// config.json (the resolved config), train.csv, eval.csv, summary.json and a checkpoint when the learner has one
+func RunExperiment(run ExperimentRun, dir string) ExperimentResult {
+	result := ExperimentResult{Run: run, Dir: dir}
+	start := time.Now()
+	result.Err = runExperiment(run, dir, &result)
+	result.Duration = time.Since(start)
+	return result
+}
+
+func runExperiment(run ExperimentRun, dir string, result *ExperimentResult) error {
+	config := run.Config
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("creating run directory: %w", err)
+	}
+	if err := writeJSON(filepath.Join(dir, "config.json"), config); err != nil {
+		return err
+	}
+
+	base, err := config.NewEnvironment()
+	if err != nil {
+		return err
+	}
+	learner, err := config.Learner.NewLearner(base, config.Seed)
+	if err != nil {
+		return err
+	}
+
+	episode := 0
+	trainer := NewTrainer(func() Environment {
+		env := base.Clone()
+		env.Log = NewLogger(nil, LogQuiet)
+		seed, _ := EpisodeSeeds(config.Seed, episode)
+		env.Rand = rand.New(rand.NewSource(seed))
+		episode++
+		return env
+	}, learner)
+	trainer.MaxEpisodeSteps = config.MaxEpisodeSteps
+	trainer.SpawnEvery = config.SpawnEvery
+	trainer.SpawnUntil = config.SpawnUntil
+
+	trainLog, err := CreateMetricsFile(filepath.Join(dir, "train.csv"))
+	if err != nil {
+		return err
+	}
+	metrics := NewMetricsRecorder(learner, trainLog)
+	defer metrics.Close()
+	metrics.Attach(trainer)
+	evalLog, err := newCSVFile(filepath.Join(dir, "eval.csv"), "episode", "mean", "std", "min", "max")
+	if err != nil {
+		return err
+	}
+	defer evalLog.Close()
+
+	evaluated := false
+	for trainer.Episode < config.Episodes {
+		trainer.RunEpisode()
+
+		evalDue := trainer.Episode == config.Episodes || config.Eval.Every > 0 && trainer.Episode%config.Eval.Every == 0
+		if evalDue && config.Eval.Episodes > 0 {
+			returns, err := evaluateLearner(learner, base, config)
+			if err != nil {
+				return err
+			}
+			m, s := meanStd(returns)
+			evalLog.Write(trainer.Episode, m, s, minFloat(returns), maxFloat(returns))
+			if !evaluated || m > result.BestEval {
+				result.BestEval = m
+			}
+			result.FinalEval = m
+			evaluated = true
+		}
+	}
+	result.MeanReturn, _ = meanStd(trainer.Returns)
+
+	if err := metrics.Close(); err != nil {
+		return err
+	}
+	if err := evalLog.Close(); err != nil {
+		return err
+	}
+	if checkpointer, ok := learner.(Checkpointer); ok {
+		if err := checkpointer.SaveCheckpoint(filepath.Join(dir, "checkpoint.gob")); err != nil {
+			return err
+		}
+	}
+	return writeJSON(filepath.Join(dir, "summary.json"), map[string]interface{}{
+		"params":      run.Params,
+		"final_eval":  result.FinalEval,
+		"best_eval":   result.BestEval,
+		"mean_return": result.MeanReturn,
+		"episodes":    trainer.Episode,
+		"steps":       trainer.TotalSteps,
+	})
+}
+
+// evaluateLearner plays the evaluation episodes with the learner's current policy
+func evaluateLearner(learner Learner, base Environment, config ExperimentConfig) ([]float64, error) {
+	mode := "stochastic"
+	if config.Eval.Greedy {
+		mode = "greedy"
+	}
+	layout := base.Clone()
+	layout.Log = NewLogger(nil, LogQuiet)
+	e := Evaluator{
+		Config: EvalConfig{
+			Episodes:   config.Eval.Episodes,
+			Seeds:      []int64{config.Seed + evalSeedOffset},
+			MaxSteps:   config.MaxEpisodeSteps,
+			Modes:      []string{mode},
+			Confidence: 0.95,
+		},
+		Layouts:     []Environment{layout},
+		Controllers: LearnerControllers(learner),
+	}
+	report, err := e.Run()
+	if err != nil {
+		return nil, err
+	}
+	returns := make([]float64, len(report.Episodes))
+	for i, episode := range report.Episodes {
+		returns[i] = episode.Return
+	}
+	return returns, nil
+}
+
+// RunSweep runs every run on up to workers goroutines, each in outDir/<run name>,
+// and writes outDir/sweep.csv with one line per run, results come back in run order
+func RunSweep(runs []ExperimentRun, outDir string, workers int, log *Logger) ([]ExperimentResult, error) {
+	if workers < 1 {
+		workers = 1
+	}
+	results := make([]ExperimentResult, len(runs))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = RunExperiment(runs[i], filepath.Join(outDir, runs[i].Name))
+				mu.Lock()
+				if err := results[i].Err; err != nil {
+					log.Errorf("%s failed: %v", runs[i].Name, err)
+				} else {
+					log.Infof("%s %v: final eval %.2f, best %.2f in %s", runs[i].Name, formatParams(runs[i].Params),
+						results[i].FinalEval, results[i].BestEval, results[i].Duration.Round(time.Millisecond))
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for i := range runs {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results, writeSweepSummary(filepath.Join(outDir, "sweep.csv"), results)
+}
+
+// formatParams renders sweep values as key=value pairs in key order
+func formatParams(params map[string]interface{}) string {
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	parts := make([]string, len(keys))
+	for i, key := range keys {
+		parts[i] = fmt.Sprintf("%s=%v", key, params[key])
+	}
+	return strings.Join(parts, " ")
+}
+
+func writeSweepSummary(path string, results []ExperimentResult) error {
+	f, err := newCSVFile(path, "run", "params", "final_eval", "best_eval", "mean_return", "seconds", "error")
+	if err != nil {
+		return err
+	}
+	for _, r := range results {
+		errText := ""
+		if r.Err != nil {
+			errText = r.Err.Error()
+		}
+		f.Write(r.Run.Name, formatParams(r.Run.Params), r.FinalEval, r.BestEval, r.MeanReturn, r.Duration.Seconds(), errText)
+	}
+	return f.Close()
+}
+
+func writeJSON(path string, value interface{}) error {
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding %s: %w", path, err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+	return nil
+}
+
+// csvFile is a CSV file written a row at a time
+type csvFile struct {
+	f      *os.File
+	w      *csv.Writer
+	closed bool
+}
+
+func newCSVFile(path string, header ...string) (*csvFile, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("creating %s: %w", path, err)
+	}
+	c := &csvFile{f: f, w: csv.NewWriter(f)}
+	c.w.Write(header)
+	return c, nil
+}
+
+// Write formats the values and appends them as a row, errors surface on Close
+func (c *csvFile) Write(values ...interface{}) {
+	row := make([]string, len(values))
+	for i, v := range values {
+		switch v := v.(type) {
+		case float64:
+			row[i] = strconv.FormatFloat(v, 'g', 6, 64)
+		default:
+			row[i] = fmt.Sprint(v)
+		}
+	}
+	c.w.Write(row)
+}
+
+// Flush writes the buffered rows to the file
+func (c *csvFile) Flush() error {
+	c.w.Flush()
+	if err := c.w.Error(); err != nil {
+		return fmt.Errorf("writing %s: %w", c.f.Name(), err)
+	}
+	return nil
+}
+
+// Close flushes the rows, it's safe to call twice
+func (c *csvFile) Close() error {
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	c.w.Flush()
+	if err := c.w.Error(); err != nil {
+		c.f.Close()
+		return fmt.Errorf("writing %s: %w", c.f.Name(), err)
+	}
+	return c.f.Close()
+}
+
+// meanStd returns the mean and sample standard deviation
+func meanStd(values []float64) (float64, float64) {
+	if len(values) == 0 {
+		return 0, 0
+	}
+	total := 0.0
+	for _, v := range values {
+		total += v
+	}
+	mean := total / float64(len(values))
+	if len(values) < 2 {
+		return mean, 0
+	}
+	squares := 0.0
+	for _, v := range values {
+		squares += (v - mean) * (v - mean)
+	}
+	return mean, math.Sqrt(squares / float64(len(values)-1))
+}
+
+func minFloat(values []float64) float64 {
+	lowest := math.Inf(1)
+	for _, v := range values {
+		lowest = math.Min(lowest, v)
+	}
+	return lowest
+}
+
+func maxFloat(values []float64) float64 {
+	highest := math.Inf(-1)
+	for _, v := range values {
+		highest = math.Max(highest, v)
+	}
+	return highest
+}
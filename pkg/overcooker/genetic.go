@@ -0,0 +1,255 @@
+package overcooker
+
+import (
+	"math/rand"
+	"sort"
+	"sync"
+)
+
+// GAConfig configures the genetic algorithm over policy maps
+type GAConfig struct {
+	PopulationSize int
+	Elites         int // best maps copied unchanged into the next generation
+	TournamentSize int
+
+	CrossoverRate float64 // chance a child mixes two parents, otherwise it copies one
+	MutationRate  float64 // chance each cell gets gaussian noise
+	MutationStd   float64 // std of the noise added to each probability
+
+	Episodes     int // evaluation episodes per map, fitness is the mean return
+	EpisodeSteps int
+	Workers      int // goroutines evaluating fitness in parallel
+
+	Seed int64
+}
+
+// DefaultGAConfig returns a small, quick configuration
+func DefaultGAConfig() GAConfig {
+	return GAConfig{
+		PopulationSize: 32,
+		Elites:         2,
+		TournamentSize: 3,
+		CrossoverRate:  0.7,
+		MutationRate:   0.1,
+		MutationStd:    0.1,
+		Episodes:       3,
+		EpisodeSteps:   200,
+		Workers:        4,
+		Seed:           1,
+	}
+}
+
+// minGeneProb keeps every action reachable after mutation
+const minGeneProb = 0.01
+
+// GenerationStats summarizes one generation
+type GenerationStats struct {
+	Generation  int
+	BestFitness float64
+	MeanFitness float64
+}
+
+// GeneticTrainer evolves a population of policy maps
+// the policy map is a fixed size genome for a layout: one Policy per cell
+type GeneticTrainer struct {
+	Config GAConfig
+	NewEnv func() Environment // builds a fresh environment for each evaluation episode
+
+	Population []PolicyMap
+	Fitness    []float64 // fitness of Population, filled by Evaluate
+
+	Generation  int
+	Best        PolicyMap
+	BestFitness float64
+
+	rng *rand.Rand
+}
+
+// NewGeneticTrainer creates a trainer with a population of random policy maps
+func NewGeneticTrainer(newEnv func() Environment, config GAConfig) *GeneticTrainer {
+	if config.PopulationSize < 2 {
+		config.PopulationSize = 2
+	}
+	if config.TournamentSize < 1 {
+		config.TournamentSize = 1
+	}
+	if config.Episodes < 1 {
+		config.Episodes = 1
+	}
+	if config.Workers < 1 {
+		config.Workers = 1
+	}
+	g := &GeneticTrainer{
+		Config: config,
+		NewEnv: newEnv,
+		rng:    rand.New(rand.NewSource(config.Seed)),
+	}
+
+	// start from uniform maps with a little noise so selection has something to work on
+	env := newEnv()
+	base := NewPolicyMap(env)
+	for i := 0; i < config.PopulationSize; i++ {
+		individual := base.Clone()
+		g.mutate(individual, 1.0)
+		g.Population = append(g.Population, individual)
+	}
+	return g
+}
+
+// Evaluate computes the fitness of every map in the population in parallel
+func (g *GeneticTrainer) Evaluate() {
+	g.Fitness = make([]float64, len(g.Population))
+
+	// seeds are drawn up front so results don't depend on goroutine scheduling
+	seeds := make([]int64, len(g.Population))
+	for i := range seeds {
+		seeds[i] = g.rng.Int63()
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < g.Config.Workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				g.Fitness[i] = g.fitness(g.Population[i], rand.New(rand.NewSource(seeds[i])))
+			}
+		}()
+	}
+	for i := range g.Population {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	for i, fit := range g.Fitness {
+		if g.Best == nil || fit > g.BestFitness {
+			g.Best = g.Population[i].Clone()
+			g.BestFitness = fit
+		}
+	}
+}
+
+// fitness is the mean return of the map over the evaluation episodes
+func (g *GeneticTrainer) fitness(pm PolicyMap, r *rand.Rand) float64 {
+	controller := PolicyMapController{Map: pm, Rand: r}
+	total := 0.0
+	for e := 0; e < g.Config.Episodes; e++ {
+		env := g.NewEnv()
+		total += RunEpisode(&env, controller, g.Config.EpisodeSteps)
+	}
+	return total / float64(g.Config.Episodes)
+}
+
+// Step evaluates the current population and breeds the next one
+func (g *GeneticTrainer) Step() GenerationStats {
+	g.Evaluate()
+
+	stats := GenerationStats{Generation: g.Generation, BestFitness: g.Fitness[0]}
+	for _, fit := range g.Fitness {
+		stats.MeanFitness += fit
+		if fit > stats.BestFitness {
+			stats.BestFitness = fit
+		}
+	}
+	stats.MeanFitness /= float64(len(g.Fitness))
+
+	// elitism: the best maps survive untouched
+	order := make([]int, len(g.Population))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return g.Fitness[order[a]] > g.Fitness[order[b]] })
+
+	next := make([]PolicyMap, 0, len(g.Population))
+	for i := 0; i < g.Config.Elites && i < len(order); i++ {
+		next = append(next, g.Population[order[i]].Clone())
+	}
+	for len(next) < len(g.Population) {
+		mother := g.Population[g.tournament()]
+		var child PolicyMap
+		if g.rng.Float64() < g.Config.CrossoverRate {
+			father := g.Population[g.tournament()]
+			child = g.crossover(mother, father)
+		} else {
+			child = mother.Clone()
+		}
+		g.mutate(child, g.Config.MutationRate)
+		next = append(next, child)
+	}
+
+	g.Population = next
+	g.Generation++
+	return stats
+}
+
+// Run evolves for the given number of generations
+func (g *GeneticTrainer) Run(generations int) []GenerationStats {
+	history := make([]GenerationStats, 0, generations)
+	for i := 0; i < generations; i++ {
+		history = append(history, g.Step())
+	}
+	return history
+}
+
+// tournament returns the index of the fittest of a few random individuals
+func (g *GeneticTrainer) tournament() int {
+	best := g.rng.Intn(len(g.Population))
+	for i := 1; i < g.Config.TournamentSize; i++ {
+		candidate := g.rng.Intn(len(g.Population))
+		if g.Fitness[candidate] > g.Fitness[best] {
+			best = candidate
+		}
+	}
+	return best
+}
+
+// crossover takes each cell's policy from either parent
+func (g *GeneticTrainer) crossover(mother, father PolicyMap) PolicyMap {
+	child := make(PolicyMap, len(mother))
+	for _, pos := range sortedPositions(mother) {
+		if g.rng.Intn(2) == 0 {
+			child[pos] = mother[pos].Clone()
+		} else if policy, ok := father[pos]; ok {
+			child[pos] = policy.Clone()
+		} else {
+			child[pos] = mother[pos].Clone()
+		}
+	}
+	return child
+}
+
+// mutate adds gaussian noise to a fraction of the cells and renormalizes them
+func (g *GeneticTrainer) mutate(pm PolicyMap, rate float64) {
+	for _, pos := range sortedPositions(pm) {
+		if g.rng.Float64() >= rate {
+			continue
+		}
+		policy := pm[pos]
+		for a := Act_None; a <= Act_Interact; a++ {
+			prob := policy[a] + float32(g.rng.NormFloat64()*g.Config.MutationStd)
+			if prob < minGeneProb {
+				prob = minGeneProb
+			}
+			policy[a] = prob
+		}
+		policy.Normalize()
+	}
+}
+
+// sortedPositions lists the cells of a map row by row
+// map iteration order is random, walking cells in order keeps seeded runs repeatable
+func sortedPositions(pm PolicyMap) []Position {
+	positions := make([]Position, 0, len(pm))
+	for pos := range pm {
+		positions = append(positions, pos)
+	}
+	sort.Slice(positions, func(i, j int) bool {
+		if positions[i].Y != positions[j].Y {
+			return positions[i].Y < positions[j].Y
+		}
+		return positions[i].X < positions[j].X
+	})
+	return positions
+}
@@ -0,0 +1,82 @@
+package overcooker
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func testGAConfig() GAConfig {
+	config := DefaultGAConfig()
+	config.PopulationSize = 8
+	config.Episodes = 1
+	config.EpisodeSteps = 20
+	config.Seed = 7
+	return config
+}
+
+// the same seed breeds the same generations, however the workers are scheduled
+func TestGeneticTrainerIsReproducible(t *testing.T) {
+	a := NewGeneticTrainer(quietEnvironment, testGAConfig())
+	b := NewGeneticTrainer(quietEnvironment, testGAConfig())
+	if !reflect.DeepEqual(a.Population, b.Population) {
+		t.Fatalf("the initial populations differ")
+	}
+	for generation := 0; generation < 3; generation++ {
+		statsA, statsB := a.Step(), b.Step()
+		if statsA != statsB {
+			t.Fatalf("generation %d: stats %+v and %+v differ", generation, statsA, statsB)
+		}
+		if !reflect.DeepEqual(a.Fitness, b.Fitness) {
+			t.Fatalf("generation %d: fitness %v and %v differ", generation, a.Fitness, b.Fitness)
+		}
+		if !reflect.DeepEqual(a.Population, b.Population) {
+			t.Fatalf("generation %d: the bred populations differ", generation)
+		}
+	}
+}
+
+// the fittest maps are copied unchanged to the front of the next generation
+func TestGeneticTrainerKeepsElites(t *testing.T) {
+	config := testGAConfig()
+	g := NewGeneticTrainer(quietEnvironment, config)
+	previous := g.Population
+	stats := g.Step()
+
+	order := make([]int, len(g.Fitness))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return g.Fitness[order[a]] > g.Fitness[order[b]] })
+	if stats.BestFitness != g.Fitness[order[0]] {
+		t.Errorf("BestFitness = %v, want %v", stats.BestFitness, g.Fitness[order[0]])
+	}
+	for i := 0; i < config.Elites; i++ {
+		if !reflect.DeepEqual(g.Population[i], previous[order[i]]) {
+			t.Errorf("map %d of the next generation isn't the elite ranked %d", i, i)
+		}
+	}
+	if len(g.Population) != len(previous) {
+		t.Errorf("population went from %d to %d maps", len(previous), len(g.Population))
+	}
+	for i, pm := range g.Population {
+		checkPolicyMapNormalized(t, pm, "next generation map", i)
+	}
+}
+
+// checkPolicyMapNormalized verifies every cell of pm is a probability distribution
+func checkPolicyMapNormalized(t *testing.T, pm PolicyMap, what string, index int) {
+	t.Helper()
+	for pos, policy := range pm {
+		total := float32(0)
+		for a := Act_None; a <= Act_Interact; a++ {
+			if policy[a] < 0 {
+				t.Fatalf("%s %d: %v has a negative probability %v for action %d", what, index, pos, policy[a], a)
+			}
+			total += policy[a]
+		}
+		if total < 0.999 || total > 1.001 {
+			t.Fatalf("%s %d: %v sums to %v, want 1", what, index, pos, total)
+		}
+	}
+}
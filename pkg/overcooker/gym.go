@@ -0,0 +1,261 @@
+package overcooker
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+)
+
+// GymProtocol names the line-delimited JSON protocol GymEnv speaks
+const GymProtocol = "overcooker-gym"
+
+// GymProtocolVersion is bumped when requests or responses change incompatibly
+const GymProtocolVersion = 1
+
+// GymCommands are the commands a client can send
+var GymCommands = []string{"spec", "reset", "step", "observe", "valid_actions", "render", "close"}
+
+// GymRequest is one line a client sends
+type GymRequest struct {
+	ID      json.RawMessage `json:"id,omitempty"`      // anything, echoed in the response
+	Version int             `json:"version,omitempty"` // protocol version the client speaks, 0 for the current one
+	Cmd     string          `json:"cmd"`
+	Seed    *int64          `json:"seed,omitempty"`    // reset: seeds the episode, without it the next seed is used
+	Actions []int           `json:"actions,omitempty"` // step: one action per agent, in agent order
+}
+
+// GymSpec describes the environment the way gym spaces do
+type GymSpec struct {
+	Protocol         string   `json:"protocol"`
+	Version          int      `json:"version"`
+	Name             string   `json:"name"`
+	Agents           []string `json:"agents"`
+	NumActions       int      `json:"num_actions"`
+	ActionNames      []string `json:"action_names"`
+	ObservationSize  int      `json:"observation_size"`
+	ObservationShape []int    `json:"observation_shape"` // rows, columns, channels of the grid part, the held item one-hot follows
+	MaxSteps         int      `json:"max_steps"`         // episodes are truncated after this many steps, 0 never
+}
+
+// GymInfo is the extra information of reset and step
+type GymInfo struct {
+	Seed        int64          `json:"seed"`
+	Step        int            `json:"step"`
+	TotalReward float64        `json:"total_reward"`
+	Events      map[string]int `json:"events,omitempty"` // events of this step
+	Agents      []AgentState   `json:"agents"`
+}
+
+// GymResponse answers one request, only the fields of its command are set
+type GymResponse struct {
+	ID      json.RawMessage `json:"id,omitempty"`
+	Version int             `json:"version"`
+	Cmd     string          `json:"cmd"`
+	OK      bool            `json:"ok"`
+	Error   string          `json:"error,omitempty"`
+
+	Spec         *GymSpec    `json:"spec,omitempty"`
+	Observations [][]float32 `json:"observations,omitempty"` // one per agent
+	Rewards      []float32   `json:"rewards,omitempty"`
+	Terminated   bool        `json:"terminated,omitempty"`
+	Truncated    bool        `json:"truncated,omitempty"`
+	ValidActions [][]int     `json:"valid_actions,omitempty"`
+	Render       string      `json:"render,omitempty"`
+	Info         *GymInfo    `json:"info,omitempty"`
+}
+
+// GymEnv runs episodes of a layout for a client, one request at a time
+// it isn't safe for concurrent use, servers keep one per session
+type GymEnv struct {
+	Base       Environment // cloned for every episode
+	MaxSteps   int         // truncates episodes, 0 never
+	SpawnEvery int         // spawn random items every this many steps, 0 never
+
+	Env     Environment
+	seed    int64
+	steps   int
+	started bool
+	over    bool
+	closed  bool
+	events  map[string]int
+}
+
+// NewGymEnv creates an environment whose first reset without a seed uses seed
+func NewGymEnv(base Environment, maxSteps, spawnEvery int, seed int64) *GymEnv {
+	return &GymEnv{Base: base, MaxSteps: maxSteps, SpawnEvery: spawnEvery, seed: seed - 1}
+}
+
+// Closed reports whether the client sent close
+func (g *GymEnv) Closed() bool {
+	return g.closed
+}
+
+// Spec describes the environment
+func (g *GymEnv) Spec() GymSpec {
+	env := &g.Base
+	if g.started {
+		env = &g.Env
+	}
+	spec := GymSpec{
+		Protocol:         GymProtocol,
+		Version:          GymProtocolVersion,
+		Name:             env.Name,
+		NumActions:       len(ActionNames),
+		ActionNames:      ActionNames,
+		ObservationSize:  env.ObservationSize(),
+		ObservationShape: []int{env.Height + 1, env.Width + 1, ObsChannels},
+		MaxSteps:         g.MaxSteps,
+	}
+	for _, agent := range env.Agents {
+		spec.Agents = append(spec.Agents, agent.Name)
+	}
+	return spec
+}
+
+// Handle answers one request, errors are reported in the response
+func (g *GymEnv) Handle(req GymRequest) GymResponse {
+	resp := GymResponse{ID: req.ID, Version: GymProtocolVersion, Cmd: req.Cmd}
+	if err := g.handle(req, &resp); err != nil {
+		resp.Error = err.Error()
+		return resp
+	}
+	resp.OK = true
+	return resp
+}
+
+func (g *GymEnv) handle(req GymRequest, resp *GymResponse) error {
+	if req.Version > GymProtocolVersion {
+		return fmt.Errorf("protocol version %d is newer than %d", req.Version, GymProtocolVersion)
+	}
+	if g.closed {
+		return fmt.Errorf("the environment is closed")
+	}
+	switch req.Cmd {
+	case "spec":
+		spec := g.Spec()
+		resp.Spec = &spec
+		return nil
+	case "reset":
+		g.reset(req.Seed)
+		resp.Observations = g.observations()
+		resp.Info = g.info()
+		return nil
+	case "close":
+		g.closed = true
+		return nil
+	case "step", "observe", "valid_actions", "render":
+	default:
+		return fmt.Errorf("unknown command %q, want one of %v", req.Cmd, GymCommands)
+	}
+
+	if !g.started {
+		return fmt.Errorf("%s before the first reset", req.Cmd)
+	}
+	switch req.Cmd {
+	case "step":
+		return g.step(req.Actions, resp)
+	case "observe":
+		resp.Observations = g.observations()
+	case "valid_actions":
+		for i := range g.Env.Agents {
+			resp.ValidActions = append(resp.ValidActions, g.Env.ValidActions(i))
+		}
+	case "render":
+		resp.Render = g.Env.RenderString()
+	}
+	return nil
+}
+
+func (g *GymEnv) reset(seed *int64) {
+	if seed != nil {
+		g.seed = *seed
+	} else {
+		g.seed++
+	}
+	g.Env = g.Base.Clone()
+	g.Env.Rand = rand.New(rand.NewSource(g.seed))
+	g.steps = 0
+	g.started = true
+	g.over = false
+	g.events = copyCounts(g.Env.EventCountsmap)
+}
+
+func (g *GymEnv) step(actions []int, resp *GymResponse) error {
+	if g.over {
+		return fmt.Errorf("the episode is over, reset first")
+	}
+	if len(actions) != len(g.Env.Agents) {
+		return fmt.Errorf("got %d actions for %d agents", len(actions), len(g.Env.Agents))
+	}
+	for i, action := range actions {
+		if action < 0 || action >= len(ActionNames) {
+			return fmt.Errorf("action %d of agent %s is out of range", action, g.Env.Agents[i].Name)
+		}
+	}
+
+	rewards, done := g.Env.Step(actions)
+	g.steps++
+	if g.SpawnEvery > 0 && g.steps%g.SpawnEvery == 0 {
+		g.Env.EnvironmentSpawnRandomItemsForTraining()
+	}
+	resp.Rewards = append([]float32(nil), rewards...)
+	resp.Terminated = done
+	resp.Truncated = !done && g.MaxSteps > 0 && g.steps >= g.MaxSteps
+	g.over = resp.Terminated || resp.Truncated
+	resp.Observations = g.observations()
+	resp.Info = g.info()
+	return nil
+}
+
+func (g *GymEnv) observations() [][]float32 {
+	obs := make([][]float32, len(g.Env.Agents))
+	for i := range obs {
+		obs[i] = g.Env.Observe(i)
+	}
+	return obs
+}
+
+// info reports the step and the events since the last info
+func (g *GymEnv) info() *GymInfo {
+	info := &GymInfo{Seed: g.seed, Step: g.steps, TotalReward: g.Env.TotalReward, Agents: agentStates(&g.Env, true)}
+	for event, count := range g.Env.EventCountsmap {
+		if n := count - g.events[event]; n != 0 {
+			if info.Events == nil {
+				info.Events = map[string]int{}
+			}
+			info.Events[event] = n
+			g.events[event] = count
+		}
+	}
+	return info
+}
+
+// Serve answers requests, one JSON object per line, until the client closes or r ends
+// lines that aren't valid requests get an error response and serving goes on
+func (g *GymEnv) Serve(r io.Reader, w io.Writer) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	enc := json.NewEncoder(w)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var resp GymResponse
+		var req GymRequest
+		if err := json.Unmarshal(line, &req); err != nil {
+			resp = GymResponse{Version: GymProtocolVersion, Error: fmt.Sprintf("bad request: %v", err)}
+		} else {
+			resp = g.Handle(req)
+		}
+		if err := enc.Encode(resp); err != nil {
+			return fmt.Errorf("writing response: %w", err)
+		}
+		if g.closed {
+			return nil
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,126 @@
+package overcooker
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ParseLayout reads a kitchen drawn the way Render draws it, two characters per cell
+//
+//	. . . . . . . . . .
+//	. a1. . O1. . . . C1
+//	. . . . o2. . . . .
+//	. a2o1. . . . . . .
+//	. . . . . D1. . . S1
+//
+// ". " is an empty cell, lowercase a starts an agent, o, p and s are items,
+// O, C, S and D are stations, lines starting with # are comments
+func ParseLayout(r io.Reader) (Environment, error) {
+	env := Environment{Name: "layout"}
+	seen := map[string]bool{}
+	width, y := 0, 0
+
+	scanner := bufio.NewScanner(r)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		if line == "" {
+			if y == 0 {
+				continue // leading blank lines
+			}
+			break
+		}
+		if len(line)%2 == 1 {
+			line += " "
+		}
+
+		for x := 0; x < len(line)/2; x++ {
+			token := strings.TrimSpace(line[2*x : 2*x+2])
+			if token == "" || token == "." {
+				continue
+			}
+			if seen[token] && token[0] == 'a' {
+				return env, fmt.Errorf("line %d: agent %s appears twice", lineNo, token)
+			}
+			seen[token] = true
+
+			switch token[0:1] {
+			case "a":
+				env.Agents = append(env.Agents, Agent{Name: token, X: x, Y: y})
+			case ItemOnionRaw, ItemOnionChopped, ItemSoup:
+				env.Items = append(env.Items, Item{Name: token, X: x, Y: y})
+			case StationOnion, StationChop, StationStove, StationDelivery:
+				env.Stations = append(env.Stations, Station{Name: token, X: x, Y: y})
+			default:
+				return env, fmt.Errorf("line %d, column %d: unknown cell %q", lineNo, 2*x+1, token)
+			}
+		}
+		width = max(width, len(line)/2)
+		y++
+	}
+	if err := scanner.Err(); err != nil {
+		return env, fmt.Errorf("reading layout: %w", err)
+	}
+	if y == 0 {
+		return env, fmt.Errorf("layout has no rows")
+	}
+	if len(env.Agents) == 0 {
+		return env, fmt.Errorf("layout has no agents")
+	}
+
+	// Width and Height are the last column and row, like SimpleEnvironment
+	env.Width = width - 1
+	env.Height = y - 1
+	return env, nil
+}
+
+// LoadLayout reads a layout file, the environment is named after the file
+func LoadLayout(path string) (Environment, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Environment{}, fmt.Errorf("opening layout %s: %w", path, err)
+	}
+	defer f.Close()
+
+	env, err := ParseLayout(f)
+	if err != nil {
+		return env, fmt.Errorf("layout %s: %w", path, err)
+	}
+	env.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	return env, nil
+}
+
+// RenderLoss lists what RenderString can't draw, so its output won't load back as the same kitchen:
+// entities sharing a cell, where only the top one is drawn, and names that aren't two characters wide
+func (env *Environment) RenderLoss() []string {
+	var loss []string
+	drawn := map[Position]string{}
+	draw := func(name string, x, y int) {
+		if len(name) != 2 {
+			loss = append(loss, fmt.Sprintf("%q at (%d,%d) isn't two characters wide", name, x, y))
+		}
+		pos := Position{X: x, Y: y}
+		if top, ok := drawn[pos]; ok {
+			loss = append(loss, fmt.Sprintf("%s at (%d,%d) is hidden under %s", name, x, y, top))
+			return
+		}
+		drawn[pos] = name
+	}
+	// in the order RenderTo draws them: agents over items over stations
+	for _, agent := range env.Agents {
+		draw(agent.Name, agent.X, agent.Y)
+	}
+	for _, item := range env.Items {
+		draw(item.Name, item.X, item.Y)
+	}
+	for _, station := range env.Stations {
+		draw(station.Name, station.X, station.Y)
+	}
+	return loss
+}
@@ -0,0 +1,82 @@
+package overcooker
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// a kitchen that RenderString draws without losing anything loads back the same
+func TestRenderStringLoadsBack(t *testing.T) {
+	env := quietEnvironment()
+	// unstack the agents SimpleEnvironment starts on one cell
+	for i := range env.Agents[2:] {
+		env.Agents[2+i].X, env.Agents[2+i].Y = 6+i, 3
+	}
+	env.Reindex()
+	if loss := env.RenderLoss(); loss != nil {
+		t.Fatalf("RenderLoss = %v, want nothing lost", loss)
+	}
+
+	loaded, err := ParseLayout(strings.NewReader(env.RenderString()))
+	if err != nil {
+		t.Fatalf("parsing the render: %v", err)
+	}
+	if loaded.Width != env.Width || loaded.Height != env.Height {
+		t.Errorf("loaded a %dx%d kitchen, want %dx%d", loaded.Width, loaded.Height, env.Width, env.Height)
+	}
+	// the render of what was loaded is the same drawing
+	if got, want := loaded.RenderString(), env.RenderString(); got != want {
+		t.Errorf("render of the loaded kitchen:\n%s\nwant:\n%s", got, want)
+	}
+
+	// ParseLayout reads row by row, so compare by name
+	sortByName(loaded.Agents, func(a Agent) string { return a.Name })
+	sortByName(loaded.Items, func(i Item) string { return i.Name })
+	sortByName(loaded.Stations, func(s Station) string { return s.Name })
+	env.Stations = append([]Station(nil), env.Stations...)
+	sortByName(env.Stations, func(s Station) string { return s.Name })
+	if !reflect.DeepEqual(loaded.Agents, env.Agents) {
+		t.Errorf("agents = %v, want %v", loaded.Agents, env.Agents)
+	}
+	if !reflect.DeepEqual(loaded.Items, env.Items) {
+		t.Errorf("items = %v, want %v", loaded.Items, env.Items)
+	}
+	if !reflect.DeepEqual(loaded.Stations, env.Stations) {
+		t.Errorf("stations = %v, want %v", loaded.Stations, env.Stations)
+	}
+}
+
+func sortByName[T any](s []T, name func(T) string) {
+	sort.Slice(s, func(i, j int) bool { return name(s[i]) < name(s[j]) })
+}
+
+// stacked agents and short names can't be drawn, RenderLoss says so
+func TestRenderLoss(t *testing.T) {
+	env := quietEnvironment()
+	if loss := env.RenderLoss(); len(loss) != 3 {
+		t.Errorf("RenderLoss of the simple kitchen = %v, want its three agents stacked under a2", loss)
+	}
+	loaded, err := ParseLayout(strings.NewReader(env.RenderString()))
+	if err != nil {
+		t.Fatalf("parsing the render: %v", err)
+	}
+	if len(loaded.Agents) != 2 {
+		t.Errorf("loaded %d agents, want the 2 that were drawn", len(loaded.Agents))
+	}
+
+	env = Environment{
+		Agents:   []Agent{{Name: "a1", X: 0, Y: 0}},
+		Items:    []Item{{Name: ItemSoup, X: 1, Y: 0}, {Name: "o1", X: 2, Y: 0}},
+		Stations: []Station{{Name: "D1", X: 2, Y: 0}},
+		Width:    2,
+	}
+	want := []string{
+		`"s" at (1,0) isn't two characters wide`,
+		"D1 at (2,0) is hidden under o1",
+	}
+	if loss := env.RenderLoss(); !reflect.DeepEqual(loss, want) {
+		t.Errorf("RenderLoss = %q, want %q", loss, want)
+	}
+}
@@ -0,0 +1,222 @@
+package overcooker
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// LearnerKinds lists the learners NewLearner can build
+// MAPPO isn't one, it collects its own rollouts rather than learning in the Trainer, see NewMAPPO and the mappo command
+var LearnerKinds = []string{"policymap", "cem", "reinforce", "traces", "dqn"}
+
+// PolicyMapConfig configures the policy map learner
+type PolicyMapConfig struct {
+	LearningRate float32           `json:"learning_rate"`
+	Sharing      string            `json:"sharing"` // shared, per_agent or grouped
+	Roles        map[string]string `json:"roles,omitempty"`
+}
+
+// DefaultPolicyMapConfig returns the settings NewPolicyMapLearner uses
+func DefaultPolicyMapConfig() PolicyMapConfig {
+	return PolicyMapConfig{LearningRate: DefaultPolicyLearningRate, Sharing: "shared"}
+}
+
+// LearnerConfig picks a learner and holds its hyperparameters
+// only the section of the chosen kind is used, Resolve drops the others
+type LearnerConfig struct {
+	Kind      string           `json:"kind"`
+	PolicyMap *PolicyMapConfig `json:"policymap,omitempty"`
+	CEM       *CEMConfig       `json:"cem,omitempty"`
+	Reinforce *ReinforceConfig `json:"reinforce,omitempty"`
+	Traces    *TraceConfig     `json:"traces,omitempty"`
+	DQN       *DQNConfig       `json:"dqn,omitempty"`
+}
+
+// DefaultLearnerConfig returns a config of the given kind with every section at its defaults,
+// decoding JSON over it keeps the defaults for anything the JSON leaves out
+func DefaultLearnerConfig(kind string) LearnerConfig {
+	policyMap := DefaultPolicyMapConfig()
+	cem := DefaultCEMConfig()
+	reinforce := DefaultReinforceConfig()
+	traces := DefaultTraceConfig()
+	dqn := DefaultDQNConfig()
+	return LearnerConfig{
+		Kind:      kind,
+		PolicyMap: &policyMap,
+		CEM:       &cem,
+		Reinforce: &reinforce,
+		Traces:    &traces,
+		DQN:       &dqn,
+	}
+}
+
+// Resolve keeps only the section of the chosen kind, filled with defaults if missing
+func (c LearnerConfig) Resolve() (LearnerConfig, error) {
+	defaults := DefaultLearnerConfig(c.Kind)
+	resolved := LearnerConfig{Kind: c.Kind}
+	switch c.Kind {
+	case "policymap":
+		resolved.PolicyMap = firstNonNil(c.PolicyMap, defaults.PolicyMap)
+	case "cem":
+		resolved.CEM = firstNonNil(c.CEM, defaults.CEM)
+	case "reinforce":
+		resolved.Reinforce = firstNonNil(c.Reinforce, defaults.Reinforce)
+	case "traces":
+		resolved.Traces = firstNonNil(c.Traces, defaults.Traces)
+	case "dqn":
+		resolved.DQN = firstNonNil(c.DQN, defaults.DQN)
+	default:
+		return resolved, fmt.Errorf("unknown learner %q, want one of %v", c.Kind, LearnerKinds)
+	}
+	return resolved, nil
+}
+
+func firstNonNil[T any](values ...*T) *T {
+	for _, v := range values {
+		if v != nil {
+			return v
+		}
+	}
+	return nil
+}
+
+// NewLearner builds the configured learner sized for env, seed replaces the config's own seed
+func (c LearnerConfig) NewLearner(env Environment, seed int64) (Learner, error) {
+	c, err := c.Resolve()
+	if err != nil {
+		return nil, err
+	}
+	switch c.Kind {
+	case "policymap":
+		sharing, err := parseMapSharing(c.PolicyMap.Sharing)
+		if err != nil {
+			return nil, err
+		}
+		l := NewPolicyMapLearnerSharing(env, sharing, c.PolicyMap.Roles)
+		l.LearningRate = c.PolicyMap.LearningRate
+		l.Rand = rand.New(rand.NewSource(seed))
+		return l, nil
+	case "cem":
+		config := *c.CEM
+		config.Seed = seed
+		return NewCEMLearner(env, config), nil
+	case "reinforce":
+		config := *c.Reinforce
+		config.Seed = seed
+		return NewReinforceLearner(env, config), nil
+	case "traces":
+		config := *c.Traces
+		config.Seed = seed
+		return NewTraceLearner(config), nil
+	default: // dqn, Resolve rejected anything else
+		config := *c.DQN
+		config.Seed = seed
+		return NewDQNLearner(env, config), nil
+	}
+}
+
+// LoadLearner builds a learner of kind with default settings sized for env,
+// restoring the checkpoint at load when it's set, without it the learner is untrained
+func LoadLearner(kind, load string, env Environment, seed int64) (Learner, error) {
+	learner, err := DefaultLearnerConfig(kind).NewLearner(env, seed)
+	if err != nil {
+		return nil, err
+	}
+	if load != "" {
+		checkpointer, ok := learner.(Checkpointer)
+		if !ok {
+			return nil, fmt.Errorf("the %s learner has no checkpoints", kind)
+		}
+		if err := checkpointer.LoadCheckpoint(load); err != nil {
+			return nil, err
+		}
+	}
+	return learner, nil
+}
+
+func parseMapSharing(name string) (MapSharing, error) {
+	switch name {
+	case "", "shared":
+		return SharedMap, nil
+	case "per_agent":
+		return PerAgentMaps, nil
+	case "grouped":
+		return GroupedMaps, nil
+	}
+	return SharedMap, fmt.Errorf("unknown map sharing %q, want shared, per_agent or grouped", name)
+}
+
+// ControllerFor returns a controller that plays a learner's current policy without learning
+// policy map learners sample from r unless greedy, value learners explore with r at their
+// final epsilon unless greedy
+func ControllerFor(learner Learner, env Environment, greedy bool, r *rand.Rand) (Controller, error) {
+	switch l := learner.(type) {
+	case *PolicyMapLearner:
+		maps := map[string]PolicyMap{}
+		for _, agent := range env.Agents {
+			maps[agent.Name] = l.MapFor(agent.Name)
+		}
+		return AgentMapsController{Maps: maps, Fallback: l.Map, Greedy: greedy, Rand: r}, nil
+	case *CEMLearner:
+		return PolicyMapController{Map: l.Mean, Greedy: greedy, Rand: r}, nil
+	case *ReinforceLearner:
+		return PolicyMapController{Map: l.PolicyMap(), Greedy: greedy, Rand: r}, nil
+	case *TraceLearner:
+		return traceController{learner: l, greedy: greedy, rand: r}, nil
+	case *DQNLearner:
+		if size := env.ObservationSize(); size != l.obsSize {
+			return nil, fmt.Errorf("the DQN learner sees %d observation values, %s has %d, train and play on the same observation grid", l.obsSize, env.Name, size)
+		}
+		return dqnController{learner: l, greedy: greedy, rand: r}, nil
+	}
+	return nil, fmt.Errorf("no controller for %T", learner)
+}
+
+// traceController takes the trace learner's greedy actions, epsilon-greedy ones unless greedy
+type traceController struct {
+	learner *TraceLearner
+	greedy  bool
+	rand    *rand.Rand
+}
+
+func (c traceController) Actions(env *Environment) []int {
+	actions := make([]int, len(env.Agents))
+	for i, agent := range env.Agents {
+		actions[i] = c.learner.GreedyAction(agentState(agent))
+		if !c.greedy {
+			actions[i] = epsilonGreedy(actions[i], c.learner.Config.Epsilon, c.rand)
+		}
+	}
+	return actions
+}
+
+// dqnController takes the DQN learner's greedy actions, epsilon-greedy ones at EpsilonEnd unless greedy
+type dqnController struct {
+	learner *DQNLearner
+	greedy  bool
+	rand    *rand.Rand
+}
+
+func (c dqnController) Actions(env *Environment) []int {
+	actions := c.learner.GreedyActions(env)
+	if !c.greedy {
+		for i := range actions {
+			actions[i] = epsilonGreedy(actions[i], c.learner.Config.EpsilonEnd, c.rand)
+		}
+	}
+	return actions
+}
+
+// epsilonGreedy swaps action for a random one with probability epsilon, r nil uses the global source
+func epsilonGreedy(action int, epsilon float64, r *rand.Rand) int {
+	if r == nil {
+		if rand.Float64() < epsilon {
+			return rand.Intn(Act_Interact + 1)
+		}
+		return action
+	}
+	if r.Float64() < epsilon {
+		return r.Intn(Act_Interact + 1)
+	}
+	return action
+}
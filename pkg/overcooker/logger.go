@@ -0,0 +1,63 @@
+package overcooker
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// LogLevel orders how chatty diagnostics are
+type LogLevel int
+
+const (
+	LogQuiet LogLevel = iota // nothing
+	LogError                 // things that went wrong
+	LogInfo                  // renders and progress
+	LogDebug                 // per-step diagnostics
+)
+
+// Logger writes leveled diagnostics to an io.Writer
+// a nil *Logger discards everything, so headless runs pay nothing for it
+type Logger struct {
+	Out   io.Writer
+	Level LogLevel
+}
+
+// NewLogger creates a logger writing messages up to level to out
+func NewLogger(out io.Writer, level LogLevel) *Logger {
+	return &Logger{Out: out, Level: level}
+}
+
+// stdoutLogger is used by environments without a logger of their own,
+// it keeps Render printing to the console like it always has
+var stdoutLogger = NewLogger(os.Stdout, LogInfo)
+
+// Enabled reports whether messages at level are written
+func (l *Logger) Enabled(level LogLevel) bool {
+	return l != nil && l.Out != nil && level <= l.Level && level > LogQuiet
+}
+
+// Writer returns where messages at level go, io.Discard when they are dropped
+func (l *Logger) Writer(level LogLevel) io.Writer {
+	if !l.Enabled(level) {
+		return io.Discard
+	}
+	return l.Out
+}
+
+// Logf writes a line at level
+func (l *Logger) Logf(level LogLevel, format string, args ...interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+	fmt.Fprintf(l.Out, format+"\n", args...)
+}
+
+// Errorf writes a line at LogError
+func (l *Logger) Errorf(format string, args ...interface{}) { l.Logf(LogError, format, args...) }
+
+// Infof writes a line at LogInfo
+func (l *Logger) Infof(format string, args ...interface{}) { l.Logf(LogInfo, format, args...) }
+
+// Debugf writes a line at LogDebug
+func (l *Logger) Debugf(format string, args ...interface{}) { l.Logf(LogDebug, format, args...) }
@@ -0,0 +1,512 @@
+package overcooker
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+
+	"github.com/shanecandoit/go_overcooker/pkg/nn"
+)
+
+// PPOConfig configures multi-agent PPO with a centralized critic
+type PPOConfig struct {
+	Hidden   []int
+	ActorLR  float32
+	CriticLR float32
+
+	Gamma  float64
+	Lambda float64 // GAE lambda
+
+	ClipEpsilon   float64
+	EntropyCoef   float64
+	Epochs        int // passes over each rollout
+	MinibatchSize int
+
+	NumEnvs         int // environments collecting rollouts in parallel
+	RolloutSteps    int // steps per environment per iteration
+	MaxEpisodeSteps int
+
+	// ShareActor trains one actor for all agents, otherwise each agent (by name) gets its own
+	ShareActor bool
+
+	Seed int64
+}
+
+// DefaultPPOConfig returns the usual MAPPO settings scaled to the kitchen
+func DefaultPPOConfig() PPOConfig {
+	return PPOConfig{
+		Hidden:          []int{64, 64},
+		ActorLR:         5e-4,
+		CriticLR:        1e-3,
+		Gamma:           0.99,
+		Lambda:          0.95,
+		ClipEpsilon:     0.2,
+		EntropyCoef:     0.01,
+		Epochs:          4,
+		MinibatchSize:   256,
+		NumEnvs:         4,
+		RolloutSteps:    128,
+		MaxEpisodeSteps: 200,
+		ShareActor:      true,
+		Seed:            1,
+	}
+}
+
+// PPOIterationStats summarizes one collect-and-update iteration
+type PPOIterationStats struct {
+	Iteration     int
+	Episodes      int     // episodes finished during the rollout
+	MeanReturn    float64 // mean return of those episodes
+	PolicyLoss    float64
+	ValueLoss     float64
+	Entropy       float64
+	ClipFraction  float64
+	ExplainedVar  float64
+	StepsPerRound int
+}
+
+// ppoActor is one policy network and its optimizer
+type ppoActor struct {
+	net *nn.MLP
+	opt *nn.Adam
+}
+
+// ppoStep is one joint step of one environment
+type ppoStep struct {
+	state    []float32
+	obs      [][]float32
+	actions  []int
+	logProbs []float32
+	keys     []string // actor key per agent
+	value    float32
+	reward   float32 // team reward
+	done     bool
+	// truncated episodes were cut by MaxEpisodeSteps, the critic's value of
+	// the state they stopped in stands in for the rest of the episode
+	truncated  bool
+	finalValue float32
+}
+
+// ppoWorker is an environment collecting rollouts
+type ppoWorker struct {
+	env           Environment
+	episodeSteps  int
+	episodeReturn float64
+	rng           *rand.Rand
+}
+
+// MAPPO is PPO for the cooperative kitchen
+// decentralized actors act on their own observations,
+// a centralized critic values the global state for the team reward
+// it's not a Learner: Train runs it, it plays as a Controller and Controllers evaluates it
+type MAPPO struct {
+	Config PPOConfig
+	NewEnv func() Environment
+
+	Actors map[string]*ppoActor // keyed by agent name, or sharedNetworkKey
+	Critic *nn.MLP
+	critic *nn.Adam
+
+	Iteration int
+	History   []PPOIterationStats
+
+	workers   []*ppoWorker
+	obsSize   int
+	stateSize int
+	rng       *rand.Rand
+	mu        sync.Mutex // guards Actors while workers create them
+}
+
+// NewMAPPO creates the actors, critic and rollout environments
+func NewMAPPO(newEnv func() Environment, config PPOConfig) *MAPPO {
+	if config.NumEnvs < 1 {
+		config.NumEnvs = 1
+	}
+	if config.Epochs < 1 {
+		config.Epochs = 1
+	}
+	env := newEnv()
+	p := &MAPPO{
+		Config:    config,
+		NewEnv:    newEnv,
+		Actors:    map[string]*ppoActor{},
+		obsSize:   env.ObservationSize(),
+		stateSize: env.GlobalStateSize(),
+		rng:       rand.New(rand.NewSource(config.Seed)),
+	}
+	sizes := append([]int{p.stateSize}, config.Hidden...)
+	p.Critic = nn.NewMLP(append(sizes, 1), nn.ActTanh, p.rng)
+	p.critic = nn.NewAdam(p.Critic.Params(), config.CriticLR)
+	p.critic.MaxGradNorm = 10
+
+	for i := 0; i < config.NumEnvs; i++ {
+		p.workers = append(p.workers, &ppoWorker{env: newEnv(), rng: rand.New(rand.NewSource(p.rng.Int63()))})
+	}
+	// create actors up front so workers only read the map
+	for _, agent := range env.Agents {
+		p.actor(agent.Name)
+	}
+	return p
+}
+
+// actorKey returns which actor an agent uses
+func (p *MAPPO) actorKey(agentName string) string {
+	if p.Config.ShareActor {
+		return sharedNetworkKey
+	}
+	return agentName
+}
+
+// actor returns an agent's actor, creating it on first use
+func (p *MAPPO) actor(agentName string) *ppoActor {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	key := p.actorKey(agentName)
+	if a, ok := p.Actors[key]; ok {
+		return a
+	}
+	sizes := append([]int{p.obsSize}, p.Config.Hidden...)
+	net := nn.NewMLP(append(sizes, Act_Interact+1), nn.ActTanh, p.rng)
+	opt := nn.NewAdam(net.Params(), p.Config.ActorLR)
+	opt.MaxGradNorm = 10
+	a := &ppoActor{net: net, opt: opt}
+	p.Actors[key] = a
+	return a
+}
+
+// Actions samples each agent's action from its actor, MAPPO is a Controller
+func (p *MAPPO) Actions(env *Environment) []int {
+	actions := make([]int, len(env.Agents))
+	for i, agent := range env.Agents {
+		logits := p.actor(agent.Name).net.Forward(nn.FromSlice(1, p.obsSize, env.Observe(i)))
+		actions[i] = sampleIndex(p.rng, softmax32(logits.Data))
+	}
+	return actions
+}
+
+// Controllers plays the trained actors without learning, for an Evaluator:
+// greedy takes each actor's most probable action, otherwise actions are sampled from r
+func (p *MAPPO) Controllers() ControllerFactory {
+	return func(env Environment, greedy bool, r *rand.Rand) (Controller, error) {
+		if size := env.ObservationSize(); size != p.obsSize {
+			return nil, fmt.Errorf("MAPPO's actors see %d observation values, %s has %d, train and play on the same observation grid", p.obsSize, env.Name, size)
+		}
+		if r == nil {
+			r = p.rng
+		}
+		return mappoController{mappo: p, greedy: greedy, rand: r}, nil
+	}
+}
+
+// mappoController plays MAPPO's actors, greedily or by sampling them
+type mappoController struct {
+	mappo  *MAPPO
+	greedy bool
+	rand   *rand.Rand
+}
+
+func (c mappoController) Actions(env *Environment) []int {
+	actions := make([]int, len(env.Agents))
+	for i, agent := range env.Agents {
+		logits := c.mappo.actor(agent.Name).net.Forward(nn.FromSlice(1, c.mappo.obsSize, env.Observe(i)))
+		if c.greedy {
+			actions[i] = argmax(logits.Data)
+		} else {
+			actions[i] = sampleIndex(c.rand, softmax32(logits.Data))
+		}
+	}
+	return actions
+}
+
+// Train runs iterations of rollout collection and PPO updates
+func (p *MAPPO) Train(iterations int) []PPOIterationStats {
+	history := make([]PPOIterationStats, 0, iterations)
+	for i := 0; i < iterations; i++ {
+		history = append(history, p.Iterate())
+	}
+	return history
+}
+
+// Iterate collects one rollout from every environment in parallel and updates on it
+func (p *MAPPO) Iterate() PPOIterationStats {
+	rollouts := make([][]ppoStep, len(p.workers))
+	lastValues := make([]float32, len(p.workers))
+	episodeReturns := make([][]float64, len(p.workers))
+
+	var wg sync.WaitGroup
+	for w, worker := range p.workers {
+		wg.Add(1)
+		go func(w int, worker *ppoWorker) {
+			defer wg.Done()
+			rollouts[w], lastValues[w], episodeReturns[w] = p.collect(worker)
+		}(w, worker)
+	}
+	wg.Wait()
+
+	stats := PPOIterationStats{Iteration: p.Iteration}
+	for _, returns := range episodeReturns {
+		for _, ret := range returns {
+			stats.MeanReturn += ret
+			stats.Episodes++
+		}
+	}
+	if stats.Episodes > 0 {
+		stats.MeanReturn /= float64(stats.Episodes)
+	}
+
+	p.update(rollouts, lastValues, &stats)
+	p.Iteration++
+	p.History = append(p.History, stats)
+	return stats
+}
+
+// collect steps a worker's environment for RolloutSteps steps
+func (p *MAPPO) collect(worker *ppoWorker) (steps []ppoStep, lastValue float32, returns []float64) {
+	for t := 0; t < p.Config.RolloutSteps; t++ {
+		env := &worker.env
+		step := ppoStep{
+			state:    env.GlobalState(),
+			obs:      make([][]float32, len(env.Agents)),
+			actions:  make([]int, len(env.Agents)),
+			logProbs: make([]float32, len(env.Agents)),
+			keys:     make([]string, len(env.Agents)),
+		}
+		step.value = p.Critic.Forward(nn.FromSlice(1, p.stateSize, step.state)).Data[0]
+		for i, agent := range env.Agents {
+			step.obs[i] = env.Observe(i)
+			step.keys[i] = p.actorKey(agent.Name)
+			logits := p.actor(agent.Name).net.Forward(nn.FromSlice(1, p.obsSize, step.obs[i]))
+			probs := softmax32(logits.Data)
+			step.actions[i] = sampleIndex(worker.rng, probs)
+			step.logProbs[i] = float32(math.Log(probs[step.actions[i]] + 1e-8))
+		}
+
+		rewards, done := env.Step(step.actions)
+		for _, r := range rewards {
+			step.reward += r
+		}
+		worker.episodeSteps++
+		worker.episodeReturn += float64(step.reward)
+		if !done && p.Config.MaxEpisodeSteps > 0 && worker.episodeSteps >= p.Config.MaxEpisodeSteps {
+			done, step.truncated = true, true
+			step.finalValue = p.Critic.Forward(nn.FromSlice(1, p.stateSize, env.GlobalState())).Data[0]
+		}
+		step.done = done
+		steps = append(steps, step)
+
+		if done {
+			returns = append(returns, worker.episodeReturn)
+			worker.env = p.NewEnv()
+			worker.episodeSteps = 0
+			worker.episodeReturn = 0
+		}
+	}
+	lastValue = p.Critic.Forward(nn.FromSlice(1, p.stateSize, worker.env.GlobalState())).Data[0]
+	return steps, lastValue, returns
+}
+
+// ppoSample is one agent decision ready for the actor update
+type ppoSample struct {
+	obs       []float32
+	action    int
+	logProb   float32
+	advantage float32
+}
+
+// update computes GAE and runs the clipped PPO epochs
+func (p *MAPPO) update(rollouts [][]ppoStep, lastValues []float32, stats *PPOIterationStats) {
+	// GAE over the team reward, per environment
+	states := [][]float32{}
+	returns := []float32{}
+	values := []float32{}
+	actorSamples := map[string][]ppoSample{}
+	for w, steps := range rollouts {
+		advantages := make([]float32, len(steps))
+		gae := 0.0
+		nextValue := float64(lastValues[w])
+		for t := len(steps) - 1; t >= 0; t-- {
+			notDone := 1.0
+			if steps[t].done {
+				notDone = 0
+			}
+			// the next step belongs to another episode, a truncated one still has a future
+			bootstrap := nextValue * notDone
+			if steps[t].truncated {
+				bootstrap = float64(steps[t].finalValue)
+			}
+			delta := float64(steps[t].reward) + p.Config.Gamma*bootstrap - float64(steps[t].value)
+			gae = delta + p.Config.Gamma*p.Config.Lambda*notDone*gae
+			advantages[t] = float32(gae)
+			nextValue = float64(steps[t].value)
+		}
+		for t, step := range steps {
+			states = append(states, step.state)
+			returns = append(returns, advantages[t]+step.value)
+			values = append(values, step.value)
+			for i := range step.actions {
+				actorSamples[step.keys[i]] = append(actorSamples[step.keys[i]], ppoSample{
+					obs: step.obs[i], action: step.actions[i], logProb: step.logProbs[i], advantage: advantages[t],
+				})
+			}
+		}
+	}
+	stats.StepsPerRound = len(states)
+	stats.ExplainedVar = explainedVariance(values, returns)
+
+	keys := make([]string, 0, len(actorSamples))
+	for key := range actorSamples {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	updates := 0
+	for _, key := range keys {
+		samples := actorSamples[key]
+		normalizeAdvantages(samples)
+		actor := p.Actors[key]
+		for epoch := 0; epoch < p.Config.Epochs; epoch++ {
+			for _, batch := range p.minibatches(len(samples)) {
+				policyLoss, entropy, clipFrac := p.actorStep(actor, samples, batch)
+				stats.PolicyLoss += policyLoss
+				stats.Entropy += entropy
+				stats.ClipFraction += clipFrac
+				updates++
+			}
+		}
+	}
+	if updates > 0 {
+		stats.PolicyLoss /= float64(updates)
+		stats.Entropy /= float64(updates)
+		stats.ClipFraction /= float64(updates)
+	}
+
+	criticUpdates := 0
+	for epoch := 0; epoch < p.Config.Epochs; epoch++ {
+		for _, batch := range p.minibatches(len(states)) {
+			x := nn.New(len(batch), p.stateSize)
+			y := nn.New(len(batch), 1)
+			for r, idx := range batch {
+				copy(x.Row(r), states[idx])
+				y.Data[r] = returns[idx]
+			}
+			p.critic.ZeroGrad()
+			loss := nn.MSE(p.Critic.Forward(x), y)
+			loss.Backward()
+			p.critic.Step()
+			stats.ValueLoss += float64(loss.Item())
+			criticUpdates++
+		}
+	}
+	if criticUpdates > 0 {
+		stats.ValueLoss /= float64(criticUpdates)
+	}
+}
+
+// actorStep does one clipped surrogate step on a minibatch
+func (p *MAPPO) actorStep(actor *ppoActor, samples []ppoSample, batch []int) (policyLoss, entropy, clipFrac float64) {
+	n := len(batch)
+	obs := nn.New(n, p.obsSize)
+	actions := make([]int, n)
+	oldLogProbs := nn.New(n, 1)
+	advantages := nn.New(n, 1)
+	for r, idx := range batch {
+		s := samples[idx]
+		copy(obs.Row(r), s.obs)
+		actions[r] = s.action
+		oldLogProbs.Data[r] = s.logProb
+		advantages.Data[r] = s.advantage
+	}
+
+	actor.opt.ZeroGrad()
+	logProbsAll := nn.LogSoftmax(actor.net.Forward(obs))
+	logProbs := nn.Gather(logProbsAll, actions)
+	ratio := nn.Exp(nn.Sub(logProbs, oldLogProbs))
+	eps := float32(p.Config.ClipEpsilon)
+	surrogate := nn.Minimum(nn.Mul(ratio, advantages), nn.Mul(nn.Clamp(ratio, 1-eps, 1+eps), advantages))
+	// mean entropy of the batch: -sum p log p per row
+	negEntropy := nn.Scale(nn.Sum(nn.Mul(nn.Softmax(logProbsAll), logProbsAll)), 1/float32(n))
+	loss := nn.Sub(nn.Scale(nn.Mean(surrogate), -1), nn.Scale(negEntropy, -float32(p.Config.EntropyCoef)))
+	loss.Backward()
+	actor.opt.Step()
+
+	for _, r := range ratio.Data {
+		if r < 1-eps || r > 1+eps {
+			clipFrac++
+		}
+	}
+	return -float64(nn.Mean(surrogate).Item()), -float64(negEntropy.Item()), clipFrac / float64(n)
+}
+
+// minibatches shuffles indices 0..n-1 into batches of MinibatchSize
+func (p *MAPPO) minibatches(n int) [][]int {
+	order := p.rng.Perm(n)
+	size := p.Config.MinibatchSize
+	if size <= 0 || size > n {
+		size = n
+	}
+	batches := [][]int{}
+	for start := 0; start < n; start += size {
+		end := start + size
+		if end > n {
+			end = n
+		}
+		batches = append(batches, order[start:end])
+	}
+	return batches
+}
+
+// normalizeAdvantages rescales advantages to zero mean and unit variance
+func normalizeAdvantages(samples []ppoSample) {
+	if len(samples) < 2 {
+		return
+	}
+	mean, sq := 0.0, 0.0
+	for _, s := range samples {
+		mean += float64(s.advantage)
+	}
+	mean /= float64(len(samples))
+	for _, s := range samples {
+		d := float64(s.advantage) - mean
+		sq += d * d
+	}
+	std := math.Sqrt(sq/float64(len(samples))) + 1e-8
+	for i := range samples {
+		samples[i].advantage = float32((float64(samples[i].advantage) - mean) / std)
+	}
+}
+
+// explainedVariance is 1 - Var(returns - values) / Var(returns), 1 means a perfect critic
+func explainedVariance(values, returns []float32) float64 {
+	if len(returns) == 0 {
+		return 0
+	}
+	meanR, meanD := 0.0, 0.0
+	for i := range returns {
+		meanR += float64(returns[i])
+		meanD += float64(returns[i] - values[i])
+	}
+	meanR /= float64(len(returns))
+	meanD /= float64(len(returns))
+	varR, varD := 0.0, 0.0
+	for i := range returns {
+		r := float64(returns[i]) - meanR
+		d := float64(returns[i]-values[i]) - meanD
+		varR += r * r
+		varD += d * d
+	}
+	if varR == 0 {
+		return 0
+	}
+	return 1 - varD/varR
+}
+
+// softmax32 is softmax over float32 logits
+func softmax32(logits []float32) []float64 {
+	values := make([]float64, len(logits))
+	for i, x := range logits {
+		values[i] = float64(x)
+	}
+	return softmax(values)
+}
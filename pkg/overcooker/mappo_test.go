@@ -0,0 +1,63 @@
+package overcooker
+
+import (
+	"reflect"
+	"testing"
+)
+
+func smallMAPPO() *MAPPO {
+	config := DefaultPPOConfig()
+	config.Hidden = []int{16}
+	config.NumEnvs = 2
+	config.RolloutSteps = 32
+	config.MinibatchSize = 32
+	config.MaxEpisodeSteps = 20
+	p := NewMAPPO(quietEnvironment, config)
+	p.Train(2)
+	return p
+}
+
+// an Evaluator plays the trained actors, greedy play repeats itself
+func TestMAPPOControllersEvaluate(t *testing.T) {
+	p := smallMAPPO()
+	evaluate := func() *EvalReport {
+		e := Evaluator{
+			Config:      EvalConfig{Episodes: 3, Seeds: []int64{1, 2}, MaxSteps: 20, Modes: EvalModes, Confidence: 0.95},
+			Layouts:     []Environment{quietEnvironment()},
+			Controllers: p.Controllers(),
+			Policy:      "mappo",
+		}
+		report, err := e.Run()
+		if err != nil {
+			t.Fatalf("Run: %v", err)
+		}
+		return report
+	}
+
+	report := evaluate()
+	if len(report.Episodes) != 3*2*len(EvalModes) {
+		t.Fatalf("%d episodes, want %d", len(report.Episodes), 3*2*len(EvalModes))
+	}
+	for _, ep := range report.Episodes {
+		if ep.Steps == 0 || ep.Steps > 20 {
+			t.Errorf("%s episode %d of seed %d took %d steps", ep.Mode, ep.Episode, ep.Seed, ep.Steps)
+		}
+	}
+	again := evaluate()
+	for i, ep := range report.Episodes {
+		if ep.Mode == "greedy" && !reflect.DeepEqual(ep, again.Episodes[i]) {
+			t.Errorf("greedy episode %d of seed %d played %+v, then %+v", ep.Episode, ep.Seed, ep, again.Episodes[i])
+		}
+	}
+}
+
+func TestMAPPOControllersObservationSize(t *testing.T) {
+	p := smallMAPPO()
+	other := parseTestLayout(t, pathLayout)
+	if other.ObservationSize() == p.obsSize {
+		t.Fatalf("the test layout has the training layout's %d observation values", p.obsSize)
+	}
+	if _, err := p.Controllers()(other, true, nil); err == nil {
+		t.Errorf("playing on a %d value grid after training on %d didn't fail", other.ObservationSize(), p.obsSize)
+	}
+}
@@ -0,0 +1,238 @@
+package overcooker
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// MCTSConfig configures the Monte Carlo Tree Search planner
+type MCTSConfig struct {
+	Iterations  int           // simulations per decision, 0 means only the time budget counts
+	Budget      time.Duration // time per decision, 0 means only the iteration count counts
+	Horizon     int           // steps simulated per iteration, tree and rollout together
+	Exploration float64       // UCT exploration constant
+	Gamma       float64       // discount for simulated rewards
+
+	// Joint searches one tree over joint actions of all agents (6^agents branches)
+	// otherwise every agent searches its own tree while the others follow Rollout
+	Joint bool
+
+	// Rollout drives agents outside the tree, nil means random actions
+	// RandomController, PolicyMapController and ScriptedController all work here
+	Rollout Controller
+
+	Seed int64
+}
+
+// DefaultMCTSConfig returns settings that plan a few seconds ahead at interactive speed
+func DefaultMCTSConfig() MCTSConfig {
+	return MCTSConfig{
+		Iterations:  500,
+		Horizon:     20,
+		Exploration: 1.4,
+		Gamma:       0.95,
+		Seed:        1,
+	}
+}
+
+// MCTS is a planner that uses a cloned Environment as its simulator
+// it implements Controller
+type MCTS struct {
+	Config MCTSConfig
+	rng    *rand.Rand
+}
+
+// NewMCTS creates a planner, a config without iterations or a budget gets the default iterations
+func NewMCTS(config MCTSConfig) *MCTS {
+	if config.Iterations <= 0 && config.Budget <= 0 {
+		config.Iterations = DefaultMCTSConfig().Iterations
+	}
+	if config.Horizon <= 0 {
+		config.Horizon = DefaultMCTSConfig().Horizon
+	}
+	if config.Gamma <= 0 {
+		config.Gamma = 1
+	}
+	m := &MCTS{Config: config, rng: rand.New(rand.NewSource(config.Seed))}
+	if m.Config.Rollout == nil {
+		m.Config.Rollout = RandomController{Rand: m.rng}
+	}
+	return m
+}
+
+// mctsNode holds the statistics of one action sequence
+type mctsNode struct {
+	visits   int
+	total    float64
+	children map[int]*mctsNode
+}
+
+// Actions plans from the current state and returns one action per agent
+func (m *MCTS) Actions(env *Environment) []int {
+	numAgents := len(env.Agents)
+	if numAgents == 0 {
+		return []int{}
+	}
+	if m.rng == nil {
+		// an MCTS literal rather than NewMCTS, fill in the defaults
+		*m = *NewMCTS(m.Config)
+	}
+
+	if m.Config.Joint {
+		numActions := 1
+		for i := 0; i < numAgents; i++ {
+			numActions *= Act_Interact + 1
+		}
+		root := m.search(env, -1, numActions, m.Config.Iterations, m.Config.Budget)
+		return decodeJointAction(m.bestAction(root), numAgents)
+	}
+
+	// decentralized: split the budget between the agents' trees
+	actions := make([]int, numAgents)
+	iterations := m.Config.Iterations / numAgents
+	if m.Config.Iterations > 0 && iterations == 0 {
+		iterations = 1
+	}
+	budget := m.Config.Budget / time.Duration(numAgents)
+	for i := range actions {
+		root := m.search(env, i, Act_Interact+1, iterations, budget)
+		actions[i] = m.bestAction(root)
+	}
+	return actions
+}
+
+// search builds a tree for one agent, or for the joint action when agent is -1
+func (m *MCTS) search(env *Environment, agent, numActions, iterations int, budget time.Duration) *mctsNode {
+	root := &mctsNode{children: map[int]*mctsNode{}}
+	if iterations <= 0 && budget <= 0 {
+		iterations = 1 // nothing bounds the search, e.g. a budget too small to split between agents
+	}
+	deadline := time.Now().Add(budget)
+	for i := 0; ; i++ {
+		if iterations > 0 && i >= iterations {
+			break
+		}
+		if budget > 0 && time.Now().After(deadline) {
+			break
+		}
+		m.simulate(root, env, agent, numActions)
+	}
+	return root
+}
+
+// simulate runs one selection, expansion, rollout and backup pass
+func (m *MCTS) simulate(root *mctsNode, env *Environment, agent, numActions int) {
+	sim := env.Clone()
+	path := []*mctsNode{root}
+	stepRewards := make([]float64, 0, m.Config.Horizon)
+
+	node := root
+	for depth := 0; depth < m.Config.Horizon; depth++ {
+		var actions []int
+		if node != nil {
+			action, child, expanded := m.selectChild(node, numActions)
+			path = append(path, child)
+			if expanded {
+				node = nil // leave the tree, roll out from here
+			} else {
+				node = child
+			}
+			if agent < 0 {
+				actions = decodeJointAction(action, len(sim.Agents))
+			} else {
+				actions = m.Config.Rollout.Actions(&sim)
+				actions[agent] = action
+			}
+		} else {
+			actions = m.Config.Rollout.Actions(&sim)
+		}
+
+		rewards, done := sim.Step(actions)
+		// the kitchen is cooperative, every tree scores the team reward
+		teamReward := 0.0
+		for _, r := range rewards {
+			teamReward += float64(r)
+		}
+		stepRewards = append(stepRewards, teamReward)
+		if done {
+			break
+		}
+	}
+
+	// discounted return from each depth onward
+	returns := make([]float64, len(stepRewards)+1)
+	for t := len(stepRewards) - 1; t >= 0; t-- {
+		returns[t] = stepRewards[t] + m.Config.Gamma*returns[t+1]
+	}
+
+	// the node reached by the action at depth d is scored with the return from d
+	root.visits++
+	root.total += returns[0]
+	for k := 1; k < len(path); k++ {
+		path[k].visits++
+		path[k].total += returns[k-1]
+	}
+}
+
+// selectChild expands an untried action if there is one, otherwise picks by UCT
+func (m *MCTS) selectChild(node *mctsNode, numActions int) (action int, child *mctsNode, expanded bool) {
+	if len(node.children) < numActions {
+		action = m.untriedAction(node, numActions)
+		child = &mctsNode{children: map[int]*mctsNode{}}
+		node.children[action] = child
+		return action, child, true
+	}
+
+	bestScore := math.Inf(-1)
+	logParent := math.Log(float64(node.visits))
+	for a := 0; a < numActions; a++ {
+		c := node.children[a]
+		score := c.total/float64(c.visits) + m.Config.Exploration*math.Sqrt(logParent/float64(c.visits))
+		if score > bestScore {
+			bestScore = score
+			action = a
+			child = c
+		}
+	}
+	return action, child, false
+}
+
+// untriedAction picks a random action that has no child yet
+func (m *MCTS) untriedAction(node *mctsNode, numActions int) int {
+	// joint action spaces are large and sparse, guessing is usually enough
+	for try := 0; try < 16; try++ {
+		a := m.rng.Intn(numActions)
+		if _, ok := node.children[a]; !ok {
+			return a
+		}
+	}
+	untried := []int{}
+	for a := 0; a < numActions; a++ {
+		if _, ok := node.children[a]; !ok {
+			untried = append(untried, a)
+		}
+	}
+	return untried[m.rng.Intn(len(untried))]
+}
+
+// bestAction is the most visited root action, Act_None for an empty tree
+func (m *MCTS) bestAction(root *mctsNode) int {
+	best, bestVisits := Act_None, -1
+	for a, child := range root.children {
+		if child.visits > bestVisits || (child.visits == bestVisits && a < best) {
+			best, bestVisits = a, child.visits
+		}
+	}
+	return best
+}
+
+// decodeJointAction splits a joint action index into one action per agent
+func decodeJointAction(joint, numAgents int) []int {
+	actions := make([]int, numAgents)
+	for i := range actions {
+		actions[i] = joint % (Act_Interact + 1)
+		joint /= Act_Interact + 1
+	}
+	return actions
+}
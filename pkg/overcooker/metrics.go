@@ -0,0 +1,370 @@
+package overcooker
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// MetricEvents are the events the kitchen counts, each gets its own CSV column
+var MetricEvents = []string{"onion_get", "onion_chop", "onion_cook", "soup_deliver"}
+
+// EpisodeMetrics summarizes one finished episode
+type EpisodeMetrics struct {
+	Episode    int            `json:"episode"`
+	Steps      int            `json:"steps"`
+	TotalSteps int            `json:"total_steps"` // steps over every episode so far
+	Return     float64        `json:"return"`
+	Deliveries int            `json:"deliveries"`
+	Events     map[string]int `json:"events"`
+	// AgentReturns is each agent's share of the return by name, agents that joined or left included
+	AgentReturns map[string]float64 `json:"agent_returns,omitempty"`
+	InvalidRate  float64            `json:"invalid_action_rate"`      // blocked or useless actions per agent action
+	Entropy      *float64           `json:"policy_entropy,omitempty"` // mean entropy of the learner's policy, nil when it has none
+	StepsPerSec  float64            `json:"steps_per_sec"`
+	Time         float64            `json:"time"` // seconds since recording started
+}
+
+// EntropyReporter is a learner that can tell how random its policy still is
+type EntropyReporter interface {
+	PolicyEntropy() float64
+}
+
+// MeanEntropy returns the mean entropy of the map's policies in nats, 0 for an empty map
+func (pm PolicyMap) MeanEntropy() float64 {
+	if len(pm) == 0 {
+		return 0
+	}
+	h := 0.0
+	for _, pos := range sortedPositions(pm) {
+		h += pm[pos].Entropy()
+	}
+	return h / float64(len(pm))
+}
+
+// PolicyEntropy averages the shared map and every per-agent or per-role map
+func (l *PolicyMapLearner) PolicyEntropy() float64 {
+	h := l.Map.MeanEntropy()
+	n := 1
+	for _, name := range sortedKeys(l.Maps) {
+		h += l.Maps[name].MeanEntropy()
+		n++
+	}
+	return h / float64(n)
+}
+
+// PolicyEntropy is the entropy of the mean the samples are drawn around
+func (l *CEMLearner) PolicyEntropy() float64 {
+	return l.Mean.MeanEntropy()
+}
+
+// PolicyEntropy is the entropy of the softmax policy
+func (l *ReinforceLearner) PolicyEntropy() float64 {
+	return l.PolicyMap().MeanEntropy()
+}
+
+func sortedKeys(maps map[string]PolicyMap) []string {
+	keys := make([]string, 0, len(maps))
+	for k := range maps {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// MetricsWriter stores episode metrics as they come in
+type MetricsWriter interface {
+	WriteMetrics(m EpisodeMetrics) error
+	Close() error
+}
+
+// CreateMetricsFile creates a metrics log, CSV for a .csv path and JSON lines otherwise
+// rows are flushed as they're written so a dashboard can follow the file
+func CreateMetricsFile(path string) (MetricsWriter, error) {
+	if filepath.Ext(path) == ".csv" {
+		header := []string{"episode", "steps", "total_steps", "return", "deliveries",
+			"invalid_action_rate", "policy_entropy", "steps_per_sec", "time"}
+		c, err := newCSVFile(path, append(header, MetricEvents...)...)
+		if err != nil {
+			return nil, err
+		}
+		return csvMetricsWriter{c}, nil
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("creating %s: %w", path, err)
+	}
+	return jsonMetricsWriter{f: f, enc: json.NewEncoder(f)}, nil
+}
+
+type csvMetricsWriter struct{ c *csvFile }
+
+func (w csvMetricsWriter) WriteMetrics(m EpisodeMetrics) error {
+	entropy := ""
+	if m.Entropy != nil {
+		entropy = strconv.FormatFloat(*m.Entropy, 'g', 6, 64)
+	}
+	row := []interface{}{m.Episode, m.Steps, m.TotalSteps, m.Return, m.Deliveries,
+		m.InvalidRate, entropy, m.StepsPerSec, m.Time}
+	for _, event := range MetricEvents {
+		row = append(row, m.Events[event])
+	}
+	w.c.Write(row...)
+	return w.c.Flush()
+}
+
+func (w csvMetricsWriter) Close() error { return w.c.Close() }
+
+type jsonMetricsWriter struct {
+	f   *os.File
+	enc *json.Encoder
+}
+
+func (w jsonMetricsWriter) WriteMetrics(m EpisodeMetrics) error {
+	if err := w.enc.Encode(m); err != nil {
+		return fmt.Errorf("writing %s: %w", w.f.Name(), err)
+	}
+	return nil
+}
+
+func (w jsonMetricsWriter) Close() error { return w.f.Close() }
+
+// ReadMetricsFile reads a log written by CreateMetricsFile
+// a half written last line is left out, so it's safe to read a log that's still growing
+func ReadMetricsFile(path string) ([]EpisodeMetrics, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading metrics: %w", err)
+	}
+	data = data[:bytes.LastIndexByte(data, '\n')+1]
+	var metrics []EpisodeMetrics
+	if filepath.Ext(path) == ".csv" {
+		metrics, err = readMetricsCSV(bytes.NewReader(data))
+	} else {
+		metrics, err = readMetricsJSON(bytes.NewReader(data))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("metrics %s: %w", path, err)
+	}
+	return metrics, nil
+}
+
+func readMetricsJSON(r io.Reader) ([]EpisodeMetrics, error) {
+	var metrics []EpisodeMetrics
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var m EpisodeMetrics
+		if err := json.Unmarshal(scanner.Bytes(), &m); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		metrics = append(metrics, m)
+	}
+	return metrics, scanner.Err()
+}
+
+func readMetricsCSV(r io.Reader) ([]EpisodeMetrics, error) {
+	rows, err := csv.NewReader(r).ReadAll()
+	if err != nil || len(rows) == 0 {
+		return nil, err
+	}
+	columns := map[string]int{}
+	for i, name := range rows[0] {
+		columns[name] = i
+	}
+	var metrics []EpisodeMetrics
+	for line, row := range rows[1:] {
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(row) {
+				return row[i]
+			}
+			return ""
+		}
+		number := func(name string) float64 {
+			v, parseErr := strconv.ParseFloat(field(name), 64)
+			if parseErr != nil && field(name) != "" && err == nil {
+				err = fmt.Errorf("line %d, %s: %w", line+2, name, parseErr)
+			}
+			return v
+		}
+		m := EpisodeMetrics{
+			Episode:     int(number("episode")),
+			Steps:       int(number("steps")),
+			TotalSteps:  int(number("total_steps")),
+			Return:      number("return"),
+			Deliveries:  int(number("deliveries")),
+			InvalidRate: number("invalid_action_rate"),
+			StepsPerSec: number("steps_per_sec"),
+			Time:        number("time"),
+			Events:      map[string]int{},
+		}
+		if field("policy_entropy") != "" {
+			h := number("policy_entropy")
+			m.Entropy = &h
+		}
+		for _, event := range MetricEvents {
+			if n := int(number(event)); n != 0 {
+				m.Events[event] = n
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		metrics = append(metrics, m)
+	}
+	return metrics, nil
+}
+
+// MetricsRecorder turns steps into per-episode metrics, keeps them and passes them to its writers
+// it's safe to read the history while another goroutine records
+type MetricsRecorder struct {
+	Learner Learner // asked for its policy entropy after every episode when it's an EntropyReporter
+	Writers []MetricsWriter
+
+	mu      sync.Mutex
+	history []EpisodeMetrics
+	err     error
+	started time.Time
+
+	// the episode in progress
+	running      bool
+	episodeStart time.Time
+	steps        int
+	totalSteps   int
+	agentActions int
+	invalid      int
+	events       map[string]int
+	agentReturns map[string]float64
+}
+
+// NewMetricsRecorder creates a recorder, learner may be nil
+func NewMetricsRecorder(learner Learner, writers ...MetricsWriter) *MetricsRecorder {
+	return &MetricsRecorder{Learner: learner, Writers: writers, started: time.Now()}
+}
+
+// Attach records every episode the trainer runs, keeping hooks that are already set
+func (m *MetricsRecorder) Attach(t *Trainer) {
+	onEpisodeStart, onStep := t.OnEpisodeStart, t.OnStep
+	t.OnEpisodeStart = func(env *Environment) {
+		if onEpisodeStart != nil {
+			onEpisodeStart(env)
+		}
+		m.StartEpisode(env)
+	}
+	t.OnStep = func(env *Environment, actions []int, rewards []float32, done bool) {
+		if onStep != nil {
+			onStep(env, actions, rewards, done)
+		}
+		m.Step(env, actions, rewards, done)
+	}
+}
+
+// StartEpisode notes env's counters so only what happens from now on counts
+func (m *MetricsRecorder) StartEpisode(env *Environment) {
+	m.running = true
+	m.episodeStart = time.Now()
+	m.steps = 0
+	m.agentActions = 0
+	m.invalid = env.InvalidActions
+	m.events = copyCounts(env.EventCountsmap)
+	m.agentReturns = map[string]float64{}
+}
+
+// Step counts a step, and finishes the episode when done
+func (m *MetricsRecorder) Step(env *Environment, actions []int, rewards []float32, done bool) {
+	if !m.running {
+		m.running = true
+		m.episodeStart = time.Now()
+		m.events = map[string]int{}
+		m.agentReturns = map[string]float64{}
+	}
+	m.steps++
+	m.totalSteps++
+	m.agentActions += len(actions)
+	// rewards line up with the agents as long as the team changes between steps
+	for i := range rewards {
+		if i < len(env.Agents) {
+			m.agentReturns[env.Agents[i].Name] += float64(rewards[i])
+		}
+	}
+	if done {
+		m.EndEpisode(env)
+	}
+}
+
+// EndEpisode records the episode so far, Step calls it when the episode is done
+func (m *MetricsRecorder) EndEpisode(env *Environment) EpisodeMetrics {
+	now := time.Now()
+	metrics := EpisodeMetrics{
+		Steps:        m.steps,
+		TotalSteps:   m.totalSteps,
+		Return:       env.TotalReward,
+		Events:       map[string]int{},
+		AgentReturns: m.agentReturns,
+		Time:         now.Sub(m.started).Seconds(),
+	}
+	for event, count := range env.EventCountsmap {
+		if n := count - m.events[event]; n != 0 {
+			metrics.Events[event] = n
+		}
+	}
+	metrics.Deliveries = metrics.Events["soup_deliver"]
+	if m.agentActions > 0 {
+		metrics.InvalidRate = float64(env.InvalidActions-m.invalid) / float64(m.agentActions)
+	}
+	if elapsed := now.Sub(m.episodeStart).Seconds(); elapsed > 0 {
+		metrics.StepsPerSec = float64(m.steps) / elapsed
+	}
+	if reporter, ok := m.Learner.(EntropyReporter); ok {
+		h := reporter.PolicyEntropy()
+		metrics.Entropy = &h
+	}
+	m.running = false
+
+	m.mu.Lock()
+	metrics.Episode = len(m.history) + 1
+	m.history = append(m.history, metrics)
+	m.mu.Unlock()
+	for _, w := range m.Writers {
+		if err := w.WriteMetrics(metrics); err != nil && m.err == nil {
+			m.err = err
+		}
+	}
+	return metrics
+}
+
+// History returns a copy of the episodes recorded so far
+func (m *MetricsRecorder) History() []EpisodeMetrics {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]EpisodeMetrics(nil), m.history...)
+}
+
+// Err returns the first error a writer returned
+func (m *MetricsRecorder) Err() error {
+	return m.err
+}
+
+// Close closes the writers and returns the first error of recording or closing
+// the writers are dropped, so closing twice is fine
+func (m *MetricsRecorder) Close() error {
+	err := m.err
+	for _, w := range m.Writers {
+		if closeErr := w.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	m.Writers = nil
+	return err
+}
@@ -0,0 +1,412 @@
+package overcooker
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+)
+
+// AgentInfo is what ParallelEnv and AECEnv report about one agent besides its observation
+type AgentInfo struct {
+	X            int    `json:"x"`
+	Y            int    `json:"y"`
+	Holding      string `json:"holding,omitempty"`
+	ValidActions []int  `json:"valid_actions"`
+}
+
+// ParallelEnv is the parallel multi-agent API: agents are addressed by name,
+// every live agent acts at once and each one terminates or is truncated on its own,
+// agents can join and leave between steps
+// mistakes are returned as errors, nothing panics
+type ParallelEnv struct {
+	Base       Environment // cloned for every episode
+	MaxSteps   int         // truncates episodes, 0 never
+	SpawnEvery int         // spawn random items every this many steps, 0 never
+
+	Env   Environment
+	Steps int
+
+	started      bool
+	over         bool
+	joined       []string // agents that joined this episode and aren't in the layout
+	live         map[string]bool
+	terminations map[string]bool
+	truncations  map[string]bool
+}
+
+// NewParallelEnv creates a parallel environment, call Reset before stepping
+func NewParallelEnv(base Environment, maxSteps int) *ParallelEnv {
+	return &ParallelEnv{Base: base, MaxSteps: maxSteps}
+}
+
+// PossibleAgents returns every agent of the layout in order, then those that joined this episode
+func (p *ParallelEnv) PossibleAgents() []string {
+	return append(agentNames(p.Base.Agents), p.joined...)
+}
+
+// Agents returns the agents still in the episode, in order
+func (p *ParallelEnv) Agents() []string {
+	var names []string
+	for _, agent := range p.Env.Agents {
+		if p.live[agent.Name] {
+			names = append(names, agent.Name)
+		}
+	}
+	return names
+}
+
+func agentNames(agents []Agent) []string {
+	names := make([]string, len(agents))
+	for i, agent := range agents {
+		names[i] = agent.Name
+	}
+	return names
+}
+
+// NumActions is the size of every agent's action space
+func (p *ParallelEnv) NumActions() int {
+	return len(ActionNames)
+}
+
+// ObservationSize is the length of every agent's observation
+func (p *ParallelEnv) ObservationSize() int {
+	return p.Base.ObservationSize()
+}
+
+// Reset starts an episode whose item spawning is seeded with seed
+func (p *ParallelEnv) Reset(seed int64) (observations map[string][]float32, infos map[string]AgentInfo) {
+	p.Env = p.Base.Clone()
+	p.Env.Rand = rand.New(rand.NewSource(seed))
+	p.Steps = 0
+	p.started = true
+	p.over = false
+	p.joined = nil
+	p.live = map[string]bool{}
+	p.terminations = map[string]bool{}
+	p.truncations = map[string]bool{}
+	for _, agent := range p.Env.Agents {
+		p.live[agent.Name] = true
+	}
+	return p.observations(), p.infos()
+}
+
+// Step applies one action per live agent, agents that are done don't act anymore
+// it fails, changing nothing, when an action is missing, unknown, out of range or for an agent that's done
+func (p *ParallelEnv) Step(actions map[string]int) (
+	observations map[string][]float32, rewards map[string]float32,
+	terminations, truncations map[string]bool, infos map[string]AgentInfo, err error,
+) {
+	if !p.started {
+		return nil, nil, nil, nil, nil, fmt.Errorf("step before the first reset")
+	}
+	if p.over {
+		return nil, nil, nil, nil, nil, fmt.Errorf("every agent is done, reset first")
+	}
+	if len(p.live) == 0 {
+		return nil, nil, nil, nil, nil, fmt.Errorf("no agent is in the kitchen, add one or reset")
+	}
+	joint := make([]int, len(p.Env.Agents))
+	var missing []string
+	for i, agent := range p.Env.Agents {
+		action, ok := actions[agent.Name]
+		switch {
+		case !p.live[agent.Name] && ok:
+			return nil, nil, nil, nil, nil, fmt.Errorf("agent %s is done and can't act", agent.Name)
+		case !p.live[agent.Name]:
+			joint[i] = Act_None
+		case !ok:
+			missing = append(missing, agent.Name)
+		case action < 0 || action >= len(ActionNames):
+			return nil, nil, nil, nil, nil, fmt.Errorf("action %d of agent %s is out of range", action, agent.Name)
+		default:
+			joint[i] = action
+		}
+	}
+	if len(missing) > 0 {
+		return nil, nil, nil, nil, nil, fmt.Errorf("no action for %s", strings.Join(missing, ", "))
+	}
+	if len(actions) > len(p.live) {
+		for name := range actions {
+			if !p.knows(name) && p.terminations[name] {
+				return nil, nil, nil, nil, nil, fmt.Errorf("agent %s left and can't act", name)
+			}
+			if !p.knows(name) {
+				return nil, nil, nil, nil, nil, fmt.Errorf("no agent %s", name)
+			}
+		}
+	}
+
+	stepRewards, done := p.Env.Step(joint)
+	p.Steps++
+	if p.SpawnEvery > 0 && p.Steps%p.SpawnEvery == 0 {
+		p.Env.EnvironmentSpawnRandomItemsForTraining()
+	}
+	truncated := !done && p.MaxSteps > 0 && p.Steps >= p.MaxSteps
+
+	rewards = map[string]float32{}
+	terminations = map[string]bool{}
+	truncations = map[string]bool{}
+	for i, agent := range p.Env.Agents {
+		if !p.live[agent.Name] {
+			continue
+		}
+		rewards[agent.Name] = stepRewards[i]
+		terminations[agent.Name] = done
+		truncations[agent.Name] = truncated
+		p.terminations[agent.Name] = done
+		p.truncations[agent.Name] = truncated
+	}
+	observations, infos = p.observations(), p.infos()
+	if done || truncated {
+		p.over = true
+		p.live = map[string]bool{}
+	}
+	return observations, rewards, terminations, truncations, infos, nil
+}
+
+// AddAgent brings a new agent into the kitchen at (x, y), it acts from the next step on
+// an agent that left earlier in the episode can come back
+func (p *ParallelEnv) AddAgent(name string, x, y int) (observation []float32, info AgentInfo, err error) {
+	if !p.started {
+		return nil, AgentInfo{}, fmt.Errorf("add an agent before the first reset")
+	}
+	if p.over {
+		return nil, AgentInfo{}, fmt.Errorf("the episode is over, reset first")
+	}
+	if err := p.Env.AddAgent(name, x, y); err != nil {
+		return nil, AgentInfo{}, err
+	}
+	p.live[name] = true
+	delete(p.terminations, name)
+	delete(p.truncations, name)
+	if p.Base.agentIndex(name) < 0 && !containsString(p.joined, name) {
+		p.joined = append(p.joined, name)
+	}
+	i := len(p.Env.Agents) - 1
+	return p.Env.Observe(i), p.info(i), nil
+}
+
+// RemoveAgent takes a live agent out of the kitchen, it's terminated and gone from Agents,
+// what it held is dropped, see Environment.RemoveAgent
+func (p *ParallelEnv) RemoveAgent(name string) error {
+	if !p.started {
+		return fmt.Errorf("remove an agent before the first reset")
+	}
+	if !p.live[name] {
+		if p.knows(name) {
+			return fmt.Errorf("agent %s is done", name)
+		}
+		return fmt.Errorf("no agent %s", name)
+	}
+	if _, err := p.Env.RemoveAgent(name); err != nil {
+		return err
+	}
+	delete(p.live, name)
+	p.terminations[name] = true
+	return nil
+}
+
+func containsString(s []string, x string) bool {
+	for _, v := range s {
+		if v == x {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *ParallelEnv) knows(name string) bool {
+	return p.Env.agentIndex(name) >= 0
+}
+
+// Observe returns an agent's current observation
+func (p *ParallelEnv) Observe(agent string) ([]float32, error) {
+	if !p.started {
+		return nil, fmt.Errorf("observe before the first reset")
+	}
+	i := p.Env.agentIndex(agent)
+	if i < 0 {
+		return nil, fmt.Errorf("no agent %s", agent)
+	}
+	return p.Env.Observe(i), nil
+}
+
+// Render draws the kitchen
+func (p *ParallelEnv) Render() string {
+	return p.Env.RenderString()
+}
+
+// observations and infos cover the live agents
+func (p *ParallelEnv) observations() map[string][]float32 {
+	obs := map[string][]float32{}
+	for i, agent := range p.Env.Agents {
+		if p.live[agent.Name] {
+			obs[agent.Name] = p.Env.Observe(i)
+		}
+	}
+	return obs
+}
+
+func (p *ParallelEnv) infos() map[string]AgentInfo {
+	infos := map[string]AgentInfo{}
+	for i, agent := range p.Env.Agents {
+		if p.live[agent.Name] {
+			infos[agent.Name] = p.info(i)
+		}
+	}
+	return infos
+}
+
+func (p *ParallelEnv) info(i int) AgentInfo {
+	agent := p.Env.Agents[i]
+	return AgentInfo{X: agent.X, Y: agent.Y, Holding: agent.Inventory.Name, ValidActions: p.Env.ValidActions(i)}
+}
+
+// AECEnv is the agent-environment-cycle API: agents take turns choosing actions
+// and the kitchen moves once the last agent of the cycle has chosen, as if they acted together
+// an agent that's done is selected once more so Last can tell it, and must then be stepped with Act_None,
+// that includes agents that left, agents that join take their turns from the current cycle on
+type AECEnv struct {
+	Parallel *ParallelEnv
+
+	order      []string // agents of the current cycle
+	turn       int
+	pending    map[string]int
+	done       map[string]bool
+	cumulative map[string]float32 // rewards since each agent last acted
+	infos      map[string]AgentInfo
+	final      map[string][]float32 // last observation of agents that left
+}
+
+// NewAECEnv creates a turn-based environment, call Reset before stepping
+func NewAECEnv(base Environment, maxSteps int) *AECEnv {
+	return &AECEnv{Parallel: NewParallelEnv(base, maxSteps)}
+}
+
+// Reset starts an episode whose item spawning is seeded with seed
+func (a *AECEnv) Reset(seed int64) {
+	_, a.infos = a.Parallel.Reset(seed)
+	a.order = a.Parallel.Agents()
+	a.turn = 0
+	a.pending = map[string]int{}
+	a.done = map[string]bool{}
+	a.cumulative = map[string]float32{}
+	a.final = map[string][]float32{}
+}
+
+// Agents returns the agents still taking turns, done agents stay until their last turn
+func (a *AECEnv) Agents() []string {
+	return append([]string(nil), a.order...)
+}
+
+// AgentSelection returns the agent whose turn it is, "" once every agent is done
+func (a *AECEnv) AgentSelection() string {
+	if a.turn >= len(a.order) {
+		return ""
+	}
+	return a.order[a.turn]
+}
+
+// Last returns what the selected agent needs to choose its action:
+// its observation, the rewards it got since it last acted and whether it's done
+func (a *AECEnv) Last() (observation []float32, reward float32, terminated, truncated bool, info AgentInfo, err error) {
+	agent := a.AgentSelection()
+	if agent == "" {
+		return nil, 0, false, false, AgentInfo{}, fmt.Errorf("every agent is done, reset first")
+	}
+	observation, ok := a.final[agent]
+	if !ok {
+		observation, err = a.Parallel.Observe(agent)
+		if err != nil {
+			return nil, 0, false, false, AgentInfo{}, err
+		}
+	}
+	return observation, a.cumulative[agent], a.Parallel.terminations[agent], a.Parallel.truncations[agent], a.infos[agent], nil
+}
+
+// Observe returns any agent's current observation
+func (a *AECEnv) Observe(agent string) ([]float32, error) {
+	return a.Parallel.Observe(agent)
+}
+
+// Render draws the kitchen
+func (a *AECEnv) Render() string {
+	return a.Parallel.Render()
+}
+
+// Step sets the selected agent's action and passes the turn,
+// after the last agent of the cycle the kitchen moves and a new cycle starts
+func (a *AECEnv) Step(action int) error {
+	agent := a.AgentSelection()
+	if agent == "" {
+		return fmt.Errorf("every agent is done, reset first")
+	}
+	if a.done[agent] {
+		if action != Act_None {
+			return fmt.Errorf("agent %s is done, step it with Act_None", agent)
+		}
+		a.order = append(a.order[:a.turn], a.order[a.turn+1:]...)
+		delete(a.cumulative, agent)
+		delete(a.final, agent)
+	} else {
+		if action < 0 || action >= len(ActionNames) {
+			return fmt.Errorf("action %d of agent %s is out of range", action, agent)
+		}
+		a.pending[agent] = action
+		a.cumulative[agent] = 0
+		a.turn++
+	}
+	if a.turn < len(a.order) {
+		return nil
+	}
+
+	// the cycle is over, move the kitchen with the actions of the agents still playing
+	if len(a.pending) > 0 {
+		_, rewards, terminations, truncations, infos, err := a.Parallel.Step(a.pending)
+		if err != nil {
+			return err
+		}
+		for name, reward := range rewards {
+			a.cumulative[name] += reward
+			a.infos[name] = infos[name]
+			if terminations[name] || truncations[name] {
+				a.done[name] = true
+			}
+		}
+		a.pending = map[string]int{}
+	}
+	a.turn = 0
+	return nil
+}
+
+// AddAgent brings a new agent into the kitchen at (x, y), it takes its turn in the current cycle
+func (a *AECEnv) AddAgent(name string, x, y int) error {
+	if containsString(a.order, name) {
+		return fmt.Errorf("agent %s hasn't taken its last turn yet", name)
+	}
+	_, info, err := a.Parallel.AddAgent(name, x, y)
+	if err != nil {
+		return err
+	}
+	a.order = append(a.order, name)
+	a.infos[name] = info
+	a.cumulative[name] = 0
+	delete(a.done, name)
+	return nil
+}
+
+// RemoveAgent takes an agent out of the kitchen, its choice of this cycle is dropped
+// and it's selected once more so Last can tell it's terminated
+func (a *AECEnv) RemoveAgent(name string) error {
+	observation, err := a.Parallel.Observe(name)
+	if err != nil {
+		return err
+	}
+	if err := a.Parallel.RemoveAgent(name); err != nil {
+		return err
+	}
+	a.final[name] = observation
+	a.done[name] = true
+	delete(a.pending, name)
+	return nil
+}
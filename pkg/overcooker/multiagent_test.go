@@ -0,0 +1,186 @@
+package overcooker
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const teamLayout = `
+a1. . O1
+. a2. .
+. . a3D1
+`
+
+// the AEC cycle selects agents in order and moves the kitchen once, after the last of them
+func TestAECEnvTurnOrder(t *testing.T) {
+	base := parseTestLayout(t, teamLayout)
+	aec := NewAECEnv(base, 2)
+	aec.Reset(1)
+
+	// the same joint actions stepped on a plain environment
+	direct := base.Clone()
+	cycles := [][]int{{Act_East, Act_South, Act_North}, {Act_East, Act_Interact, Act_None}}
+	for cycle, actions := range cycles {
+		for i, action := range actions {
+			name := base.Agents[i].Name
+			if got := aec.AgentSelection(); got != name {
+				t.Fatalf("cycle %d: selected %q, want %q", cycle, got, name)
+			}
+			if aec.Parallel.Steps != cycle {
+				t.Fatalf("cycle %d: the kitchen moved before %s chose", cycle, name)
+			}
+			if err := aec.Step(action); err != nil {
+				t.Fatalf("cycle %d, %s: %v", cycle, name, err)
+			}
+		}
+		if aec.Parallel.Steps != cycle+1 {
+			t.Fatalf("cycle %d: the kitchen made %d steps, want %d", cycle, aec.Parallel.Steps, cycle+1)
+		}
+
+		rewards, _ := direct.Step(actions)
+		for i, agent := range direct.Agents {
+			moved := aec.Parallel.Env.Agents[i]
+			if moved.X != agent.X || moved.Y != agent.Y {
+				t.Errorf("cycle %d: %s at (%d,%d), stepping the joint actions puts it at (%d,%d)", cycle, agent.Name, moved.X, moved.Y, agent.X, agent.Y)
+			}
+			if reward := aec.cumulative[agent.Name]; reward != rewards[i] {
+				t.Errorf("cycle %d: %s got %v, stepping the joint actions gives %v", cycle, agent.Name, reward, rewards[i])
+			}
+		}
+	}
+
+	// truncated after 2 steps: each agent is selected once more to see it's done
+	for _, agent := range base.Agents {
+		if got := aec.AgentSelection(); got != agent.Name {
+			t.Fatalf("after the episode: selected %q, want %q", got, agent.Name)
+		}
+		if _, _, terminated, truncated, _, err := aec.Last(); err != nil || terminated || !truncated {
+			t.Fatalf("%s: Last says terminated %v, truncated %v, err %v, want truncated", agent.Name, terminated, truncated, err)
+		}
+		if err := aec.Step(Act_North); err == nil || !strings.Contains(err.Error(), "is done") {
+			t.Fatalf("%s: stepping a done agent with a move: err %v, want it's done", agent.Name, err)
+		}
+		if err := aec.Step(Act_None); err != nil {
+			t.Fatalf("%s: %v", agent.Name, err)
+		}
+	}
+	if got := aec.AgentSelection(); got != "" {
+		t.Errorf("selected %q after every agent is done", got)
+	}
+	if err := aec.Step(Act_None); err == nil {
+		t.Errorf("stepping after every agent is done: no error")
+	}
+	if _, _, _, _, _, err := aec.Last(); err == nil {
+		t.Errorf("Last after every agent is done: no error")
+	}
+}
+
+// an agent leaving mid-cycle gets one more turn to see it's terminated and the others play on
+func TestAECEnvAgentLeaves(t *testing.T) {
+	aec := NewAECEnv(parseTestLayout(t, teamLayout), 0)
+	aec.Reset(1)
+	if err := aec.Step(Act_East); err != nil { // a1
+		t.Fatal(err)
+	}
+	if err := aec.RemoveAgent("a3"); err != nil {
+		t.Fatal(err)
+	}
+	if err := aec.Step(Act_South); err != nil { // a2
+		t.Fatal(err)
+	}
+	if got := aec.AgentSelection(); got != "a3" {
+		t.Fatalf("selected %q, want a3 to hear it left", got)
+	}
+	if obs, _, terminated, _, _, err := aec.Last(); err != nil || !terminated || obs == nil {
+		t.Fatalf("a3: Last says terminated %v with observation %v, err %v", terminated, obs != nil, err)
+	}
+	if err := aec.Step(Act_Interact); err == nil {
+		t.Fatalf("a3 acted after leaving")
+	}
+	if err := aec.Step(Act_None); err != nil {
+		t.Fatal(err)
+	}
+	if aec.Parallel.Steps != 1 {
+		t.Errorf("the kitchen made %d steps, want 1", aec.Parallel.Steps)
+	}
+	if got, want := aec.Agents(), []string{"a1", "a2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("agents = %v, want %v", got, want)
+	}
+	if got := aec.AgentSelection(); got != "a1" {
+		t.Errorf("the next cycle starts with %q, want a1", got)
+	}
+}
+
+func TestParallelEnvStepErrors(t *testing.T) {
+	all := func(action int) map[string]int {
+		return map[string]int{"a1": action, "a2": action, "a3": action}
+	}
+	with := func(actions map[string]int, name string, action int) map[string]int {
+		actions[name] = action
+		return actions
+	}
+	without := func(actions map[string]int, name string) map[string]int {
+		delete(actions, name)
+		return actions
+	}
+	tests := []struct {
+		name    string
+		setup   func(p *ParallelEnv)
+		actions map[string]int
+		err     string
+	}{
+		{"before reset", nil, all(Act_None), "before the first reset"},
+		{"missing action", func(p *ParallelEnv) { p.Reset(1) }, without(all(Act_None), "a2"), "no action for a2"},
+		{"unknown agent", func(p *ParallelEnv) { p.Reset(1) }, with(all(Act_None), "a9", Act_None), "no agent a9"},
+		{"out of range", func(p *ParallelEnv) { p.Reset(1) }, with(all(Act_None), "a1", len(ActionNames)), "out of range"},
+		{"agent that left", func(p *ParallelEnv) {
+			p.Reset(1)
+			p.RemoveAgent("a3")
+		}, all(Act_None), "a3 left"},
+		{"after the episode", func(p *ParallelEnv) {
+			p.Reset(1)
+			p.Step(all(Act_None))
+		}, all(Act_None), "reset first"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewParallelEnv(parseTestLayout(t, teamLayout), 1)
+			if tt.setup != nil {
+				tt.setup(p)
+			}
+			steps, agents := p.Steps, append([]Agent(nil), p.Env.Agents...)
+			_, _, _, _, _, err := p.Step(tt.actions)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("err = %v, want %q", err, tt.err)
+			}
+			if p.Steps != steps || !reflect.DeepEqual(p.Env.Agents, agents) {
+				t.Errorf("a failed step changed the kitchen")
+			}
+		})
+	}
+}
+
+// agents that are done report it once and are gone from the next step
+func TestParallelEnvTruncation(t *testing.T) {
+	p := NewParallelEnv(parseTestLayout(t, teamLayout), 2)
+	p.Reset(1)
+	actions := map[string]int{"a1": Act_East, "a2": Act_None, "a3": Act_West}
+	for step := 1; step <= 2; step++ {
+		_, rewards, terminations, truncations, _, err := p.Step(actions)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for name := range actions {
+			if _, ok := rewards[name]; !ok {
+				t.Errorf("step %d: no reward for %s", step, name)
+			}
+			if terminations[name] || truncations[name] != (step == 2) {
+				t.Errorf("step %d: %s terminated %v, truncated %v", step, name, terminations[name], truncations[name])
+			}
+		}
+	}
+	if agents := p.Agents(); len(agents) != 0 {
+		t.Errorf("agents %v are still live after the episode was truncated", agents)
+	}
+}
@@ -0,0 +1,184 @@
+package overcooker
+
+// Observation channels, one grid plane each
+// an observation is every plane cell by cell (row by row), followed by what the agent holds
+const (
+	ObsSelf        = iota // the observing agent
+	ObsOtherAgents        // how many other agents stand here
+	ObsOnionRaw           // items on the floor
+	ObsOnionChopped
+	ObsSoup
+	ObsStationOnion // stations
+	ObsStationChop
+	ObsStationStove
+	ObsStationDelivery
+	ObsChannels // number of grid planes
+)
+
+// ObsHeldItems is the size of the one-hot held item section: empty, onion, chopped onion, soup
+const ObsHeldItems = 4
+
+// itemChannel returns the channel of an item name like "o" or "o1", -1 for unknown items
+func itemChannel(name string) int {
+	if name == "" {
+		return -1
+	}
+	switch name[0:1] {
+	case ItemOnionRaw:
+		return ObsOnionRaw
+	case ItemOnionChopped:
+		return ObsOnionChopped
+	case ItemSoup:
+		return ObsSoup
+	}
+	return -1
+}
+
+// heldIndex returns the held item slot of an inventory item name
+func heldIndex(name string) int {
+	switch itemChannel(name) {
+	case ObsOnionRaw:
+		return 1
+	case ObsOnionChopped:
+		return 2
+	case ObsSoup:
+		return 3
+	}
+	return 0
+}
+
+// obsGrid returns the grid observations cover, the kitchen's own unless ObsWidth and ObsHeight are set
+func (env *Environment) obsGrid() (width, height int) {
+	if env.ObsWidth > 0 && env.ObsHeight > 0 {
+		return env.ObsWidth, env.ObsHeight
+	}
+	return env.Width + 1, env.Height + 1
+}
+
+// inObsGrid reports whether a kitchen cell shows up in observations
+func (env *Environment) inObsGrid(x, y int) bool {
+	width, height := env.obsGrid()
+	return env.InBounds(x, y) && x < width && y < height
+}
+
+// ObservationSize returns the length of one agent's observation
+func (env *Environment) ObservationSize() int {
+	width, height := env.obsGrid()
+	return width*height*ObsChannels + ObsHeldItems
+}
+
+// Observe returns the grid observation of the agent at index agent
+func (env *Environment) Observe(agent int) []float32 {
+	obs := make([]float32, env.ObservationSize())
+	env.ObserveInto(agent, obs)
+	return obs
+}
+
+// ObserveInto writes the agent's observation into obs, which must be ObservationSize long
+func (env *Environment) ObserveInto(agent int, obs []float32) {
+	for i := range obs {
+		obs[i] = 0
+	}
+	width, height := env.obsGrid()
+	cell := func(x, y, channel int) int { return (y*width+x)*ObsChannels + channel }
+
+	for _, station := range env.Stations {
+		channel := -1
+		switch station.Name[0:1] {
+		case StationOnion:
+			channel = ObsStationOnion
+		case StationChop:
+			channel = ObsStationChop
+		case StationStove:
+			channel = ObsStationStove
+		case StationDelivery:
+			channel = ObsStationDelivery
+		}
+		if channel >= 0 && env.inObsGrid(station.X, station.Y) {
+			obs[cell(station.X, station.Y, channel)] = 1
+		}
+	}
+	for _, item := range env.Items {
+		if channel := itemChannel(item.Name); channel >= 0 && env.inObsGrid(item.X, item.Y) {
+			obs[cell(item.X, item.Y, channel)] = 1
+		}
+	}
+	for i, other := range env.Agents {
+		if !env.inObsGrid(other.X, other.Y) {
+			continue
+		}
+		if i == agent {
+			obs[cell(other.X, other.Y, ObsSelf)] = 1
+		} else {
+			obs[cell(other.X, other.Y, ObsOtherAgents)]++
+		}
+	}
+
+	held := width*height*ObsChannels + heldIndex("")
+	if agent >= 0 && agent < len(env.Agents) {
+		held += heldIndex(env.Agents[agent].Inventory.Name)
+	}
+	obs[held] = 1
+}
+
+// Global state channels, used by centralized critics
+// the same planes as an observation without the observer, plus what agents carry where
+const (
+	StateAgents   = iota // how many agents stand here
+	StateOnionRaw        // items on the floor
+	StateOnionChopped
+	StateSoup
+	StateStationOnion // stations
+	StateStationChop
+	StateStationStove
+	StateStationDelivery
+	StateHeldOnionRaw // agents here carrying each item
+	StateHeldOnionChopped
+	StateHeldSoup
+	StateChannels // number of grid planes
+)
+
+// GlobalStateSize returns the length of the global state
+func (env *Environment) GlobalStateSize() int {
+	width, height := env.obsGrid()
+	return width * height * StateChannels
+}
+
+// GlobalState returns the whole kitchen as grid planes, the same for every agent
+func (env *Environment) GlobalState() []float32 {
+	state := make([]float32, env.GlobalStateSize())
+	width, _ := env.obsGrid()
+	cell := func(x, y, channel int) int { return (y*width+x)*StateChannels + channel }
+
+	for _, station := range env.Stations {
+		if !env.inObsGrid(station.X, station.Y) {
+			continue
+		}
+		switch station.Name[0:1] {
+		case StationOnion:
+			state[cell(station.X, station.Y, StateStationOnion)] = 1
+		case StationChop:
+			state[cell(station.X, station.Y, StateStationChop)] = 1
+		case StationStove:
+			state[cell(station.X, station.Y, StateStationStove)] = 1
+		case StationDelivery:
+			state[cell(station.X, station.Y, StateStationDelivery)] = 1
+		}
+	}
+	for _, item := range env.Items {
+		if channel := itemChannel(item.Name); channel >= 0 && env.inObsGrid(item.X, item.Y) {
+			// item observation channels start at ObsOnionRaw, state channels at StateOnionRaw
+			state[cell(item.X, item.Y, channel-ObsOnionRaw+StateOnionRaw)] = 1
+		}
+	}
+	for _, agent := range env.Agents {
+		if !env.inObsGrid(agent.X, agent.Y) {
+			continue
+		}
+		state[cell(agent.X, agent.Y, StateAgents)]++
+		if held := heldIndex(agent.Inventory.Name); held > 0 {
+			state[cell(agent.X, agent.Y, StateHeldOnionRaw+held-1)]++
+		}
+	}
+	return state
+}
@@ -0,0 +1,247 @@
+package overcooker
+
+import "container/heap"
+
+// Unreachable is the distance to a cell that cannot be reached
+const Unreachable = -1
+
+// moveActions are the actions that change an agent's position
+var moveActions = []int{Act_North, Act_South, Act_East, Act_West}
+
+// DistanceField holds the number of steps from every cell to a goal cell
+type DistanceField struct {
+	Goal          Position
+	Width, Height int // grid size in cells
+	Dist          []int
+}
+
+// At returns the distance from x, y to the goal, or Unreachable
+func (d DistanceField) At(x, y int) int {
+	if x < 0 || x >= d.Width || y < 0 || y >= d.Height {
+		return Unreachable
+	}
+	return d.Dist[y*d.Width+x]
+}
+
+// BestAction returns the move that takes x, y closer to the goal
+// Act_None when already at the goal or when the goal is unreachable
+func (d DistanceField) BestAction(x, y int) int {
+	best := Act_None
+	bestDist := d.At(x, y)
+	if bestDist <= 0 {
+		return Act_None
+	}
+	for _, action := range moveActions {
+		next := Position{X: x, Y: y}.Move(action)
+		dist := d.At(next.X, next.Y)
+		if dist != Unreachable && dist < bestDist {
+			best = action
+			bestDist = dist
+		}
+	}
+	return best
+}
+
+// blocked reports whether a path may not pass through x, y
+// cells with an agent are blocked when avoiding agents
+func (env *Environment) blocked(x, y int, avoidAgents bool) bool {
+	if !env.InBounds(x, y) {
+		return true
+	}
+	return avoidAgents && env.GetAgentAt(x, y) != nil
+}
+
+// DistanceFieldTo runs a BFS outward from goal over the kitchen grid
+// With avoidAgents, occupied cells get a distance but are not walked through,
+// so an agent can still read the distance from the cell it stands on
+func (env *Environment) DistanceFieldTo(goal Position, avoidAgents bool) DistanceField {
+	width, height := env.Width+1, env.Height+1
+	field := DistanceField{Goal: goal, Width: width, Height: height, Dist: make([]int, width*height)}
+	for i := range field.Dist {
+		field.Dist[i] = Unreachable
+	}
+	if !env.InBounds(goal.X, goal.Y) {
+		return field
+	}
+
+	field.Dist[goal.Y*width+goal.X] = 0
+	queue := []Position{goal}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		// don't expand through other agents, the goal itself is always expanded
+		if cur != goal && env.blocked(cur.X, cur.Y, avoidAgents) {
+			continue
+		}
+		for _, action := range moveActions {
+			next := cur.Move(action)
+			if !env.InBounds(next.X, next.Y) || field.Dist[next.Y*width+next.X] != Unreachable {
+				continue
+			}
+			field.Dist[next.Y*width+next.X] = field.Dist[cur.Y*width+cur.X] + 1
+			queue = append(queue, next)
+		}
+	}
+	return field
+}
+
+// StationDistanceFields returns a distance field to every station, keyed by station name
+func (env *Environment) StationDistanceFields(avoidAgents bool) map[string]DistanceField {
+	fields := make(map[string]DistanceField, len(env.Stations))
+	for _, station := range env.Stations {
+		fields[station.Name] = env.DistanceFieldTo(Position{X: station.X, Y: station.Y}, avoidAgents)
+	}
+	return fields
+}
+
+// FindPath returns the shortest path from start to goal using A*
+// The path excludes start and ends with goal
+// With avoidAgents, cells holding other agents are treated as walls (except the goal)
+func (env *Environment) FindPath(start, goal Position, avoidAgents bool) ([]Position, bool) {
+	if !env.InBounds(start.X, start.Y) || !env.InBounds(goal.X, goal.Y) {
+		return nil, false
+	}
+	if start == goal {
+		return []Position{}, true
+	}
+
+	width := env.Width + 1
+	index := func(p Position) int { return p.Y*width + p.X }
+
+	cost := map[int]int{index(start): 0}
+	cameFrom := map[int]Position{}
+	open := &pathQueue{}
+	heap.Push(open, pathNode{pos: start, priority: manhattan(start, goal)})
+
+	for open.Len() > 0 {
+		cur := heap.Pop(open).(pathNode)
+		if cur.pos == goal {
+			// walk back to the start
+			path := []Position{}
+			for p := goal; p != start; p = cameFrom[index(p)] {
+				path = append(path, p)
+			}
+			for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+				path[i], path[j] = path[j], path[i]
+			}
+			return path, true
+		}
+		if cur.cost > cost[index(cur.pos)] {
+			continue // stale entry
+		}
+
+		for _, action := range moveActions {
+			next := cur.pos.Move(action)
+			if next != goal && env.blocked(next.X, next.Y, avoidAgents) {
+				continue
+			}
+			nextCost := cur.cost + 1
+			if old, seen := cost[index(next)]; seen && old <= nextCost {
+				continue
+			}
+			cost[index(next)] = nextCost
+			cameFrom[index(next)] = cur.pos
+			heap.Push(open, pathNode{pos: next, cost: nextCost, priority: nextCost + manhattan(next, goal)})
+		}
+	}
+	return nil, false
+}
+
+func manhattan(a, b Position) int {
+	dx, dy := a.X-b.X, a.Y-b.Y
+	if dx < 0 {
+		dx = -dx
+	}
+	if dy < 0 {
+		dy = -dy
+	}
+	return dx + dy
+}
+
+// pathNode is an entry in the A* open set
+type pathNode struct {
+	pos      Position
+	cost     int
+	priority int
+}
+
+// pathQueue is a min-heap of pathNodes, implements heap.Interface
+type pathQueue []pathNode
+
+func (q pathQueue) Len() int { return len(q) }
+func (q pathQueue) Less(i, j int) bool {
+	if q[i].priority != q[j].priority {
+		return q[i].priority < q[j].priority
+	}
+	// prefer nodes further along, keeps paths straight
+	return q[i].cost > q[j].cost
+}
+func (q pathQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *pathQueue) Push(x interface{}) { *q = append(*q, x.(pathNode)) }
+func (q *pathQueue) Pop() interface{} {
+	old := *q
+	n := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return n
+}
+
+// DistanceTable holds the static distance between every pair of cells
+// Agents are ignored, only the layout matters
+type DistanceTable struct {
+	Width, Height int // grid size in cells
+	dist          []int
+}
+
+// Distance returns the number of steps from a to b, or Unreachable
+func (t *DistanceTable) Distance(a, b Position) int {
+	if a.X < 0 || a.X >= t.Width || a.Y < 0 || a.Y >= t.Height ||
+		b.X < 0 || b.X >= t.Width || b.Y < 0 || b.Y >= t.Height {
+		return Unreachable
+	}
+	cells := t.Width * t.Height
+	return t.dist[(a.Y*t.Width+a.X)*cells+b.Y*t.Width+b.X]
+}
+
+// Distances returns the all-pairs distance table for this layout
+// It is computed on first use and kept on the environment, clones share it
+func (env *Environment) Distances() *DistanceTable {
+	if t := env.distances; t != nil && t.Width == env.Width+1 && t.Height == env.Height+1 {
+		return t
+	}
+
+	width, height := env.Width+1, env.Height+1
+	cells := width * height
+	table := &DistanceTable{Width: width, Height: height, dist: make([]int, cells*cells)}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			field := env.DistanceFieldTo(Position{X: x, Y: y}, false)
+			// distances are symmetric, the field to b is the row for b
+			copy(table.dist[(y*width+x)*cells:], field.Dist)
+		}
+	}
+	env.distances = table
+	return table
+}
+
+// NearestStation returns the closest station of a kind (StationOnion, StationChop...)
+// and its distance, or nil when there is none
+func (env *Environment) NearestStation(from Position, kind string) (*Station, int) {
+	table := env.Distances()
+	var nearest *Station
+	nearestDist := Unreachable
+	for i := range env.Stations {
+		station := &env.Stations[i]
+		if station.Name[0:1] != kind {
+			continue
+		}
+		dist := table.Distance(from, Position{X: station.X, Y: station.Y})
+		if dist == Unreachable {
+			continue
+		}
+		if nearest == nil || dist < nearestDist {
+			nearest = station
+			nearestDist = dist
+		}
+	}
+	return nearest, nearestDist
+}
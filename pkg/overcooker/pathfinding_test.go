@@ -0,0 +1,135 @@
+package overcooker
+
+import (
+	"strings"
+	"testing"
+)
+
+// a1, a2, a3 and a4 wall off the top left corner when paths avoid agents
+const pathLayout = `
+. . a1. .
+. . a2. O1
+a3a4. . .
+. . . . D1
+`
+
+func parseTestLayout(t *testing.T, text string) Environment {
+	t.Helper()
+	env, err := ParseLayout(strings.NewReader(text))
+	if err != nil {
+		t.Fatalf("parsing layout: %v", err)
+	}
+	env.Log = NewLogger(nil, LogQuiet)
+	return env
+}
+
+func TestFindPath(t *testing.T) {
+	env := parseTestLayout(t, pathLayout)
+	tests := []struct {
+		name        string
+		start, goal Position
+		avoidAgents bool
+		length      int // Unreachable when there is no path
+	}{
+		{"start is the goal", Position{X: 3, Y: 3}, Position{X: 3, Y: 3}, true, 0},
+		{"next cell", Position{X: 3, Y: 3}, Position{X: 4, Y: 3}, true, 1},
+		{"across the kitchen", Position{X: 4, Y: 3}, Position{X: 3, Y: 0}, true, 4},
+		{"around agents", Position{X: 2, Y: 2}, Position{X: 0, Y: 3}, true, 3},
+		{"through agents", Position{X: 4, Y: 0}, Position{X: 0, Y: 0}, false, 4},
+		{"walled off by agents", Position{X: 4, Y: 3}, Position{X: 0, Y: 0}, true, Unreachable},
+		{"out of the walled off corner", Position{X: 1, Y: 1}, Position{X: 4, Y: 3}, true, Unreachable},
+		{"onto an agent", Position{X: 3, Y: 1}, Position{X: 2, Y: 1}, true, 1},
+		{"goal out of bounds", Position{X: 0, Y: 3}, Position{X: 5, Y: 3}, false, Unreachable},
+		{"start out of bounds", Position{X: -1, Y: 0}, Position{X: 0, Y: 3}, false, Unreachable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, ok := env.FindPath(tt.start, tt.goal, tt.avoidAgents)
+			if tt.length == Unreachable {
+				if ok || path != nil {
+					t.Fatalf("FindPath = %v, %v, want no path", path, ok)
+				}
+			} else {
+				if !ok || len(path) != tt.length {
+					t.Fatalf("FindPath = %v, %v, want a path of %d steps", path, ok, tt.length)
+				}
+				checkPath(t, &env, tt.start, tt.goal, path, tt.avoidAgents)
+			}
+
+			field := env.DistanceFieldTo(tt.goal, tt.avoidAgents)
+			if got := field.At(tt.start.X, tt.start.Y); got != tt.length {
+				t.Errorf("distance field at %v = %d, want %d", tt.start, got, tt.length)
+			}
+		})
+	}
+}
+
+// A* and the BFS distance field agree on every pair of cells
+func TestFindPathMatchesDistanceField(t *testing.T) {
+	env := parseTestLayout(t, pathLayout)
+	for _, avoidAgents := range []bool{false, true} {
+		for gy := 0; gy <= env.Height; gy++ {
+			for gx := 0; gx <= env.Width; gx++ {
+				goal := Position{X: gx, Y: gy}
+				field := env.DistanceFieldTo(goal, avoidAgents)
+				for sy := 0; sy <= env.Height; sy++ {
+					for sx := 0; sx <= env.Width; sx++ {
+						start := Position{X: sx, Y: sy}
+						path, ok := env.FindPath(start, goal, avoidAgents)
+						want := field.At(sx, sy)
+						got := Unreachable
+						if ok {
+							got = len(path)
+						}
+						if got != want {
+							t.Errorf("avoidAgents %v, %v to %v: A* takes %d steps, BFS says %d", avoidAgents, start, goal, got, want)
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+// BestAction walks the distance field down to the goal
+func TestDistanceFieldBestAction(t *testing.T) {
+	env := parseTestLayout(t, pathLayout)
+	goal := Position{X: 4, Y: 1}
+	field := env.DistanceFieldTo(goal, true)
+	pos := Position{X: 0, Y: 3}
+	for steps := field.At(pos.X, pos.Y); steps > 0; steps-- {
+		action := field.BestAction(pos.X, pos.Y)
+		next := pos.Move(action)
+		if field.At(next.X, next.Y) != steps-1 {
+			t.Fatalf("BestAction at %v moves to %v, %d steps from the goal, want %d", pos, next, field.At(next.X, next.Y), steps-1)
+		}
+		pos = next
+	}
+	if pos != goal {
+		t.Errorf("stopped at %v, want %v", pos, goal)
+	}
+	if action := field.BestAction(goal.X, goal.Y); action != Act_None {
+		t.Errorf("BestAction at the goal = %d, want Act_None", action)
+	}
+	if action := field.BestAction(0, 0); action != Act_None {
+		t.Errorf("BestAction in the walled off corner = %d, want Act_None", action)
+	}
+}
+
+// checkPath verifies path walks from start to goal one cell at a time
+func checkPath(t *testing.T, env *Environment, start, goal Position, path []Position, avoidAgents bool) {
+	t.Helper()
+	prev := start
+	for i, p := range path {
+		if manhattan(prev, p) != 1 {
+			t.Fatalf("step %d jumps from %v to %v", i, prev, p)
+		}
+		if p != goal && env.blocked(p.X, p.Y, avoidAgents) {
+			t.Fatalf("step %d goes through blocked cell %v", i, p)
+		}
+		prev = p
+	}
+	if prev != goal {
+		t.Fatalf("path ends at %v, want %v", prev, goal)
+	}
+}
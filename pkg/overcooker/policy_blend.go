@@ -0,0 +1,271 @@
+package overcooker
+
+import (
+	"fmt"
+	"math"
+)
+
+// blendEpsilon keeps logs and ratios finite for zero probabilities
+const blendEpsilon = 1e-6
+
+// Entropy returns the Shannon entropy of the policy in nats
+func (p Policy) Entropy() float64 {
+	h := 0.0
+	for _, prob := range p {
+		if prob > 0 {
+			h -= float64(prob) * math.Log(float64(prob))
+		}
+	}
+	return h
+}
+
+// KL returns the Kullback-Leibler divergence KL(p || q) in nats
+func (p Policy) KL(q Policy) float64 {
+	kl := 0.0
+	for a := Act_None; a <= Act_Interact; a++ {
+		pa := float64(p[a])
+		if pa <= 0 {
+			continue
+		}
+		kl += pa * math.Log((pa+blendEpsilon)/(float64(q[a])+blendEpsilon))
+	}
+	return kl
+}
+
+// TotalVariation returns half the L1 distance between p and q
+func (p Policy) TotalVariation(q Policy) float64 {
+	tv := 0.0
+	for a := Act_None; a <= Act_Interact; a++ {
+		tv += math.Abs(float64(p[a]) - float64(q[a]))
+	}
+	return tv / 2
+}
+
+// checkBlendInputs validates maps and weights, nil weights mean equal weights
+func checkBlendInputs(maps []PolicyMap, weights []float64) ([]float64, error) {
+	if len(maps) == 0 {
+		return nil, fmt.Errorf("blend needs at least one policy map")
+	}
+	if weights == nil {
+		weights = make([]float64, len(maps))
+		for i := range weights {
+			weights[i] = 1
+		}
+	}
+	if len(weights) != len(maps) {
+		return nil, fmt.Errorf("got %d weights for %d policy maps", len(weights), len(maps))
+	}
+	total := 0.0
+	for _, w := range weights {
+		if w < 0 {
+			return nil, fmt.Errorf("negative blend weight %v", w)
+		}
+		total += w
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("blend weights sum to zero")
+	}
+	normalized := make([]float64, len(weights))
+	for i, w := range weights {
+		normalized[i] = w / total
+	}
+	return normalized, nil
+}
+
+// blendCells applies combine to the policies of every cell found in any map
+func blendCells(maps []PolicyMap, combine func(pos Position, policies []Policy) Policy) PolicyMap {
+	cells := PolicyMap{}
+	for _, pm := range maps {
+		for pos := range pm {
+			cells[pos] = nil
+		}
+	}
+	blended := make(PolicyMap, len(cells))
+	for pos := range cells {
+		policies := make([]Policy, len(maps))
+		for i, pm := range maps {
+			policies[i] = pm[pos]
+			if policies[i] == nil {
+				policies[i] = NewPolicy() // a map without the cell has no opinion
+			}
+		}
+		blended[pos] = combine(pos, policies)
+	}
+	return blended
+}
+
+// BlendAverage returns the weighted average of the maps, cell by cell
+// nil weights weigh every map equally
+func BlendAverage(maps []PolicyMap, weights []float64) (PolicyMap, error) {
+	weights, err := checkBlendInputs(maps, weights)
+	if err != nil {
+		return nil, err
+	}
+	return blendCells(maps, func(_ Position, policies []Policy) Policy {
+		blended := make(Policy, Act_Interact+1)
+		for a := Act_None; a <= Act_Interact; a++ {
+			for i, p := range policies {
+				blended[a] += float32(weights[i]) * p[a]
+			}
+		}
+		blended.Normalize()
+		return blended
+	}), nil
+}
+
+// BlendProduct returns the weighted product of experts: prod p_i^w_i, renormalized
+// actions any expert rules out stay (nearly) ruled out
+func BlendProduct(maps []PolicyMap, weights []float64) (PolicyMap, error) {
+	weights, err := checkBlendInputs(maps, weights)
+	if err != nil {
+		return nil, err
+	}
+	return blendCells(maps, func(_ Position, policies []Policy) Policy {
+		logits := make([]float64, Act_Interact+1)
+		maxLogit := math.Inf(-1)
+		for a := range logits {
+			for i, p := range policies {
+				logits[a] += weights[i] * math.Log(float64(p[a])+blendEpsilon)
+			}
+			maxLogit = math.Max(maxLogit, logits[a])
+		}
+		blended := make(Policy, Act_Interact+1)
+		for a, logit := range logits {
+			blended[a] = float32(math.Exp(logit - maxLogit))
+		}
+		blended.Normalize()
+		return blended
+	}), nil
+}
+
+// BlendMaxEntropy mixes the maps so every cell gets the most uncommitted consensus:
+// the mixture sum w_i p_i with the highest entropy over all mixture weights w
+// where the experts agree it stays sharp, where they disagree it spreads out
+func BlendMaxEntropy(maps []PolicyMap) (PolicyMap, error) {
+	if _, err := checkBlendInputs(maps, nil); err != nil {
+		return nil, err
+	}
+	return blendCells(maps, func(_ Position, policies []Policy) Policy {
+		return maxEntropyMixture(policies)
+	}), nil
+}
+
+// maxEntropyMixture finds the mixture weights by exponentiated gradient ascent
+// entropy is concave in the mixture, so this converges to the maximum
+func maxEntropyMixture(policies []Policy) Policy {
+	weights := make([]float64, len(policies))
+	for i := range weights {
+		weights[i] = 1 / float64(len(policies))
+	}
+	mix := func() []float64 {
+		m := make([]float64, Act_Interact+1)
+		for i, p := range policies {
+			for a := range m {
+				m[a] += weights[i] * float64(p[a])
+			}
+		}
+		return m
+	}
+
+	const steps = 100
+	const stepSize = 0.5
+	for s := 0; s < steps; s++ {
+		m := mix()
+		// dH/dw_i = -sum_a p_i(a) (log m(a) + 1)
+		maxGrad := math.Inf(-1)
+		grads := make([]float64, len(policies))
+		for i, p := range policies {
+			for a := range m {
+				grads[i] -= float64(p[a]) * (math.Log(m[a]+blendEpsilon) + 1)
+			}
+			maxGrad = math.Max(maxGrad, grads[i])
+		}
+		total := 0.0
+		for i := range weights {
+			weights[i] *= math.Exp(stepSize * (grads[i] - maxGrad))
+			total += weights[i]
+		}
+		for i := range weights {
+			weights[i] /= total
+		}
+	}
+
+	blended := make(Policy, Act_Interact+1)
+	for a, prob := range mix() {
+		blended[a] = float32(prob)
+	}
+	blended.Normalize()
+	return blended
+}
+
+// OverrideRegion returns a copy of pm where every cell in the rectangle
+// from..to (inclusive) takes its policy from overlay
+// cells the overlay doesn't define keep the base policy
+func (pm PolicyMap) OverrideRegion(overlay PolicyMap, from, to Position) PolicyMap {
+	minX, maxX := from.X, to.X
+	if minX > maxX {
+		minX, maxX = maxX, minX
+	}
+	minY, maxY := from.Y, to.Y
+	if minY > maxY {
+		minY, maxY = maxY, minY
+	}
+	return pm.OverrideMask(overlay, func(pos Position) bool {
+		return pos.X >= minX && pos.X <= maxX && pos.Y >= minY && pos.Y <= maxY
+	})
+}
+
+// OverrideMask returns a copy of pm where cells selected by mask take the overlay's policy
+func (pm PolicyMap) OverrideMask(overlay PolicyMap, mask func(Position) bool) PolicyMap {
+	result := pm.Clone()
+	for pos, policy := range overlay {
+		if mask(pos) {
+			result[pos] = policy.Clone()
+		}
+	}
+	return result
+}
+
+// CellDiff compares two policies at one cell
+type CellDiff struct {
+	KL             float64 // KL(a || b)
+	TotalVariation float64
+}
+
+// Diff compares pm with other cell by cell
+// cells missing from one map are compared against the uniform policy
+func (pm PolicyMap) Diff(other PolicyMap) map[Position]CellDiff {
+	diff := map[Position]CellDiff{}
+	blendCells([]PolicyMap{pm, other}, func(pos Position, policies []Policy) Policy {
+		diff[pos] = CellDiff{
+			KL:             policies[0].KL(policies[1]),
+			TotalVariation: policies[0].TotalVariation(policies[1]),
+		}
+		return nil
+	})
+	return diff
+}
+
+// PolicyMapDistance summarizes how far apart two policy maps are
+type PolicyMapDistance struct {
+	MeanKL, MaxKL float64
+	MeanTV, MaxTV float64
+}
+
+// Distance summarizes Diff over all cells
+func (pm PolicyMap) Distance(other PolicyMap) PolicyMapDistance {
+	dist := PolicyMapDistance{}
+	diff := pm.Diff(other)
+	if len(diff) == 0 {
+		return dist
+	}
+	for _, cell := range diff {
+		dist.MeanKL += cell.KL
+		dist.MeanTV += cell.TotalVariation
+		dist.MaxKL = math.Max(dist.MaxKL, cell.KL)
+		dist.MaxTV = math.Max(dist.MaxTV, cell.TotalVariation)
+	}
+	dist.MeanKL /= float64(len(diff))
+	dist.MeanTV /= float64(len(diff))
+	return dist
+}
@@ -0,0 +1,71 @@
+package overcooker
+
+import "testing"
+
+func TestBlendsStayNormalized(t *testing.T) {
+	supervisor := NewSupervisor(quietEnvironment, 3)
+	supervisor.Concentration = 0.3 // spiky maps with near zero probabilities
+	maps := []PolicyMap{supervisor.RandomMap(), supervisor.RandomMap(), supervisor.ArrowMap(StationOnion)}
+	// a map covering only part of the kitchen
+	partial := PolicyMap{}
+	for pos, policy := range supervisor.RandomMap() {
+		if pos.X < 3 {
+			partial[pos] = policy
+		}
+	}
+	maps = append(maps, partial)
+
+	blends := map[string]func() (PolicyMap, error){
+		"average":          func() (PolicyMap, error) { return BlendAverage(maps, nil) },
+		"weighted average": func() (PolicyMap, error) { return BlendAverage(maps, []float64{3, 0, 1, 2}) },
+		"product":          func() (PolicyMap, error) { return BlendProduct(maps, nil) },
+		"weighted product": func() (PolicyMap, error) { return BlendProduct(maps, []float64{0.5, 2, 1, 0}) },
+		"max entropy":      func() (PolicyMap, error) { return BlendMaxEntropy(maps) },
+	}
+	for name, blend := range blends {
+		t.Run(name, func(t *testing.T) {
+			blended, err := blend()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(blended) != len(maps[0]) {
+				t.Errorf("blend has %d cells, want %d", len(blended), len(maps[0]))
+			}
+			checkPolicyMapNormalized(t, blended, name, 0)
+		})
+	}
+}
+
+// blending a map with itself gives it back
+func TestBlendOfOneMap(t *testing.T) {
+	pm := NewSupervisor(quietEnvironment, 5).RandomMap()
+	for name, blend := range map[string]func([]PolicyMap) (PolicyMap, error){
+		"average":     func(maps []PolicyMap) (PolicyMap, error) { return BlendAverage(maps, nil) },
+		"product":     func(maps []PolicyMap) (PolicyMap, error) { return BlendProduct(maps, nil) },
+		"max entropy": BlendMaxEntropy,
+	} {
+		blended, err := blend([]PolicyMap{pm, pm})
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if dist := pm.Distance(blended); dist.MaxTV > 1e-4 {
+			t.Errorf("%s of a map with itself is %v away from it", name, dist.MaxTV)
+		}
+	}
+}
+
+func TestBlendRejectsBadWeights(t *testing.T) {
+	pm := NewPolicyMap(quietEnvironment())
+	for name, weights := range map[string][]float64{
+		"too few":  {1},
+		"negative": {1, -1},
+		"all zero": {0, 0},
+	} {
+		if _, err := BlendAverage([]PolicyMap{pm, pm}, weights); err == nil {
+			t.Errorf("%s weights: no error", name)
+		}
+	}
+	if _, err := BlendProduct(nil, nil); err == nil {
+		t.Errorf("no maps: no error")
+	}
+}
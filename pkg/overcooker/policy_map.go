@@ -34,10 +34,23 @@ func NewPolicy() Policy {
 
 // GetActionProba returns an action based on the policy
 func (p Policy) GetActionProba() int {
-	r := rand.Float32() // Random number between 0 and 1
+	return p.sample(rand.Float32())
+}
+
+// GetActionProbaRand is GetActionProba drawing from the given random source
+func (p Policy) GetActionProbaRand(r *rand.Rand) int {
+	return p.sample(r.Float32())
+}
+
+// sample walks the actions in order so a seeded source gives repeatable picks
+func (p Policy) sample(r float32) int {
 	cumulative := float32(0.0)
 
-	for action, prob := range p {
+	for action := Act_None; action <= Act_Interact; action++ {
+		prob, ok := p[action]
+		if !ok {
+			continue
+		}
 		cumulative += prob
 		if r <= cumulative {
 			return action
@@ -48,8 +61,16 @@ func (p Policy) GetActionProba() int {
 	return Act_None
 }
 
+// DefaultPolicyLearningRate is how quickly Update adapts to new rewards
+const DefaultPolicyLearningRate = 0.1
+
 // Update updates the policy based on the reward
 func (p Policy) Update(position Position, action int, reward float32) Policy {
+	return p.UpdateRate(position, action, reward, DefaultPolicyLearningRate)
+}
+
+// UpdateRate is Update with the learning rate as a parameter
+func (p Policy) UpdateRate(position Position, action int, reward, learningRate float32) Policy {
 	// Update the policy based on the reward
 	// agentPolicy = agentPolicy.Update(agentPos, agentAction, agentReward)
 
@@ -59,9 +80,6 @@ func (p Policy) Update(position Position, action int, reward float32) Policy {
 		newPolicy[a] = prob
 	}
 
-	// Learning parameters
-	learningRate := float32(0.1) // How quickly to adapt to new rewards
-
 	// Skip update for zero rewards to avoid reinforcing neutral actions
 	if reward == 0 {
 		return newPolicy
@@ -95,8 +113,9 @@ func (p Policy) Update(position Position, action int, reward float32) Policy {
 	remainingProb := float32(1.0) - newPolicy[action]
 
 	// Calculate total probability of other actions before normalization
+	// summed in action order, float sums in map order differ from run to run
 	totalOtherProb := float32(0.0)
-	for a := range newPolicy {
+	for a := Act_None; a <= Act_Interact; a++ {
 		if a != action {
 			totalOtherProb += newPolicy[a]
 		}
@@ -128,8 +147,10 @@ func (p Policy) GetActionBest() int {
 	// For now, just return the most probable action
 	bestAction := Act_None
 
+	// walk the actions in order so ties always break the same way
 	bestProb := float32(0.0)
-	for action, prob := range p {
+	for action := Act_None; action <= Act_Interact; action++ {
+		prob := p[action]
 		if prob > bestProb {
 			bestProb = prob
 			bestAction = action
@@ -137,3 +158,39 @@ func (p Policy) GetActionBest() int {
 	}
 	return bestAction
 }
+
+// Clone returns a deep copy of the policy map
+func (pm PolicyMap) Clone() PolicyMap {
+	clone := make(PolicyMap, len(pm))
+	for pos, policy := range pm {
+		clone[pos] = policy.Clone()
+	}
+	return clone
+}
+
+// Clone returns a copy of the policy
+func (p Policy) Clone() Policy {
+	clone := make(Policy, len(p))
+	for a, prob := range p {
+		clone[a] = prob
+	}
+	return clone
+}
+
+// Normalize rescales the probabilities in place so they sum to 1
+// an empty or all-zero policy becomes uniform
+func (p Policy) Normalize() {
+	total := float32(0.0)
+	for a := Act_None; a <= Act_Interact; a++ {
+		total += p[a]
+	}
+	if total <= 0 {
+		for a := Act_None; a <= Act_Interact; a++ {
+			p[a] = float32(1.0 / (Act_Interact + 1))
+		}
+		return
+	}
+	for a, prob := range p {
+		p[a] = prob / total
+	}
+}
@@ -0,0 +1,194 @@
+package overcooker
+
+import (
+	"math"
+	"math/rand"
+)
+
+// ReinforceConfig configures the REINFORCE learner
+type ReinforceConfig struct {
+	LearningRate float64 `json:"learning_rate"` // step size on the logits
+	BaselineRate float64 `json:"baseline_rate"` // step size of the per-state baseline
+	Gamma        float64 `json:"gamma"`         // discount for returns
+	EntropyCoef  float64 `json:"entropy_coef"`  // weight of the entropy bonus, keeps policies from collapsing early
+	Seed         int64   `json:"-"`
+}
+
+// DefaultReinforceConfig returns settings that learn steadily on SimpleEnvironment
+func DefaultReinforceConfig() ReinforceConfig {
+	return ReinforceConfig{
+		LearningRate: 0.1,
+		BaselineRate: 0.1,
+		Gamma:        0.95,
+		EntropyCoef:  0.01,
+		Seed:         1,
+	}
+}
+
+// reinforceStep is one decision of one agent
+type reinforceStep struct {
+	pos    Position
+	action int
+	probs  []float64 // the policy the action was sampled from
+	reward float64
+}
+
+// ReinforceLearner is REINFORCE over a tabular softmax policy
+// every cell holds logits for the six actions and a learned baseline,
+// the state is the agent's position like the policy map so the two compare on equal footing
+// updates happen at the end of each episode, so give the Trainer a MaxEpisodeSteps
+type ReinforceLearner struct {
+	Config   ReinforceConfig
+	Logits   map[Position][]float64
+	Baseline map[Position]float64
+
+	trajectories map[string][]reinforceStep // per agent name, for the current episode
+	agentOrder   []string                   // names in the order they first acted, updates follow it
+	rng          *rand.Rand
+}
+
+// NewReinforceLearner creates a learner with zero logits (a uniform policy) for env
+func NewReinforceLearner(env Environment, config ReinforceConfig) *ReinforceLearner {
+	l := &ReinforceLearner{
+		Config:   config,
+		Logits:   map[Position][]float64{},
+		Baseline: map[Position]float64{},
+		rng:      rand.New(rand.NewSource(config.Seed)),
+	}
+	for y := 0; y < env.Height+1; y++ {
+		for x := 0; x < env.Width+1; x++ {
+			l.Logits[Position{X: x, Y: y}] = make([]float64, Act_Interact+1)
+		}
+	}
+	return l
+}
+
+// probs returns the softmax policy at a position
+func (l *ReinforceLearner) probs(pos Position) []float64 {
+	logits, ok := l.Logits[pos]
+	if !ok {
+		logits = make([]float64, Act_Interact+1)
+		l.Logits[pos] = logits
+	}
+	return softmax(logits)
+}
+
+// Act samples each agent's action from the softmax at its position
+func (l *ReinforceLearner) Act(env *Environment) []int {
+	if l.trajectories == nil {
+		l.trajectories = map[string][]reinforceStep{}
+	}
+	actions := make([]int, len(env.Agents))
+	for i, agent := range env.Agents {
+		pos := Position{X: agent.X, Y: agent.Y}
+		probs := l.probs(pos)
+		actions[i] = sampleIndex(l.rng, probs)
+		if _, ok := l.trajectories[agent.Name]; !ok {
+			l.agentOrder = append(l.agentOrder, agent.Name)
+		}
+		l.trajectories[agent.Name] = append(l.trajectories[agent.Name], reinforceStep{pos: pos, action: actions[i], probs: probs})
+	}
+	return actions
+}
+
+// Learn records the rewards, the policy only changes at the end of the episode
+func (l *ReinforceLearner) Learn(env *Environment, actions []int, rewards []float32, done, truncated bool) {
+	for i, agent := range env.Agents {
+		trajectory := l.trajectories[agent.Name]
+		if len(trajectory) == 0 || i >= len(rewards) {
+			continue // joined after Act, it took no action yet
+		}
+		trajectory[len(trajectory)-1].reward = float64(rewards[i])
+	}
+}
+
+// EndEpisode applies the policy gradient for every agent's trajectory,
+// agents that left mid-episode included
+func (l *ReinforceLearner) EndEpisode(episodeReturn float64) {
+	for _, name := range l.agentOrder {
+		l.update(l.trajectories[name])
+		l.trajectories[name] = l.trajectories[name][:0]
+	}
+}
+
+// update does one REINFORCE pass with baseline and entropy bonus over a trajectory
+func (l *ReinforceLearner) update(trajectory []reinforceStep) {
+	ret := 0.0
+	for t := len(trajectory) - 1; t >= 0; t-- {
+		step := trajectory[t]
+		ret = step.reward + l.Config.Gamma*ret
+
+		// the baseline tracks the expected return from this cell
+		advantage := ret - l.Baseline[step.pos]
+		l.Baseline[step.pos] += l.Config.BaselineRate * advantage
+
+		// take the gradient under the policy that sampled the action,
+		// the logits may have moved since, earlier in this update
+		logits := l.Logits[step.pos]
+		probs := step.probs
+		entropy := 0.0
+		for _, p := range probs {
+			if p > 0 {
+				entropy -= p * math.Log(p)
+			}
+		}
+		for a := range logits {
+			// d log pi(action) / d logit_a = 1[a == action] - pi(a)
+			gradLogProb := -probs[a]
+			if a == step.action {
+				gradLogProb += 1
+			}
+			// d H / d logit_a = -pi(a) (log pi(a) + H)
+			gradEntropy := 0.0
+			if probs[a] > 0 {
+				gradEntropy = -probs[a] * (math.Log(probs[a]) + entropy)
+			}
+			logits[a] += l.Config.LearningRate * (advantage*gradLogProb + l.Config.EntropyCoef*gradEntropy)
+		}
+	}
+}
+
+// PolicyMap returns the current softmax policies as a PolicyMap
+// so they can be rendered, blended, evaluated and compared with the heuristic learner
+func (l *ReinforceLearner) PolicyMap() PolicyMap {
+	pm := make(PolicyMap, len(l.Logits))
+	for pos, logits := range l.Logits {
+		policy := make(Policy, len(logits))
+		for a, p := range softmax(logits) {
+			policy[a] = float32(p)
+		}
+		pm[pos] = policy
+	}
+	return pm
+}
+
+// softmax returns exp(x) / sum(exp(x)), shifted for numerical stability
+func softmax(logits []float64) []float64 {
+	maxLogit := math.Inf(-1)
+	for _, x := range logits {
+		maxLogit = math.Max(maxLogit, x)
+	}
+	probs := make([]float64, len(logits))
+	total := 0.0
+	for i, x := range logits {
+		probs[i] = math.Exp(x - maxLogit)
+		total += probs[i]
+	}
+	for i := range probs {
+		probs[i] /= total
+	}
+	return probs
+}
+
+// sampleIndex draws an index with the given probabilities
+func sampleIndex(r *rand.Rand, probs []float64) int {
+	u := r.Float64()
+	cumulative := 0.0
+	for i, p := range probs {
+		cumulative += p
+		if u <= cumulative {
+			return i
+		}
+	}
+	return len(probs) - 1
+}
@@ -0,0 +1,131 @@
+package overcooker
+
+import (
+	"math"
+	"math/rand"
+)
+
+// Transition is one (possibly n-step) experience for value learning
+type Transition struct {
+	Obs       []float32
+	Action    int
+	Reward    float32 // discounted sum of the rewards over the n steps
+	NextObs   []float32
+	Done      bool    // the episode ended here
+	Truncated bool    // it ended on a time limit, NextObs still has a value to bootstrap from
+	Discount  float32 // gamma^n, what the bootstrap value is multiplied by
+}
+
+// ReplayBuffer stores transitions in a ring and samples minibatches
+// uniformly, or in proportion to their TD error when prioritized
+type ReplayBuffer struct {
+	Capacity    int
+	Prioritized bool
+	Alpha       float64 // how strongly priorities shape sampling, 0 is uniform
+
+	items       []Transition
+	next        int
+	tree        []float64 // sum tree over priorities^alpha, leaves start at Capacity
+	maxPriority float64
+}
+
+// NewReplayBuffer creates an empty buffer
+func NewReplayBuffer(capacity int, prioritized bool, alpha float64) *ReplayBuffer {
+	b := &ReplayBuffer{Capacity: capacity, Prioritized: prioritized, Alpha: alpha, maxPriority: 1}
+	if prioritized {
+		b.tree = make([]float64, 2*capacity)
+	}
+	return b
+}
+
+// Len returns the number of stored transitions
+func (b *ReplayBuffer) Len() int {
+	return len(b.items)
+}
+
+// Add stores a transition, overwriting the oldest once full
+// new transitions get the highest priority seen so they are replayed at least once
+func (b *ReplayBuffer) Add(t Transition) {
+	index := b.next
+	if len(b.items) < b.Capacity {
+		b.items = append(b.items, t)
+	} else {
+		b.items[index] = t
+	}
+	b.next = (b.next + 1) % b.Capacity
+	if b.Prioritized {
+		b.setPriority(index, b.maxPriority)
+	}
+}
+
+// Sample draws n transitions, with importance weights that correct for prioritized sampling
+// beta anneals the correction, 1 corrects fully, the weights are 1 without priorities
+func (b *ReplayBuffer) Sample(n int, beta float64, r *rand.Rand) (indices []int, batch []Transition, weights []float32) {
+	indices = make([]int, n)
+	batch = make([]Transition, n)
+	weights = make([]float32, n)
+	if !b.Prioritized {
+		for i := range indices {
+			indices[i] = r.Intn(len(b.items))
+			batch[i] = b.items[indices[i]]
+			weights[i] = 1
+		}
+		return indices, batch, weights
+	}
+
+	total := b.tree[1]
+	maxWeight := 0.0
+	raw := make([]float64, n)
+	for i := range indices {
+		// stratified: one draw from each equal slice of the total priority
+		u := (float64(i) + r.Float64()) * total / float64(n)
+		indices[i] = b.find(u)
+		batch[i] = b.items[indices[i]]
+		prob := b.tree[b.Capacity+indices[i]] / total
+		raw[i] = math.Pow(float64(len(b.items))*prob, -beta)
+		maxWeight = math.Max(maxWeight, raw[i])
+	}
+	for i := range weights {
+		weights[i] = float32(raw[i] / maxWeight)
+	}
+	return indices, batch, weights
+}
+
+// UpdatePriorities sets the priorities of sampled transitions from their TD errors
+func (b *ReplayBuffer) UpdatePriorities(indices []int, tdErrors []float32) {
+	if !b.Prioritized {
+		return
+	}
+	for i, index := range indices {
+		priority := math.Abs(float64(tdErrors[i])) + 1e-3
+		b.maxPriority = math.Max(b.maxPriority, priority)
+		b.setPriority(index, priority)
+	}
+}
+
+func (b *ReplayBuffer) setPriority(index int, priority float64) {
+	node := b.Capacity + index
+	b.tree[node] = math.Pow(priority, b.Alpha)
+	for node /= 2; node >= 1; node /= 2 {
+		b.tree[node] = b.tree[2*node] + b.tree[2*node+1]
+	}
+}
+
+// find walks the sum tree to the leaf holding cumulative priority u
+func (b *ReplayBuffer) find(u float64) int {
+	node := 1
+	for node < b.Capacity {
+		left := 2 * node
+		if u <= b.tree[left] || b.tree[left+1] == 0 {
+			node = left
+		} else {
+			u -= b.tree[left]
+			node = left + 1
+		}
+	}
+	index := node - b.Capacity
+	if index >= len(b.items) {
+		index = len(b.items) - 1
+	}
+	return index
+}
@@ -0,0 +1,108 @@
+package overcooker
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// prioritizedBuffer holds one transition per priority, Action is the transition's index
+func prioritizedBuffer(priorities []float64, alpha float64) *ReplayBuffer {
+	b := NewReplayBuffer(len(priorities), true, alpha)
+	indices := make([]int, len(priorities))
+	tdErrors := make([]float32, len(priorities))
+	for i, p := range priorities {
+		b.Add(Transition{Action: i})
+		indices[i] = i
+		tdErrors[i] = float32(p - 1e-3) // UpdatePriorities adds 1e-3
+	}
+	b.UpdatePriorities(indices, tdErrors)
+	return b
+}
+
+// transitions are sampled in proportion to priority^alpha
+func TestReplayBufferSamplingProportions(t *testing.T) {
+	// 5 leaves, a capacity that isn't a power of two
+	priorities := []float64{1, 2, 3, 4, 10}
+	for _, alpha := range []float64{0, 0.5, 1} {
+		b := prioritizedBuffer(priorities, alpha)
+		want := make([]float64, len(priorities))
+		total := 0.0
+		for i, p := range priorities {
+			want[i] = math.Pow(p, alpha)
+			total += want[i]
+		}
+		if math.Abs(b.tree[1]-total) > 1e-5 {
+			t.Errorf("alpha %v: the sum tree's root is %v, want %v", alpha, b.tree[1], total)
+		}
+
+		r := rand.New(rand.NewSource(1))
+		counts := make([]int, len(priorities))
+		const draws = 20000
+		for n := 0; n < draws/20; n++ {
+			indices, batch, _ := b.Sample(20, 0.4, r)
+			for i, index := range indices {
+				if batch[i].Action != index {
+					t.Fatalf("sampled index %d with transition %d", index, batch[i].Action)
+				}
+				counts[index]++
+			}
+		}
+		for i := range counts {
+			got := float64(counts[i]) / draws
+			if math.Abs(got-want[i]/total) > 0.01 {
+				t.Errorf("alpha %v: transition %d sampled %.3f of the time, want %.3f", alpha, i, got, want[i]/total)
+			}
+		}
+	}
+}
+
+// importance weights are (N P(i))^-beta scaled so the largest is 1
+func TestReplayBufferImportanceWeights(t *testing.T) {
+	priorities := []float64{1, 2, 4, 8}
+	b := prioritizedBuffer(priorities, 1)
+	r := rand.New(rand.NewSource(2))
+	for _, beta := range []float64{0, 0.4, 1} {
+		indices, _, weights := b.Sample(64, beta, r)
+		maxWeight := float32(0)
+		for i, index := range indices {
+			maxWeight = max(maxWeight, weights[i])
+			// relative to the lowest priority, which is always sampled in a batch this size
+			want := math.Pow(priorities[index]/priorities[0], -beta)
+			if math.Abs(float64(weights[i])-want) > 1e-5 {
+				t.Errorf("beta %v: weight of transition %d = %v, want %v", beta, index, weights[i], want)
+			}
+		}
+		if maxWeight != 1 {
+			t.Errorf("beta %v: the largest weight is %v, want 1", beta, maxWeight)
+		}
+	}
+
+	uniform := NewReplayBuffer(4, false, 0)
+	for i := 0; i < 4; i++ {
+		uniform.Add(Transition{Action: i})
+	}
+	_, _, weights := uniform.Sample(8, 1, r)
+	for _, w := range weights {
+		if w != 1 {
+			t.Fatalf("uniform replay weight %v, want 1", w)
+		}
+	}
+}
+
+// a full buffer overwrites its oldest transitions first
+func TestReplayBufferOverwritesOldest(t *testing.T) {
+	b := NewReplayBuffer(3, true, 1)
+	for i := 0; i < 5; i++ {
+		b.Add(Transition{Action: i})
+	}
+	if b.Len() != 3 {
+		t.Fatalf("Len = %d, want 3", b.Len())
+	}
+	want := []int{3, 4, 2}
+	for i, tr := range b.items {
+		if tr.Action != want[i] {
+			t.Errorf("slot %d holds transition %d, want %d", i, tr.Action, want[i])
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package overcooker
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// RewardConfig holds the point values Step hands out
+// the Reward constants are the defaults
+type RewardConfig struct {
+	Pickup        float64 `json:"pickup"`
+	OnionGet      float64 `json:"onion_get"`
+	OnionChop     float64 `json:"onion_chop"`
+	OnionCook     float64 `json:"onion_cook"`
+	DeliverSoup   float64 `json:"deliver_soup"`
+	InvalidAction float64 `json:"invalid_action"`
+	Stalling      float64 `json:"stalling"`
+}
+
+// DefaultRewardConfig returns the reward values the game always used
+func DefaultRewardConfig() RewardConfig {
+	return RewardConfig{
+		Pickup:        RewardPickup,
+		OnionGet:      RewardOnionGet,
+		OnionChop:     RewardOnionChop,
+		OnionCook:     RewardOnionCook,
+		DeliverSoup:   RewardDeliverSoup,
+		InvalidAction: RewardInvalidAction,
+		Stalling:      RewardStalling,
+	}
+}
+
+// defaultRewards is used by environments without a reward config
+var defaultRewards = DefaultRewardConfig()
+
+// LoadRewardConfig reads a JSON reward config, missing fields keep their defaults
+func LoadRewardConfig(path string) (RewardConfig, error) {
+	config := DefaultRewardConfig()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return config, fmt.Errorf("reading reward config %s: %w", path, err)
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return config, fmt.Errorf("parsing reward config %s: %w", path, err)
+	}
+	return config, nil
+}
+
+// rewardConfig returns the environment's rewards, the defaults when none were set
+func (env *Environment) rewardConfig() *RewardConfig {
+	if env.Rewards == nil {
+		return &defaultRewards
+	}
+	return env.Rewards
+}
@@ -0,0 +1,219 @@
+package overcooker
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// agents can join and leave the kitchen mid-episode, a chef arrives or goes home
+// an agent's name is its ID: learners, controllers, metrics and the multi-agent APIs key agents by name,
+// indexes shift when an agent leaves, so only rely on one between two roster changes
+
+// AddAgent brings a new agent into the kitchen at (x, y), empty handed
+// the name must be unique and the cell in the kitchen and free of agents
+func (env *Environment) AddAgent(name string, x, y int) error {
+	if name == "" {
+		return fmt.Errorf("an agent needs a name")
+	}
+	if env.agentIndex(name) >= 0 {
+		return fmt.Errorf("agent %s is already in the kitchen", name)
+	}
+	if !env.InBounds(x, y) {
+		return fmt.Errorf("agent %s can't join at (%d,%d), outside the kitchen", name, x, y)
+	}
+	if other := env.GetAgentAt(x, y); other != nil {
+		return fmt.Errorf("agent %s can't join at (%d,%d), %s stands there", name, x, y, other.Name)
+	}
+	env.Agents = append(env.Agents, Agent{Name: name, X: x, Y: y})
+	env.Reindex()
+	env.CheckEventCountsmap()
+	env.EventCountsmap["agent_join"]++
+	return nil
+}
+
+// RemoveAgent takes an agent out of the kitchen
+// what it holds is dropped on the nearest cell without an agent, station or item,
+// only a full kitchen loses it, counted as an item_lost event
+// it returns whether an item was dropped
+func (env *Environment) RemoveAgent(name string) (dropped bool, err error) {
+	i := env.agentIndex(name)
+	if i < 0 {
+		return false, fmt.Errorf("no agent %s", name)
+	}
+	agent := env.Agents[i]
+	env.Agents = append(env.Agents[:i], env.Agents[i+1:]...)
+	env.Reindex()
+	env.CheckEventCountsmap()
+	env.EventCountsmap["agent_leave"]++
+	if agent.Inventory.Name != "" {
+		pos, ok := env.cellNear(agent.X, agent.Y, func(x, y int) bool {
+			return env.GetAgentAt(x, y) == nil && env.GetStationAt(x, y) == nil && env.GetItemAt(x, y) == nil
+		})
+		if !ok {
+			env.EventCountsmap["item_lost"]++
+			return false, nil
+		}
+		env.Items = append(env.Items, Item{Name: agent.Inventory.Name, X: pos.X, Y: pos.Y})
+		env.Reindex()
+		dropped = true
+	}
+	return dropped, nil
+}
+
+// agentIndex returns the index of the named agent, -1 when there's none
+func (env *Environment) agentIndex(name string) int {
+	for i, agent := range env.Agents {
+		if agent.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// freeCellNear returns the cell without an agent closest to (x, y)
+func (env *Environment) freeCellNear(x, y int) (Position, bool) {
+	return env.cellNear(x, y, func(x, y int) bool { return env.GetAgentAt(x, y) == nil })
+}
+
+// cellNear returns the cell closest to (x, y) that free accepts, searching outwards ring by ring
+func (env *Environment) cellNear(x, y int, free func(x, y int) bool) (Position, bool) {
+	for r := 0; r <= env.Width+env.Height; r++ {
+		for dy := -r; dy <= r; dy++ {
+			for dx := -r; dx <= r; dx++ {
+				if abs(dx)+abs(dy) != r {
+					continue
+				}
+				if env.InBounds(x+dx, y+dy) && free(x+dx, y+dy) {
+					return Position{X: x + dx, Y: y + dy}, true
+				}
+			}
+		}
+	}
+	return Position{}, false
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// RosterChange is an agent joining or leaving before a step of an episode
+type RosterChange struct {
+	Step  int    `json:"step"` // applied after this many steps, 0 before the first
+	Agent string `json:"agent"`
+	Leave bool   `json:"leave,omitempty"`
+	X     int    `json:"x,omitempty"` // where a joining agent appears, or the nearest free cell
+	Y     int    `json:"y,omitempty"`
+}
+
+// String formats the change the way ParseRoster reads it
+func (c RosterChange) String() string {
+	if c.Leave {
+		return fmt.Sprintf("%d:-%s", c.Step, c.Agent)
+	}
+	return fmt.Sprintf("%d:+%s:%d:%d", c.Step, c.Agent, c.X, c.Y)
+}
+
+// RosterSchedule changes the team over an episode, in step order
+type RosterSchedule []RosterChange
+
+// ParseRoster reads a schedule like "10:+a6:2:3,40:-a2",
+// a6 joins at (2,3) after 10 steps and a2 leaves after 40
+func ParseRoster(s string) (RosterSchedule, error) {
+	var schedule RosterSchedule
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		parts := strings.Split(field, ":")
+		if len(parts) < 2 || len(parts[1]) < 2 {
+			return nil, fmt.Errorf("roster change %q, want step:+name:x:y or step:-name", field)
+		}
+		step, err := strconv.Atoi(parts[0])
+		if err != nil || step < 0 {
+			return nil, fmt.Errorf("roster change %q: bad step %q", field, parts[0])
+		}
+		change := RosterChange{Step: step, Agent: parts[1][1:]}
+		switch parts[1][0] {
+		case '-':
+			if len(parts) != 2 {
+				return nil, fmt.Errorf("roster change %q, a leaving agent takes no position", field)
+			}
+			change.Leave = true
+		case '+':
+			if len(parts) != 4 {
+				return nil, fmt.Errorf("roster change %q, a joining agent needs a position, step:+name:x:y", field)
+			}
+			if change.X, err = strconv.Atoi(parts[2]); err != nil {
+				return nil, fmt.Errorf("roster change %q: bad x %q", field, parts[2])
+			}
+			if change.Y, err = strconv.Atoi(parts[3]); err != nil {
+				return nil, fmt.Errorf("roster change %q: bad y %q", field, parts[3])
+			}
+		default:
+			return nil, fmt.Errorf("roster change %q, the name starts with + to join or - to leave", field)
+		}
+		schedule = append(schedule, change)
+	}
+	sort.SliceStable(schedule, func(i, j int) bool { return schedule[i].Step < schedule[j].Step })
+	return schedule, nil
+}
+
+// String formats the schedule the way ParseRoster reads it
+func (s RosterSchedule) String() string {
+	changes := make([]string, len(s))
+	for i, change := range s {
+		changes[i] = change.String()
+	}
+	return strings.Join(changes, ",")
+}
+
+// Check plays the schedule's names against a layout: joining agents must be new
+// and leaving ones present, positions must be in the kitchen
+func (s RosterSchedule) Check(env Environment) error {
+	present := map[string]bool{}
+	for _, agent := range env.Agents {
+		present[agent.Name] = true
+	}
+	for _, change := range s {
+		switch {
+		case change.Leave && !present[change.Agent]:
+			return fmt.Errorf("%s on %s: agent %s isn't in the kitchen then", change, env.Name, change.Agent)
+		case !change.Leave && present[change.Agent]:
+			return fmt.Errorf("%s on %s: agent %s is already in the kitchen then", change, env.Name, change.Agent)
+		case !change.Leave && !env.InBounds(change.X, change.Y):
+			return fmt.Errorf("%s on %s: (%d,%d) is outside the kitchen", change, env.Name, change.X, change.Y)
+		}
+		present[change.Agent] = !change.Leave
+	}
+	return nil
+}
+
+// Apply makes the changes due after steps steps,
+// a joining agent whose cell is taken appears on the nearest free one
+func (s RosterSchedule) Apply(env *Environment, steps int) error {
+	for _, change := range s {
+		if change.Step != steps {
+			continue
+		}
+		if change.Leave {
+			if _, err := env.RemoveAgent(change.Agent); err != nil {
+				return fmt.Errorf("%s: %w", change, err)
+			}
+			continue
+		}
+		pos, ok := env.freeCellNear(change.X, change.Y)
+		if !ok {
+			return fmt.Errorf("%s: no free cell in the kitchen", change)
+		}
+		if err := env.AddAgent(change.Agent, pos.X, pos.Y); err != nil {
+			return fmt.Errorf("%s: %w", change, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,544 @@
+package overcooker
+
+import (
+	crand "crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ServerConfig configures a Server
+type ServerConfig struct {
+	LayoutDir    string        // layout files sessions can name, empty allows only the built-in kitchen and inline layouts
+	MaxSteps     int           // episode length of sessions that don't ask for one
+	SpawnEvery   int           // item spawning of sessions that don't ask for it
+	IdleTimeout  time.Duration // sessions without clients unused this long are closed, 0 never
+	MaxSessions  int           // 0 means no limit
+	AllowOrigins []string      // browser origins allowed besides the server's own, "*" allows any
+	Seed         int64         // seeds the seeds of sessions created without one
+	Log          *Logger
+}
+
+// SessionRequest is the body that creates a session
+type SessionRequest struct {
+	Layout     string          `json:"layout,omitempty"`      // a file in the server's layout directory, without it the built-in kitchen
+	LayoutText string          `json:"layout_text,omitempty"` // or the layout itself, drawn like Render output
+	Seed       *int64          `json:"seed,omitempty"`
+	MaxSteps   *int            `json:"max_steps,omitempty"`
+	SpawnEvery *int            `json:"spawn_every,omitempty"`
+	Rewards    json.RawMessage `json:"rewards,omitempty"` // reward values, missing ones keep their defaults
+}
+
+// SessionInfo describes a session
+type SessionInfo struct {
+	ID       string    `json:"id"`
+	Spec     GymSpec   `json:"spec"`
+	Created  time.Time `json:"created"`
+	LastUsed time.Time `json:"last_used"`
+	Clients  int       `json:"clients"` // open WebSockets
+}
+
+// maxLayoutCells keeps sessions from asking for huge kitchens
+const maxLayoutCells = 64 * 64
+
+// maxRequestBody bounds request bodies
+const maxRequestBody = 1 << 20
+
+// session is one environment and the WebSockets following it
+type session struct {
+	id      string
+	created time.Time
+
+	mu       sync.Mutex
+	gym      *GymEnv
+	lastUsed time.Time
+	clients  map[*wsClient]bool
+	closed   bool
+}
+
+// wsClient is a WebSocket following a session, messages queue in send
+type wsClient struct {
+	conn *wsConn
+	send chan []byte
+}
+
+// wsSendQueue is how many messages a slow client can fall behind before it's dropped
+const wsSendQueue = 64
+
+// Server runs environment sessions over HTTP and WebSocket, each with its own environment and seeds
+//
+//	GET    /layouts                 layout files sessions can use
+//	POST   /sessions                create a session from a SessionRequest
+//	GET    /sessions                list sessions
+//	GET    /sessions/{id}           describe a session
+//	DELETE /sessions/{id}           close a session
+//	POST   /sessions/{id}/{cmd}     run a gym command, the body holds its fields like seed or actions
+//	GET    /sessions/{id}/{cmd}     run a command that doesn't change anything: spec, observe, valid_actions, render
+//	GET    /sessions/{id}/ws        a WebSocket taking gym requests as text messages,
+//	                                it also streams the steps and resets other clients make, without an id
+type Server struct {
+	Config ServerConfig
+
+	mu       sync.Mutex
+	sessions map[string]*session
+	seeds    *rand.Rand
+	mux      *http.ServeMux
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewServer creates a server, and starts closing idle sessions when the config has a timeout
+func NewServer(config ServerConfig) *Server {
+	s := &Server{
+		Config:   config,
+		sessions: map[string]*session{},
+		seeds:    rand.New(rand.NewSource(config.Seed)),
+		mux:      http.NewServeMux(),
+		stop:     make(chan struct{}),
+	}
+	s.mux.HandleFunc("GET /{$}", s.handleIndex)
+	s.mux.HandleFunc("GET /layouts", s.handleLayouts)
+	s.mux.HandleFunc("POST /sessions", s.handleCreate)
+	s.mux.HandleFunc("GET /sessions", s.handleList)
+	s.mux.HandleFunc("GET /sessions/{id}", s.handleInfo)
+	s.mux.HandleFunc("DELETE /sessions/{id}", s.handleDelete)
+	s.mux.HandleFunc("POST /sessions/{id}/{cmd}", s.handleCommand)
+	s.mux.HandleFunc("GET /sessions/{id}/{cmd}", s.handleCommand)
+	s.mux.HandleFunc("GET /sessions/{id}/ws", s.handleWebSocket)
+	if config.IdleTimeout > 0 {
+		go s.closeIdle()
+	}
+	return s
+}
+
+// ServeHTTP routes requests to the endpoints listed on Server
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Close stops the idle timer and closes every session
+func (s *Server) Close() {
+	s.stopOnce.Do(func() { close(s.stop) })
+	s.mu.Lock()
+	sessions := s.sessions
+	s.sessions = map[string]*session{}
+	s.mu.Unlock()
+	for _, sess := range sessions {
+		sess.close()
+	}
+}
+
+// closeIdle closes sessions nobody used for the idle timeout
+func (s *Server) closeIdle() {
+	every := max(s.Config.IdleTimeout/4, time.Second)
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case now := <-ticker.C:
+			for _, sess := range s.list() {
+				sess.mu.Lock()
+				idle := len(sess.clients) == 0 && now.Sub(sess.lastUsed) > s.Config.IdleTimeout
+				sess.mu.Unlock()
+				if idle {
+					s.Config.Log.Infof("session %s idle for %s, closing it", sess.id, s.Config.IdleTimeout)
+					s.remove(sess)
+				}
+			}
+		}
+	}
+}
+
+func (s *Server) list() []*session {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sessions := make([]*session, 0, len(s.sessions))
+	for _, sess := range s.sessions {
+		sessions = append(sessions, sess)
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].created.Before(sessions[j].created) })
+	return sessions
+}
+
+func (s *Server) get(id string) *session {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sessions[id]
+}
+
+func (s *Server) remove(sess *session) {
+	s.mu.Lock()
+	delete(s.sessions, sess.id)
+	s.mu.Unlock()
+	sess.close()
+}
+
+// NewSession creates a session the way POST /sessions does
+func (s *Server) NewSession(req SessionRequest) (SessionInfo, error) {
+	env, err := s.layout(req)
+	if err != nil {
+		return SessionInfo{}, err
+	}
+	if len(req.Rewards) > 0 {
+		rewards := DefaultRewardConfig()
+		if err := json.Unmarshal(req.Rewards, &rewards); err != nil {
+			return SessionInfo{}, fmt.Errorf("parsing rewards: %w", err)
+		}
+		env.Rewards = &rewards
+	}
+	env.Log = NewLogger(nil, LogQuiet)
+	maxSteps, spawnEvery := s.Config.MaxSteps, s.Config.SpawnEvery
+	if req.MaxSteps != nil {
+		maxSteps = *req.MaxSteps
+	}
+	if req.SpawnEvery != nil {
+		spawnEvery = *req.SpawnEvery
+	}
+
+	id, err := newSessionID()
+	if err != nil {
+		return SessionInfo{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Config.MaxSessions > 0 && len(s.sessions) >= s.Config.MaxSessions {
+		return SessionInfo{}, fmt.Errorf("the server already runs %d sessions", len(s.sessions))
+	}
+	seed := s.seeds.Int63()
+	if req.Seed != nil {
+		seed = *req.Seed
+	}
+	now := time.Now()
+	sess := &session{
+		id:       id,
+		created:  now,
+		gym:      NewGymEnv(env, maxSteps, spawnEvery, seed),
+		lastUsed: now,
+		clients:  map[*wsClient]bool{},
+	}
+	s.sessions[id] = sess
+	s.Config.Log.Infof("session %s created on %s, seed %d", id, env.Name, seed)
+	return sess.info(), nil
+}
+
+// layout builds the environment a session asked for
+func (s *Server) layout(req SessionRequest) (Environment, error) {
+	var env Environment
+	var err error
+	switch {
+	case req.Layout != "" && req.LayoutText != "":
+		return env, fmt.Errorf("give layout or layout_text, not both")
+	case req.LayoutText != "":
+		env, err = ParseLayout(strings.NewReader(req.LayoutText))
+	case req.Layout != "":
+		if s.Config.LayoutDir == "" {
+			return env, fmt.Errorf("the server has no layout directory")
+		}
+		if req.Layout != filepath.Base(req.Layout) || strings.HasPrefix(req.Layout, ".") {
+			return env, fmt.Errorf("bad layout name %q", req.Layout)
+		}
+		env, err = LoadLayout(filepath.Join(s.Config.LayoutDir, req.Layout))
+	default:
+		env = SimpleEnvironment()
+	}
+	if err != nil {
+		return env, err
+	}
+	if cells := (env.Width + 1) * (env.Height + 1); cells > maxLayoutCells {
+		return env, fmt.Errorf("the layout has %d cells, at most %d are allowed", cells, maxLayoutCells)
+	}
+	return env, nil
+}
+
+func newSessionID() (string, error) {
+	var b [8]byte
+	if _, err := crand.Read(b[:]); err != nil {
+		return "", fmt.Errorf("making a session id: %w", err)
+	}
+	return hex.EncodeToString(b[:]), nil
+}
+
+func (sess *session) info() SessionInfo {
+	return SessionInfo{
+		ID:       sess.id,
+		Spec:     sess.gym.Spec(),
+		Created:  sess.created,
+		LastUsed: sess.lastUsed,
+		Clients:  len(sess.clients),
+	}
+}
+
+// do runs a request, and streams steps and resets to the other clients
+// closed is set when the request closed the environment
+func (sess *session) do(req GymRequest, from *wsClient) (resp GymResponse, closed bool) {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	if sess.closed {
+		return GymResponse{ID: req.ID, Version: GymProtocolVersion, Cmd: req.Cmd, Error: "the session is closed"}, false
+	}
+	resp = sess.gym.Handle(req)
+	sess.lastUsed = time.Now()
+	if resp.OK && (req.Cmd == "step" || req.Cmd == "reset") && len(sess.clients) > 0 {
+		update := resp
+		update.ID = nil
+		data, _ := json.Marshal(update)
+		for client := range sess.clients {
+			if client != from {
+				sess.queue(client, data)
+			}
+		}
+	}
+	return resp, sess.gym.Closed()
+}
+
+// queue sends a message to a client, dropping clients that fall too far behind
+// sess.mu must be held
+func (sess *session) queue(client *wsClient, data []byte) {
+	select {
+	case client.send <- data:
+	default:
+		client.conn.Close()
+	}
+}
+
+func (sess *session) close() {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	sess.closed = true
+	for client := range sess.clients {
+		client.conn.Close()
+	}
+}
+
+func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
+	writeJSONResponse(w, http.StatusOK, map[string]interface{}{
+		"protocol": GymProtocol,
+		"version":  GymProtocolVersion,
+		"commands": GymCommands,
+		"sessions": len(s.list()),
+	})
+}
+
+func (s *Server) handleLayouts(w http.ResponseWriter, r *http.Request) {
+	layouts := []string{}
+	if s.Config.LayoutDir != "" {
+		entries, err := os.ReadDir(s.Config.LayoutDir)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
+				layouts = append(layouts, entry.Name())
+			}
+		}
+	}
+	writeJSONResponse(w, http.StatusOK, layouts)
+}
+
+func (s *Server) handleCreate(w http.ResponseWriter, r *http.Request) {
+	var req SessionRequest
+	if err := readJSONBody(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	info, err := s.NewSession(req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSONResponse(w, http.StatusCreated, info)
+}
+
+func (s *Server) handleList(w http.ResponseWriter, r *http.Request) {
+	infos := []SessionInfo{}
+	for _, sess := range s.list() {
+		sess.mu.Lock()
+		infos = append(infos, sess.info())
+		sess.mu.Unlock()
+	}
+	writeJSONResponse(w, http.StatusOK, infos)
+}
+
+// session finds the session of the request, answering 404 when there's none
+func (s *Server) session(w http.ResponseWriter, r *http.Request) *session {
+	sess := s.get(r.PathValue("id"))
+	if sess == nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no session %q", r.PathValue("id")))
+	}
+	return sess
+}
+
+func (s *Server) handleInfo(w http.ResponseWriter, r *http.Request) {
+	if sess := s.session(w, r); sess != nil {
+		sess.mu.Lock()
+		info := sess.info()
+		sess.mu.Unlock()
+		writeJSONResponse(w, http.StatusOK, info)
+	}
+}
+
+func (s *Server) handleDelete(w http.ResponseWriter, r *http.Request) {
+	if sess := s.session(w, r); sess != nil {
+		s.remove(sess)
+		s.Config.Log.Infof("session %s closed", sess.id)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (s *Server) handleCommand(w http.ResponseWriter, r *http.Request) {
+	sess := s.session(w, r)
+	if sess == nil {
+		return
+	}
+	var req GymRequest
+	if r.Method == http.MethodGet {
+		switch r.PathValue("cmd") {
+		case "spec", "observe", "valid_actions", "render":
+		default:
+			writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("%s needs POST", r.PathValue("cmd")))
+			return
+		}
+	} else if err := readJSONBody(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	req.Cmd = r.PathValue("cmd")
+
+	resp, closed := sess.do(req, nil)
+	if closed {
+		s.remove(sess)
+	}
+	status := http.StatusOK
+	if !resp.OK {
+		status = http.StatusBadRequest
+	}
+	writeJSONResponse(w, status, resp)
+}
+
+func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	sess := s.session(w, r)
+	if sess == nil {
+		return
+	}
+	if !s.originAllowed(r) {
+		writeError(w, http.StatusForbidden, fmt.Errorf("origin %q isn't allowed", r.Header.Get("Origin")))
+		return
+	}
+	conn, err := upgradeWebSocket(w, r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	client := &wsClient{conn: conn, send: make(chan []byte, wsSendQueue)}
+	sess.mu.Lock()
+	if sess.closed {
+		sess.mu.Unlock()
+		conn.Close()
+		return
+	}
+	sess.clients[client] = true
+	sess.mu.Unlock()
+
+	go func() {
+		for data := range client.send {
+			if err := conn.WriteText(data); err != nil {
+				conn.Close()
+			}
+		}
+	}()
+	defer func() {
+		sess.mu.Lock()
+		delete(sess.clients, client)
+		close(client.send)
+		sess.lastUsed = time.Now()
+		sess.mu.Unlock()
+		conn.Close()
+	}()
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !sess.isClosed() {
+				s.Config.Log.Debugf("session %s websocket: %v", sess.id, err)
+			}
+			return
+		}
+		var req GymRequest
+		var resp GymResponse
+		closed := false
+		if err := json.Unmarshal(data, &req); err != nil {
+			resp = GymResponse{Version: GymProtocolVersion, Error: fmt.Sprintf("bad request: %v", err)}
+		} else {
+			resp, closed = sess.do(req, client)
+		}
+		out, _ := json.Marshal(resp)
+		sess.mu.Lock()
+		sess.queue(client, out)
+		sess.mu.Unlock()
+		if closed {
+			s.remove(sess)
+		}
+	}
+}
+
+func (sess *session) isClosed() bool {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	return sess.closed
+}
+
+// originAllowed lets through clients that aren't browsers, pages served by this host and the configured origins
+func (s *Server) originAllowed(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	for _, allowed := range s.Config.AllowOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+func readJSONBody(r *http.Request, value interface{}) error {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxRequestBody+1))
+	if err != nil {
+		return fmt.Errorf("reading request: %w", err)
+	}
+	if len(body) > maxRequestBody {
+		return fmt.Errorf("request over %d bytes", maxRequestBody)
+	}
+	if len(strings.TrimSpace(string(body))) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(body, value); err != nil {
+		return fmt.Errorf("bad request: %w", err)
+	}
+	return nil
+}
+
+func writeJSONResponse(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSONResponse(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,144 @@
+package overcooker
+
+// spatialIndex is an occupancy grid over the kitchen so the GetXAt getters don't scan
+// each layer holds index+1 of the first entity on a cell, 0 for an empty cell,
+// first means lowest index, which is what the linear scans used to return
+type spatialIndex struct {
+	width, height int
+
+	agents     []int32
+	agentCount []int32 // agents may share a cell, SimpleEnvironment starts four on (1,4)
+	items      []int32
+	stations   []int32
+
+	// owner is the environment the index was built for, a struct copy shares the pointer
+	// but not the slice headers, so it must build its own index instead of editing this one
+	owner *Environment
+	// what the index was built from, a mismatch means the slices were replaced behind its back
+	agentsRef   *Agent
+	itemsRef    *Item
+	stationsRef *Station
+	nAgents     int
+	nItems      int
+	nStations   int
+}
+
+// firstRef returns the address of a slice's first element, nil when empty
+func firstRef[T any](s []T) *T {
+	if len(s) == 0 {
+		return nil
+	}
+	return &s[0]
+}
+
+// matches reports whether the index belongs to env and still describes its slices and grid size
+func (s *spatialIndex) matches(env *Environment) bool {
+	return s.owner == env && s.width == env.Width+1 && s.height == env.Height+1 &&
+		s.nAgents == len(env.Agents) && s.agentsRef == firstRef(env.Agents) &&
+		s.nItems == len(env.Items) && s.itemsRef == firstRef(env.Items) &&
+		s.nStations == len(env.Stations) && s.stationsRef == firstRef(env.Stations)
+}
+
+// spatialIndex returns env's index, rebuilding it when it's missing, stale or another environment's
+// appending, removing or replacing entities is noticed, moving one in place is not,
+// call Reindex after editing positions directly
+func (env *Environment) spatialIndex() *spatialIndex {
+	if env.spatial == nil || !env.spatial.matches(env) {
+		env.Reindex()
+	}
+	return env.spatial
+}
+
+// Reindex rebuilds the occupancy grid behind GetAgentAt, GetItemAt and GetStationAt
+// Step and spawning keep it in sync, only direct edits of entity positions need this
+func (env *Environment) Reindex() {
+	width, height := env.Width+1, env.Height+1
+	if width < 0 || height < 0 {
+		width, height = 0, 0
+	}
+	cells := width * height
+	s := env.spatial
+	// only the owner reuses its grid, a copy of env gets a grid of its own
+	if s == nil || s.owner != env || len(s.agents) != cells {
+		s = &spatialIndex{
+			owner:      env,
+			agents:     make([]int32, cells),
+			agentCount: make([]int32, cells),
+			items:      make([]int32, cells),
+			stations:   make([]int32, cells),
+		}
+	} else {
+		clear(s.agents)
+		clear(s.agentCount)
+		clear(s.stations)
+	}
+	s.width, s.height = width, height
+	env.spatial = s
+
+	for i := range env.Agents {
+		if cell, ok := env.cell(env.Agents[i].X, env.Agents[i].Y); ok {
+			s.agentCount[cell]++
+			if s.agents[cell] == 0 {
+				s.agents[cell] = int32(i + 1)
+			}
+		}
+	}
+	for i := range env.Stations {
+		if cell, ok := env.cell(env.Stations[i].X, env.Stations[i].Y); ok && s.stations[cell] == 0 {
+			s.stations[cell] = int32(i + 1)
+		}
+	}
+	s.agentsRef, s.nAgents = firstRef(env.Agents), len(env.Agents)
+	s.stationsRef, s.nStations = firstRef(env.Stations), len(env.Stations)
+	env.reindexItems()
+}
+
+// reindexItems rebuilds the item layer after items were added or removed
+func (env *Environment) reindexItems() {
+	s := env.spatial
+	if s == nil || s.owner != env {
+		env.Reindex()
+		return
+	}
+	clear(s.items)
+	for i := range env.Items {
+		if cell, ok := env.cell(env.Items[i].X, env.Items[i].Y); ok && s.items[cell] == 0 {
+			s.items[cell] = int32(i + 1)
+		}
+	}
+	s.itemsRef, s.nItems = firstRef(env.Items), len(env.Items)
+}
+
+// cell returns the grid index of x, y
+func (env *Environment) cell(x, y int) (int, bool) {
+	if !env.InBounds(x, y) {
+		return 0, false
+	}
+	return y*(env.Width+1) + x, true
+}
+
+// moveAgent updates the agent layer after agent i moved from one position to another
+func (env *Environment) moveAgent(i int, from, to Position) {
+	s := env.spatialIndex()
+	if cell, ok := env.cell(from.X, from.Y); ok {
+		s.agentCount[cell]--
+		if s.agents[cell] == int32(i+1) {
+			// the next agent left on the cell, if any, becomes the first
+			s.agents[cell] = 0
+			if s.agentCount[cell] > 0 {
+				for j := range env.Agents {
+					if j != i && env.Agents[j].X == from.X && env.Agents[j].Y == from.Y {
+						s.agents[cell] = int32(j + 1)
+						break
+					}
+				}
+			}
+		}
+	}
+	if cell, ok := env.cell(to.X, to.Y); ok {
+		s.agentCount[cell]++
+		if s.agents[cell] == 0 || s.agents[cell] > int32(i+1) {
+			s.agents[cell] = int32(i + 1)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package overcooker
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+// checkIndex compares every lookup with a linear scan, which returns the lowest index on a cell
+// it reports with Errorf so copies stepped on other goroutines can use it
+func checkIndex(t *testing.T, env *Environment, when string) {
+	t.Helper()
+	for y := -1; y <= env.Height+1; y++ {
+		for x := -1; x <= env.Width+1; x++ {
+			var agent *Agent
+			for i := range env.Agents {
+				if env.Agents[i].X == x && env.Agents[i].Y == y {
+					agent = &env.Agents[i]
+					break
+				}
+			}
+			var item *Item
+			for i := range env.Items {
+				if env.Items[i].X == x && env.Items[i].Y == y {
+					item = &env.Items[i]
+					break
+				}
+			}
+			var station *Station
+			for i := range env.Stations {
+				if env.Stations[i].X == x && env.Stations[i].Y == y {
+					station = &env.Stations[i]
+					break
+				}
+			}
+			if got := env.GetAgentAt(x, y); got != agent {
+				t.Errorf("%s: GetAgentAt(%d, %d) = %v, a scan finds %v", when, x, y, got, agent)
+				return
+			}
+			if got := env.GetItemAt(x, y); got != item {
+				t.Errorf("%s: GetItemAt(%d, %d) = %v, a scan finds %v", when, x, y, got, item)
+				return
+			}
+			if got := env.GetStationAt(x, y); got != station {
+				t.Errorf("%s: GetStationAt(%d, %d) = %v, a scan finds %v", when, x, y, got, station)
+				return
+			}
+		}
+	}
+}
+
+// randomActions fills actions with random moves and interactions
+func randomActions(actions []int, r *rand.Rand) []int {
+	for i := range actions {
+		actions[i] = r.Intn(Act_Interact + 1)
+	}
+	return actions
+}
+
+func TestSpatialIndexMatchesScan(t *testing.T) {
+	env := quietEnvironment()
+	env.Rand = rand.New(rand.NewSource(1))
+	r := rand.New(rand.NewSource(2))
+	checkIndex(t, &env, "start")
+
+	for step := 1; step <= 300; step++ {
+		env.Step(randomActions(make([]int, len(env.Agents)), r))
+		checkIndex(t, &env, "after a move")
+		if step%5 == 0 {
+			env.EnvironmentSpawnRandomItemsForTraining()
+			checkIndex(t, &env, "after a spawn")
+		}
+		switch step {
+		case 50, 150:
+			name := fmt.Sprintf("a%d", 6+step/100)
+			pos, _ := env.freeCellNear(r.Intn(env.Width+1), r.Intn(env.Height+1))
+			if err := env.AddAgent(name, pos.X, pos.Y); err != nil {
+				t.Fatal(err)
+			}
+			checkIndex(t, &env, "after a join")
+		case 100, 200, 250:
+			// leave with something in hand now and then, so it's dropped
+			env.Agents[0].Inventory = Item{Name: ItemSoup, X: -1, Y: -1}
+			if _, err := env.RemoveAgent(env.Agents[r.Intn(len(env.Agents))].Name); err != nil {
+				t.Fatal(err)
+			}
+			checkIndex(t, &env, "after a leave")
+		}
+	}
+
+	// editing positions directly needs a Reindex
+	env.Agents[0].X, env.Agents[0].Y = 0, 0
+	env.Reindex()
+	checkIndex(t, &env, "after a Reindex")
+}
+
+// copies of an environment with slices of their own each build their own index,
+// stepping them side by side doesn't rebuild a shared one under the others
+func TestSpatialIndexIsNotShared(t *testing.T) {
+	env := quietEnvironment()
+	env.Reindex()
+	copies := make([]Environment, 4)
+	for i := range copies {
+		copies[i] = env // shares env's index pointer
+		copies[i].Agents = append([]Agent(nil), env.Agents...)
+		copies[i].Items = append([]Item(nil), env.Items...)
+		copies[i].rewards = nil
+	}
+
+	var wg sync.WaitGroup
+	for i := range copies {
+		wg.Add(1)
+		go func(c *Environment, seed int64) {
+			defer wg.Done()
+			r := rand.New(rand.NewSource(seed))
+			actions := make([]int, len(c.Agents))
+			for step := 0; step < 100; step++ {
+				c.Step(randomActions(actions, r))
+				checkIndex(t, c, "stepping a copy")
+			}
+		}(&copies[i], int64(i))
+	}
+	wg.Wait()
+
+	checkIndex(t, &env, "after the copies stepped")
+	for i := range copies {
+		if copies[i].spatial == env.spatial {
+			t.Errorf("copy %d still shares the original's index", i)
+		}
+	}
+}
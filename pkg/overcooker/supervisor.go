@@ -0,0 +1,245 @@
+package overcooker
+
+import "math/rand"
+
+// Supervisor dreams up policy maps, scores them with rollouts and revises them
+// it's the higher level process that steers the low level maps agents follow
+type Supervisor struct {
+	NewEnv       func() Environment // builds a fresh environment for each rollout
+	Episodes     int                // rollouts per evaluation
+	EpisodeSteps int
+
+	Concentration float64 // Dirichlet concentration for random maps, low is spiky
+	Sharpness     float32 // probability given to the arrow in arrow maps
+
+	Rand *rand.Rand
+
+	// best map seen by Revise and its score
+	Best      PolicyMap
+	BestScore float64
+}
+
+// NewSupervisor creates a supervisor with a seeded random source
+func NewSupervisor(newEnv func() Environment, seed int64) *Supervisor {
+	return &Supervisor{
+		NewEnv:        newEnv,
+		Episodes:      3,
+		EpisodeSteps:  200,
+		Concentration: 1,
+		Sharpness:     0.7,
+		Rand:          rand.New(rand.NewSource(seed)),
+	}
+}
+
+// RandomMap draws every cell's policy from a symmetric Dirichlet
+func (s *Supervisor) RandomMap() PolicyMap {
+	env := s.NewEnv()
+	pm := NewPolicyMap(env)
+	for _, pos := range sortedPositions(pm) {
+		policy := pm[pos]
+		for a := Act_None; a <= Act_Interact; a++ {
+			policy[a] = float32(sampleGamma(s.Rand, s.Concentration))
+		}
+		policy.Normalize()
+	}
+	return pm
+}
+
+// ArrowMap points every cell toward the nearest station of a kind (StationOnion, StationChop...)
+// think arrows on the floor: the arrow gets Sharpness, the other actions share the rest,
+// and on the station itself the arrow is Act_Interact
+func (s *Supervisor) ArrowMap(kind string) PolicyMap {
+	env := s.NewEnv()
+	pm := NewPolicyMap(env)
+
+	fields := []DistanceField{}
+	for _, station := range env.Stations {
+		if station.Name[0:1] == kind {
+			fields = append(fields, env.DistanceFieldTo(Position{X: station.X, Y: station.Y}, false))
+		}
+	}
+	if len(fields) == 0 {
+		return pm
+	}
+
+	for pos, policy := range pm {
+		// follow the closest station's field
+		field := fields[0]
+		for _, f := range fields[1:] {
+			if d := f.At(pos.X, pos.Y); d != Unreachable && (field.At(pos.X, pos.Y) == Unreachable || d < field.At(pos.X, pos.Y)) {
+				field = f
+			}
+		}
+		arrow := field.BestAction(pos.X, pos.Y)
+		if field.At(pos.X, pos.Y) == 0 {
+			arrow = Act_Interact
+		}
+		if arrow == Act_None {
+			continue // unreachable, stay uniform
+		}
+		rest := (1 - s.Sharpness) / Act_Interact
+		for a := Act_None; a <= Act_Interact; a++ {
+			policy[a] = rest
+		}
+		policy[arrow] = s.Sharpness
+	}
+	return pm
+}
+
+// RoleMaps builds one arrow map per agent from role assignments
+// roles maps an agent name to the station kind the agent works at
+func (s *Supervisor) RoleMaps(roles map[string]string) map[string]PolicyMap {
+	maps := make(map[string]PolicyMap, len(roles))
+	byKind := map[string]PolicyMap{}
+	for agent, kind := range roles {
+		if _, ok := byKind[kind]; !ok {
+			byKind[kind] = s.ArrowMap(kind)
+		}
+		maps[agent] = byKind[kind].Clone()
+	}
+	return maps
+}
+
+// Evaluate scores a shared map by its mean return over rollouts
+func (s *Supervisor) Evaluate(pm PolicyMap) float64 {
+	return s.evaluate(PolicyMapController{Map: pm, Rand: s.Rand})
+}
+
+// EvaluateAgents scores per-agent maps, agents without a map use the uniform policy
+func (s *Supervisor) EvaluateAgents(maps map[string]PolicyMap) float64 {
+	env := s.NewEnv()
+	return s.evaluate(AgentMapsController{Maps: maps, Fallback: NewPolicyMap(env), Rand: s.Rand})
+}
+
+func (s *Supervisor) evaluate(c Controller) float64 {
+	episodes := s.Episodes
+	if episodes < 1 {
+		episodes = 1
+	}
+	total := 0.0
+	for e := 0; e < episodes; e++ {
+		env := s.NewEnv()
+		total += RunEpisode(&env, c, s.EpisodeSteps)
+	}
+	return total / float64(episodes)
+}
+
+// Revise hill climbs from pm for a number of rounds
+// each round proposes an edit and keeps it when rollouts score it higher
+func (s *Supervisor) Revise(pm PolicyMap, rounds int) (PolicyMap, float64) {
+	return s.ReviseTeam(pm, rounds, func(candidate PolicyMap) Controller {
+		return PolicyMapController{Map: candidate, Rand: s.Rand}
+	})
+}
+
+// ReviseTeam hill climbs like Revise for a map only some agents follow
+// team returns the controller a candidate is scored with, playing the others from their own maps
+func (s *Supervisor) ReviseTeam(pm PolicyMap, rounds int, team func(candidate PolicyMap) Controller) (PolicyMap, float64) {
+	current := pm.Clone()
+	currentScore := s.evaluate(team(current))
+	for r := 0; r < rounds; r++ {
+		proposal := s.propose(current)
+		score := s.evaluate(team(proposal))
+		if score > currentScore {
+			current, currentScore = proposal, score
+		}
+	}
+	if s.Best == nil || currentScore > s.BestScore {
+		s.Best, s.BestScore = current.Clone(), currentScore
+	}
+	return current, currentScore
+}
+
+// propose returns an edited copy of pm
+// either paint arrows to a station over a region, or redream a region at random
+func (s *Supervisor) propose(pm PolicyMap) PolicyMap {
+	env := s.NewEnv()
+	from := Position{X: s.Rand.Intn(env.Width + 1), Y: s.Rand.Intn(env.Height + 1)}
+	to := Position{X: s.Rand.Intn(env.Width + 1), Y: s.Rand.Intn(env.Height + 1)}
+
+	var overlay PolicyMap
+	if len(env.Stations) > 0 && s.Rand.Intn(2) == 0 {
+		station := env.Stations[s.Rand.Intn(len(env.Stations))]
+		overlay = s.ArrowMap(station.Name[0:1])
+	} else {
+		overlay = s.RandomMap()
+	}
+	// blend rather than replace so a proposal never throws away everything learned
+	blended, err := BlendAverage([]PolicyMap{pm, overlay}, []float64{1, 1})
+	if err != nil {
+		return pm.Clone()
+	}
+	return pm.OverrideRegion(blended, from, to)
+}
+
+// SupervisedLearner is supervisor-in-the-loop training
+// a PolicyMapLearner learns every step, and every ReviseEvery episodes the supervisor
+// revises the learned map and steers the learner toward the revision
+type SupervisedLearner struct {
+	*PolicyMapLearner
+	Supervisor *Supervisor
+
+	ReviseEvery  int     // episodes between revisions
+	ReviseRounds int     // hill climbing rounds per revision
+	Guidance     float64 // weight of the supervisor's revision when steering, 0..1
+
+	episodes int
+}
+
+// NewSupervisedLearner wraps a fresh PolicyMapLearner with a supervisor
+func NewSupervisedLearner(env Environment, supervisor *Supervisor) *SupervisedLearner {
+	return &SupervisedLearner{
+		PolicyMapLearner: NewPolicyMapLearner(env),
+		Supervisor:       supervisor,
+		ReviseEvery:      5,
+		ReviseRounds:     10,
+		Guidance:         0.5,
+	}
+}
+
+// EndEpisode lets the supervisor steer the learned map every ReviseEvery episodes
+func (l *SupervisedLearner) EndEpisode(episodeReturn float64) {
+	l.PolicyMapLearner.EndEpisode(episodeReturn)
+	l.episodes++
+	if l.ReviseEvery <= 0 || l.episodes%l.ReviseEvery != 0 {
+		return
+	}
+
+	l.Map = l.steer("", l.Map)
+	for _, key := range sortedKeys(l.Maps) {
+		l.Maps[key] = l.steer(key, l.Maps[key])
+	}
+}
+
+// steer blends the learned map under key with the supervisor's revision of it
+func (l *SupervisedLearner) steer(key string, pm PolicyMap) PolicyMap {
+	revised, _ := l.Supervisor.ReviseTeam(pm, l.ReviseRounds, func(candidate PolicyMap) Controller {
+		return l.team(key, candidate)
+	})
+	steered, err := BlendAverage([]PolicyMap{pm, revised}, []float64{1 - l.Guidance, l.Guidance})
+	if err != nil {
+		return pm
+	}
+	return steered
+}
+
+// team plays the agents whose map is under key from candidate and every other agent from its own map
+func (l *SupervisedLearner) team(key string, candidate PolicyMap) Controller {
+	env := l.Supervisor.NewEnv()
+	maps := make(map[string]PolicyMap, len(env.Agents))
+	for _, agent := range env.Agents {
+		agentKey := l.mapKey(agent.Name)
+		switch pm, ok := l.Maps[agentKey]; {
+		case agentKey == key:
+			maps[agent.Name] = candidate
+		case ok:
+			maps[agent.Name] = pm
+		}
+	}
+	// agents without a map of their own, or joining later, act from the shared one
+	fallback := l.Map
+	if key == "" {
+		fallback = candidate
+	}
+	return AgentMapsController{Maps: maps, Fallback: fallback, Rand: l.Supervisor.Rand}
+}
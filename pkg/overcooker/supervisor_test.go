@@ -0,0 +1,51 @@
+package overcooker
+
+import (
+	"reflect"
+	"testing"
+)
+
+// the same seed dreams up the same maps and scores them the same
+func TestSupervisorIsReproducible(t *testing.T) {
+	a := NewSupervisor(quietEnvironment, 11)
+	b := NewSupervisor(quietEnvironment, 11)
+	a.Episodes, b.Episodes = 1, 1
+	a.EpisodeSteps, b.EpisodeSteps = 20, 20
+
+	mapA, mapB := a.RandomMap(), b.RandomMap()
+	if !reflect.DeepEqual(mapA, mapB) {
+		t.Fatalf("random maps differ")
+	}
+	checkPolicyMapNormalized(t, mapA, "random map", 0)
+
+	revisedA, scoreA := a.Revise(mapA, 3)
+	revisedB, scoreB := b.Revise(mapB, 3)
+	if scoreA != scoreB || !reflect.DeepEqual(revisedA, revisedB) {
+		t.Errorf("revisions differ: scores %v and %v", scoreA, scoreB)
+	}
+	checkPolicyMapNormalized(t, revisedA, "revised map", 0)
+}
+
+// arrow maps point down the distance field and interact on the station
+func TestSupervisorArrowMap(t *testing.T) {
+	s := NewSupervisor(quietEnvironment, 1)
+	env := quietEnvironment()
+	pm := s.ArrowMap(StationChop)
+	checkPolicyMapNormalized(t, pm, "arrow map", 0)
+
+	station := env.Stations[1]
+	field := env.DistanceFieldTo(Position{X: station.X, Y: station.Y}, false)
+	for pos, policy := range pm {
+		arrow := policy.GetActionBest()
+		if pos.X == station.X && pos.Y == station.Y {
+			if arrow != Act_Interact {
+				t.Errorf("on the station the arrow is %d, want Act_Interact", arrow)
+			}
+			continue
+		}
+		next := pos.Move(arrow)
+		if field.At(next.X, next.Y) != field.At(pos.X, pos.Y)-1 {
+			t.Errorf("the arrow at %v moves away from the station", pos)
+		}
+	}
+}
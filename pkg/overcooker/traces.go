@@ -0,0 +1,237 @@
+package overcooker
+
+import "math/rand"
+
+// TraceMode selects the eligibility trace algorithm
+type TraceMode int
+
+const (
+	SarsaLambda TraceMode = iota // on-policy TD(lambda)
+	QLambda                      // Watkins Q(lambda), traces are cut after exploratory actions
+)
+
+// TraceKind selects how a revisited state-action pair's trace grows
+type TraceKind int
+
+const (
+	ReplacingTraces    TraceKind = iota // reset to 1 on every visit
+	AccumulatingTraces                  // add 1 on every visit
+)
+
+// TraceConfig configures the eligibility trace learner
+type TraceConfig struct {
+	Alpha   float64   `json:"alpha"`   // learning rate
+	Gamma   float64   `json:"gamma"`   // discount
+	Lambda  float64   `json:"lambda"`  // trace decay, 0 is one-step TD, 1 is close to Monte Carlo
+	Epsilon float64   `json:"epsilon"` // exploration rate for epsilon-greedy actions
+	Mode    TraceMode `json:"mode"`
+	Kind    TraceKind `json:"kind"`
+	Seed    int64     `json:"-"`
+}
+
+// DefaultTraceConfig returns settings that carry credit along the whole recipe
+func DefaultTraceConfig() TraceConfig {
+	return TraceConfig{
+		Alpha:   0.1,
+		Gamma:   0.95,
+		Lambda:  0.9,
+		Epsilon: 0.1,
+		Mode:    SarsaLambda,
+		Kind:    ReplacingTraces,
+		Seed:    1,
+	}
+}
+
+// traceCutoff drops traces too small to matter, keeps the trace maps short
+const traceCutoff = 1e-3
+
+// TabularState is what a tabular learner sees: the cell and the item in hand
+// the held item matters here, the same cell calls for a different move on each leg
+// of onion -> chop -> stove -> deliver
+type TabularState struct {
+	Position
+	Holding string
+}
+
+// stateAction keys an eligibility trace
+type stateAction struct {
+	state  TabularState
+	action int
+}
+
+// pendingAction is an action chosen at the end of Learn for the next Act
+type pendingAction struct {
+	state  TabularState
+	action int
+	ok     bool
+}
+
+// TraceLearner learns action values with eligibility traces, TD(lambda) or Q(lambda)
+// every agent keeps its own trace so credit runs back over its recent trajectory,
+// the action values are shared by all agents
+type TraceLearner struct {
+	Config TraceConfig
+	Q      map[TabularState][]float64
+
+	agents map[string]*traceAgent // per agent name
+
+	rng *rand.Rand
+}
+
+// traceAgent is what TraceLearner keeps for one agent
+type traceAgent struct {
+	trace     map[stateAction]float64
+	prev      stateAction   // state-action the agent just took
+	next      pendingAction // SARSA picks the next action while learning
+	exploring bool          // whether the agent's last action was exploratory
+	acted     bool          // Act chose prev and Learn hasn't seen it yet
+}
+
+// NewTraceLearner creates a learner with zero action values
+func NewTraceLearner(config TraceConfig) *TraceLearner {
+	return &TraceLearner{
+		Config: config,
+		Q:      map[TabularState][]float64{},
+		rng:    rand.New(rand.NewSource(config.Seed)),
+	}
+}
+
+// agentState returns the tabular state of an agent
+func agentState(agent Agent) TabularState {
+	return TabularState{Position: Position{X: agent.X, Y: agent.Y}, Holding: agent.Inventory.Name}
+}
+
+// values returns the action values of a state, creating them on first visit
+func (l *TraceLearner) values(s TabularState) []float64 {
+	q, ok := l.Q[s]
+	if !ok {
+		q = make([]float64, Act_Interact+1)
+		l.Q[s] = q
+	}
+	return q
+}
+
+// GreedyAction returns the highest valued action in a state, ties go to the lower action
+// it only reads Q, an unseen state has every value at 0
+func (l *TraceLearner) GreedyAction(s TabularState) int {
+	q, ok := l.Q[s]
+	if !ok {
+		return Act_None
+	}
+	best := 0
+	for a := range q {
+		if q[a] > q[best] {
+			best = a
+		}
+	}
+	return best
+}
+
+// chooseAction is epsilon-greedy, it reports whether the action was exploratory
+func (l *TraceLearner) chooseAction(s TabularState) (int, bool) {
+	greedy := l.GreedyAction(s)
+	if l.rng.Float64() < l.Config.Epsilon {
+		action := l.rng.Intn(Act_Interact + 1)
+		return action, action != greedy
+	}
+	return greedy, false
+}
+
+// agent returns an agent's trace state, creating it on first use
+func (l *TraceLearner) agent(name string) *traceAgent {
+	a, ok := l.agents[name]
+	if !ok {
+		if l.agents == nil {
+			l.agents = map[string]*traceAgent{}
+		}
+		a = &traceAgent{trace: map[stateAction]float64{}}
+		l.agents[name] = a
+	}
+	return a
+}
+
+// Act picks each agent's action epsilon-greedily
+func (l *TraceLearner) Act(env *Environment) []int {
+	actions := make([]int, len(env.Agents))
+	for i, agent := range env.Agents {
+		state := l.agent(agent.Name)
+		s := agentState(agent)
+		if pending := state.next; pending.ok && pending.state == s {
+			actions[i] = pending.action
+		} else {
+			actions[i], state.exploring = l.chooseAction(s)
+		}
+		state.next.ok = false
+		state.prev = stateAction{state: s, action: actions[i]}
+		state.acted = true
+	}
+	return actions
+}
+
+// Learn does one TD update per agent and spreads it over the agent's trace
+func (l *TraceLearner) Learn(env *Environment, actions []int, rewards []float32, done, truncated bool) {
+	for i, agent := range env.Agents {
+		state := l.agent(agent.Name)
+		if !state.acted || i >= len(rewards) {
+			continue // joined after Act, it has nothing to learn from yet
+		}
+		state.acted = false
+		prev := state.prev
+		trace := state.trace
+		nextState := agentState(agent)
+
+		// bootstrap from the next state unless it's terminal, a time limit isn't
+		target := float64(rewards[i])
+		cutTrace := false
+		if !done || truncated {
+			nextQ := l.values(nextState)
+			switch l.Config.Mode {
+			case QLambda:
+				target += l.Config.Gamma * nextQ[l.GreedyAction(nextState)]
+				// Watkins: the trace only follows the greedy policy
+				nextAction, exploratory := l.chooseAction(nextState)
+				state.next = pendingAction{state: nextState, action: nextAction, ok: true}
+				state.exploring = exploratory
+				cutTrace = exploratory
+			default:
+				nextAction, exploratory := l.chooseAction(nextState)
+				state.next = pendingAction{state: nextState, action: nextAction, ok: true}
+				state.exploring = exploratory
+				target += l.Config.Gamma * nextQ[nextAction]
+			}
+		}
+		delta := target - l.values(prev.state)[prev.action]
+
+		// mark the pair just taken
+		switch l.Config.Kind {
+		case AccumulatingTraces:
+			trace[prev]++
+		default:
+			for a := Act_None; a <= Act_Interact; a++ {
+				delete(trace, stateAction{state: prev.state, action: a})
+			}
+			trace[prev] = 1
+		}
+
+		// credit the whole recent trajectory, then decay it
+		decay := l.Config.Gamma * l.Config.Lambda
+		for sa, e := range trace {
+			l.values(sa.state)[sa.action] += l.Config.Alpha * delta * e
+			e *= decay
+			if e < traceCutoff || cutTrace || done {
+				delete(trace, sa)
+			} else {
+				trace[sa] = e
+			}
+		}
+	}
+}
+
+// EndEpisode clears all traces and pending actions
+func (l *TraceLearner) EndEpisode(episodeReturn float64) {
+	for _, state := range l.agents {
+		state.trace = map[stateAction]float64{}
+		state.next.ok = false
+		state.acted = false
+	}
+}
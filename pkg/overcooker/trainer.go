@@ -0,0 +1,226 @@
+package overcooker
+
+import "math/rand"
+
+// Learner chooses actions for every agent and learns from what happens
+type Learner interface {
+	// Act returns one action per agent for the current state
+	Act(env *Environment) []int
+	// Learn is called right after env.Step with the actions taken and the rewards received
+	// done ends the episode, truncated says it was cut by a time limit rather than reaching
+	// a terminal state, so the value of env's state still counts
+	Learn(env *Environment, actions []int, rewards []float32, done, truncated bool)
+	// EndEpisode is called once an episode is over with its total return
+	EndEpisode(episodeReturn float64)
+}
+
+// MapSharing decides which agents learn into the same policy map
+type MapSharing int
+
+const (
+	SharedMap    MapSharing = iota // one map for every agent
+	PerAgentMaps                   // one map per agent, keyed by agent name
+	GroupedMaps                    // one map per role, agents are assigned roles
+)
+
+// PolicyMapLearner is the original tabular learner
+// agents sample from a policy map, Policy.Update nudges the action taken,
+// and a discounted copy of positive rewards flows one cell back along the agent's move
+type PolicyMapLearner struct {
+	// Map is the shared map, and the fallback for agents without a role
+	Map PolicyMap
+
+	Sharing MapSharing
+	// Roles assigns agent names to roles like "chopper" or "runner", for GroupedMaps
+	Roles map[string]string
+	// Maps holds the per-agent or per-role maps, created on first use
+	Maps map[string]PolicyMap
+
+	LearningRate float32 // how far Policy.UpdateRate moves a policy per reward
+
+	Rand *rand.Rand // nil uses the global source
+
+	prevPos []Position
+}
+
+// NewPolicyMapLearner creates a learner with one uniform policy map shared by all agents
+func NewPolicyMapLearner(env Environment) *PolicyMapLearner {
+	return NewPolicyMapLearnerSharing(env, SharedMap, nil)
+}
+
+// NewPolicyMapLearnerSharing creates a learner where sharing decides which agents
+// learn together, roles is only used with GroupedMaps
+func NewPolicyMapLearnerSharing(env Environment, sharing MapSharing, roles map[string]string) *PolicyMapLearner {
+	return &PolicyMapLearner{
+		Map:          NewPolicyMap(env),
+		Sharing:      sharing,
+		Roles:        roles,
+		Maps:         map[string]PolicyMap{},
+		LearningRate: DefaultPolicyLearningRate,
+	}
+}
+
+// mapKey returns the key in Maps for an agent, "" means the shared Map
+func (l *PolicyMapLearner) mapKey(agentName string) string {
+	switch l.Sharing {
+	case PerAgentMaps:
+		return agentName
+	case GroupedMaps:
+		return l.Roles[agentName]
+	}
+	return ""
+}
+
+// MapFor returns the policy map an agent acts from and learns into
+func (l *PolicyMapLearner) MapFor(agentName string) PolicyMap {
+	key := l.mapKey(agentName)
+	if key == "" {
+		return l.Map
+	}
+	pm, ok := l.Maps[key]
+	if !ok {
+		// every specialized map starts from a copy of the shared one
+		pm = l.Map.Clone()
+		if l.Maps == nil {
+			l.Maps = map[string]PolicyMap{}
+		}
+		l.Maps[key] = pm
+	}
+	return pm
+}
+
+// Act samples each agent's action from the policy at its position
+func (l *PolicyMapLearner) Act(env *Environment) []int {
+	actions := make([]int, len(env.Agents))
+	l.prevPos = l.prevPos[:0]
+	for i, agent := range env.Agents {
+		pos := Position{X: agent.X, Y: agent.Y}
+		l.prevPos = append(l.prevPos, pos)
+		if l.Rand != nil {
+			actions[i] = l.MapFor(agent.Name)[pos].GetActionProbaRand(l.Rand)
+		} else {
+			actions[i] = l.MapFor(agent.Name)[pos].GetActionProba()
+		}
+	}
+	return actions
+}
+
+// Learn credits each agent's reward to the action it took, in the cell it took it from
+// it only learns from immediate rewards, the traces learner carries credit back along a recipe
+func (l *PolicyMapLearner) Learn(env *Environment, actions []int, rewards []float32, done, truncated bool) {
+	for i, agent := range env.Agents {
+		if i >= len(l.prevPos) || i >= len(rewards) {
+			continue // joined after Act, it took no action yet
+		}
+		pos := l.prevPos[i]
+		pm := l.MapFor(agent.Name)
+		pm[pos] = pm[pos].UpdateRate(pos, actions[i], rewards[i], l.LearningRate)
+	}
+}
+
+// EndEpisode does nothing, the policy map learns every step
+func (l *PolicyMapLearner) EndEpisode(episodeReturn float64) {}
+
+// Trainer runs the training loop: act, step, learn, and spawn items as a curriculum
+type Trainer struct {
+	NewEnv  func() Environment // builds the environment for each episode
+	Env     Environment
+	Learner Learner
+
+	// MaxEpisodeSteps ends an episode after this many steps, 0 means one endless episode
+	MaxEpisodeSteps int
+
+	// every SpawnEvery steps, while fewer than SpawnUntil steps have run in total,
+	// random items are spawned so agents see varied situations
+	SpawnEvery int
+	SpawnUntil int
+
+	// Roster has agents join and leave during every episode, nil keeps the layout's team
+	// changes are made before Act, so learners see the new team on the step it joins
+	Roster RosterSchedule
+
+	// OnEpisodeStart, when set, sees each episode's environment before the first step
+	OnEpisodeStart func(env *Environment)
+	// OnStep, when set, is called after every step and after items spawn, before the episode resets
+	OnStep func(env *Environment, actions []int, rewards []float32, done bool)
+
+	TotalSteps   int // steps over all episodes
+	EpisodeSteps int // steps in the current episode
+	Episode      int // finished episodes
+	Returns      []float64
+}
+
+// NewTrainer creates a trainer with the curriculum the training loop always used
+func NewTrainer(newEnv func() Environment, learner Learner) *Trainer {
+	return &Trainer{
+		NewEnv:     newEnv,
+		Env:        newEnv(),
+		Learner:    learner,
+		SpawnEvery: 15,
+		SpawnUntil: 1000,
+	}
+}
+
+// Step runs one step of the training loop
+// when the episode ends, the learner is told and a fresh environment is built
+func (t *Trainer) Step() (rewards []float32, done bool) {
+	if t.EpisodeSteps == 0 && t.OnEpisodeStart != nil {
+		t.OnEpisodeStart(&t.Env)
+	}
+	if err := t.Roster.Apply(&t.Env, t.EpisodeSteps); err != nil {
+		t.Env.logger().Errorf("roster: %v", err)
+	}
+	actions := t.Learner.Act(&t.Env)
+	rewards, done = t.Env.Step(actions)
+	t.TotalSteps++
+	t.EpisodeSteps++
+	truncated := false
+	if !done && t.MaxEpisodeSteps > 0 && t.EpisodeSteps >= t.MaxEpisodeSteps {
+		done, truncated = true, true
+	}
+
+	t.Learner.Learn(&t.Env, actions, rewards, done, truncated)
+
+	// early on, spawn some items
+	if !done && t.SpawnEvery > 0 && t.TotalSteps < t.SpawnUntil && t.TotalSteps%t.SpawnEvery == 0 {
+		t.Env.EnvironmentSpawnRandomItemsForTraining()
+	}
+
+	if t.OnStep != nil {
+		t.OnStep(&t.Env, actions, rewards, done)
+	}
+
+	if done {
+		episodeReturn := t.Env.TotalReward
+		t.Returns = append(t.Returns, episodeReturn)
+		t.Episode++
+		t.Learner.EndEpisode(episodeReturn)
+		t.Reset()
+	}
+	return rewards, done
+}
+
+// Reset starts a new episode without telling the learner
+func (t *Trainer) Reset() {
+	t.Env = t.NewEnv()
+	t.EpisodeSteps = 0
+}
+
+// RunEpisode steps until the episode ends and returns its total reward
+// MaxEpisodeSteps must be set unless the environment ends episodes itself
+func (t *Trainer) RunEpisode() float64 {
+	episode := t.Episode
+	for t.Episode == episode {
+		t.Step()
+	}
+	return t.Returns[len(t.Returns)-1]
+}
+
+// Train runs episodes and returns their total rewards
+func (t *Trainer) Train(episodes int) []float64 {
+	returns := make([]float64, 0, episodes)
+	for i := 0; i < episodes; i++ {
+		returns = append(returns, t.RunEpisode())
+	}
+	return returns
+}
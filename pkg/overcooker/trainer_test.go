@@ -0,0 +1,33 @@
+package overcooker
+
+import "testing"
+
+// a reward goes to the action in the cell it was taken from, not to the cell the agent reached
+func TestPolicyMapLearnerCreditsTheCellActedFrom(t *testing.T) {
+	env := Environment{Agents: []Agent{{Name: "a1", X: 1, Y: 1}}, Width: 2, Height: 2, Log: NewLogger(nil, LogQuiet)}
+	l := NewPolicyMapLearner(env)
+	l.Act(&env)
+	actions := []int{Act_East}
+	env.Step(actions)
+	l.Learn(&env, actions, []float32{1}, false, false)
+
+	from := l.Map[Position{X: 1, Y: 1}]
+	if from[Act_East] <= NewPolicy()[Act_East] {
+		t.Errorf("East from (1,1) has %v after a reward, want more than %v", from[Act_East], NewPolicy()[Act_East])
+	}
+	for pos, policy := range l.Map {
+		if pos != (Position{X: 1, Y: 1}) && !samePolicy(policy, NewPolicy()) {
+			t.Errorf("%v learned %v, only (1,1) was acted from", pos, policy)
+		}
+	}
+	checkPolicyMapNormalized(t, l.Map, "learned map", 0)
+}
+
+func samePolicy(a, b Policy) bool {
+	for action := Act_None; action <= Act_Interact; action++ {
+		if a[action] != b[action] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,341 @@
+package overcooker
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// TrajectoryFormat names the trajectory log format, it's the first field of the header line
+const TrajectoryFormat = "overcooker-trajectory"
+
+// TrajectoryVersion is bumped when the format changes incompatibly
+// version 2 lets the agents change between frames
+const TrajectoryVersion = 2
+
+// TrajectoryHeader is the first line of a trajectory log: the kitchen as the episode started
+type TrajectoryHeader struct {
+	Format  string `json:"format"`
+	Version int    `json:"version"`
+	Name    string `json:"name"`
+	Seed    int64  `json:"seed"`
+	Layout  string `json:"layout"` // the starting grid as Render draws it, for people reading the log
+
+	Width    int           `json:"width"`
+	Height   int           `json:"height"`
+	Agents   []AgentState  `json:"agents"`
+	Items    []Item        `json:"items"`
+	Stations []Station     `json:"stations"`
+	Rewards  *RewardConfig `json:"rewards,omitempty"`
+}
+
+// AgentState is where an agent stands and what it holds
+type AgentState struct {
+	Name    string `json:"name,omitempty"` // in the header and in frames where agents joined or left, other frames keep the order
+	X       int    `json:"x"`
+	Y       int    `json:"y"`
+	Holding string `json:"holding,omitempty"`
+}
+
+// TrajectoryFrame is one step of a trajectory log, the state right after the step
+type TrajectoryFrame struct {
+	Step    int            `json:"step"`
+	Actions []int          `json:"actions"`
+	Rewards []float32      `json:"rewards"`
+	Total   float64        `json:"total"`
+	Done    bool           `json:"done,omitempty"`
+	Events  map[string]int `json:"events,omitempty"` // events of this step, not running counts
+	Agents  []AgentState   `json:"agents"`
+	Items   *[]Item        `json:"items,omitempty"` // nil when the items didn't change
+}
+
+// Trajectory is a recorded episode, a header and one frame per step
+type Trajectory struct {
+	Header TrajectoryHeader
+	Frames []TrajectoryFrame
+
+	items  []Item         // items as of the last frame, to only log changes
+	events map[string]int // running event counts as of the last frame
+	names  []string       // agents as of the last frame, to name them when they change
+}
+
+// NewTrajectory starts recording an episode from env's current state
+// seed is whatever seeded the episode, it's only stored for reference
+func NewTrajectory(env *Environment, seed int64) *Trajectory {
+	t := &Trajectory{
+		Header: TrajectoryHeader{
+			Format:   TrajectoryFormat,
+			Version:  TrajectoryVersion,
+			Name:     env.Name,
+			Seed:     seed,
+			Layout:   env.RenderString(),
+			Width:    env.Width,
+			Height:   env.Height,
+			Agents:   agentStates(env, true),
+			Items:    append([]Item{}, env.Items...),
+			Stations: append([]Station{}, env.Stations...),
+			Rewards:  env.Rewards,
+		},
+		items:  append([]Item(nil), env.Items...),
+		events: copyCounts(env.EventCountsmap),
+		names:  agentNames(env.Agents),
+	}
+	return t
+}
+
+// agentStates snapshots every agent, with names for the header
+func agentStates(env *Environment, names bool) []AgentState {
+	states := make([]AgentState, len(env.Agents))
+	for i, agent := range env.Agents {
+		states[i] = AgentState{X: agent.X, Y: agent.Y, Holding: agent.Inventory.Name}
+		if names {
+			states[i].Name = agent.Name
+		}
+	}
+	return states
+}
+
+func copyCounts(counts map[string]int) map[string]int {
+	copied := make(map[string]int, len(counts))
+	for k, v := range counts {
+		copied[k] = v
+	}
+	return copied
+}
+
+// Record appends the step that just happened, call it right after env.Step
+func (t *Trajectory) Record(env *Environment, actions []int, rewards []float32, done bool) {
+	frame := TrajectoryFrame{
+		Step:    len(t.Frames) + 1,
+		Actions: append([]int(nil), actions...),
+		Rewards: append([]float32(nil), rewards...),
+		Total:   env.TotalReward,
+		Done:    done,
+		Agents:  agentStates(env, false),
+	}
+	if !sameNames(t.names, env.Agents) {
+		frame.Agents = agentStates(env, true)
+		t.names = agentNames(env.Agents)
+	}
+	for event, count := range env.EventCountsmap {
+		if delta := count - t.events[event]; delta != 0 {
+			if frame.Events == nil {
+				frame.Events = map[string]int{}
+			}
+			frame.Events[event] = delta
+			t.events[event] = count
+		}
+	}
+	if !sameItems(t.items, env.Items) {
+		items := append([]Item{}, env.Items...)
+		frame.Items = &items
+		t.items = append(t.items[:0], env.Items...)
+	}
+	t.Frames = append(t.Frames, frame)
+}
+
+func sameNames(names []string, agents []Agent) bool {
+	if len(names) != len(agents) {
+		return false
+	}
+	for i := range names {
+		if names[i] != agents[i].Name {
+			return false
+		}
+	}
+	return true
+}
+
+// rosterChanged reports whether a frame names its agents, it does when they joined or left
+func (f *TrajectoryFrame) rosterChanged() bool {
+	return len(f.Agents) == 0 || f.Agents[0].Name != ""
+}
+
+func sameItems(a, b []Item) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Events returns how often each event happened over the whole episode
+func (t *Trajectory) Events() map[string]int {
+	counts := map[string]int{}
+	for _, frame := range t.Frames {
+		for event, n := range frame.Events {
+			counts[event] += n
+		}
+	}
+	return counts
+}
+
+// Deliveries returns how many soups were delivered in the episode
+func (t *Trajectory) Deliveries() int {
+	return t.Events()["soup_deliver"]
+}
+
+// Write writes the trajectory as JSON lines, the header first
+func (t *Trajectory) Write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	if err := enc.Encode(t.Header); err != nil {
+		return fmt.Errorf("writing trajectory header: %w", err)
+	}
+	for _, frame := range t.Frames {
+		if err := enc.Encode(frame); err != nil {
+			return fmt.Errorf("writing trajectory step %d: %w", frame.Step, err)
+		}
+	}
+	return bw.Flush()
+}
+
+// Save writes the trajectory to a file
+func (t *Trajectory) Save(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("creating trajectory %s: %w", path, err)
+	}
+	defer f.Close()
+	if err := t.Write(f); err != nil {
+		return fmt.Errorf("trajectory %s: %w", path, err)
+	}
+	return f.Close()
+}
+
+// ReadTrajectory reads a trajectory written by Write
+func ReadTrajectory(r io.Reader) (*Trajectory, error) {
+	dec := json.NewDecoder(bufio.NewReader(r))
+	t := &Trajectory{}
+	if err := dec.Decode(&t.Header); err != nil {
+		return nil, fmt.Errorf("reading trajectory header: %w", err)
+	}
+	if t.Header.Format != TrajectoryFormat {
+		return nil, fmt.Errorf("not a trajectory log, format is %q", t.Header.Format)
+	}
+	if t.Header.Version > TrajectoryVersion {
+		return nil, fmt.Errorf("trajectory version %d is newer than %d", t.Header.Version, TrajectoryVersion)
+	}
+	agents := len(t.Header.Agents)
+	for {
+		var frame TrajectoryFrame
+		err := dec.Decode(&frame)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading trajectory step %d: %w", len(t.Frames)+1, err)
+		}
+		if frame.rosterChanged() {
+			agents = len(frame.Agents)
+		} else if len(frame.Agents) != agents {
+			return nil, fmt.Errorf("trajectory step %d has %d agents, the step before %d", frame.Step, len(frame.Agents), agents)
+		}
+		t.Frames = append(t.Frames, frame)
+	}
+	return t, nil
+}
+
+// LoadTrajectory reads a trajectory file
+func LoadTrajectory(path string) (*Trajectory, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening trajectory %s: %w", path, err)
+	}
+	defer f.Close()
+	t, err := ReadTrajectory(f)
+	if err != nil {
+		return nil, fmt.Errorf("trajectory %s: %w", path, err)
+	}
+	return t, nil
+}
+
+// TrajectoryReplayer rebuilds the environment of a trajectory frame by frame
+// it sets the recorded state rather than stepping, so spawns and edits replay exactly
+type TrajectoryReplayer struct {
+	Trajectory *Trajectory
+	Env        Environment
+	Frame      int // frames applied, 0 is the starting state
+}
+
+// NewTrajectoryReplayer creates a replayer at the start of the episode
+func NewTrajectoryReplayer(t *Trajectory) *TrajectoryReplayer {
+	r := &TrajectoryReplayer{Trajectory: t}
+	r.Reset()
+	return r
+}
+
+// Reset goes back to the starting state
+func (r *TrajectoryReplayer) Reset() {
+	h := r.Trajectory.Header
+	r.Env = Environment{
+		Name:           h.Name,
+		Width:          h.Width,
+		Height:         h.Height,
+		Items:          append([]Item(nil), h.Items...),
+		Stations:       append([]Station(nil), h.Stations...),
+		Rewards:        h.Rewards,
+		EventCountsmap: map[string]int{},
+	}
+	for _, state := range h.Agents {
+		r.Env.Agents = append(r.Env.Agents, Agent{Name: state.Name, X: state.X, Y: state.Y, Inventory: Item{Name: state.Holding}})
+	}
+	r.Frame = 0
+}
+
+// Len returns the number of recorded steps
+func (r *TrajectoryReplayer) Len() int {
+	return len(r.Trajectory.Frames)
+}
+
+// Current returns the last applied frame, nil at the start
+func (r *TrajectoryReplayer) Current() *TrajectoryFrame {
+	if r.Frame == 0 {
+		return nil
+	}
+	return &r.Trajectory.Frames[r.Frame-1]
+}
+
+// Next applies the next frame, false when the episode is over
+func (r *TrajectoryReplayer) Next() bool {
+	if r.Frame >= len(r.Trajectory.Frames) {
+		return false
+	}
+	frame := &r.Trajectory.Frames[r.Frame]
+	if frame.rosterChanged() {
+		r.Env.Agents = r.Env.Agents[:0:0]
+		for _, state := range frame.Agents {
+			r.Env.Agents = append(r.Env.Agents, Agent{Name: state.Name})
+		}
+	}
+	for i, state := range frame.Agents {
+		agent := &r.Env.Agents[i]
+		agent.X, agent.Y = state.X, state.Y
+		agent.Inventory = Item{Name: state.Holding}
+	}
+	r.Env.Reindex() // agents were moved in place
+	if frame.Items != nil {
+		r.Env.Items = append(r.Env.Items[:0:0], *frame.Items...)
+	}
+	for event, n := range frame.Events {
+		r.Env.EventCountsmap[event] += n
+	}
+	r.Env.TotalReward = frame.Total
+	r.Frame++
+	return true
+}
+
+// Seek moves to the state after frame steps, 0 is the start
+func (r *TrajectoryReplayer) Seek(frame int) {
+	if frame < r.Frame {
+		r.Reset()
+	}
+	for r.Frame < frame && r.Next() {
+	}
+}
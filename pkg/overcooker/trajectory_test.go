@@ -0,0 +1,111 @@
+package overcooker
+
+import (
+	"bytes"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+// recordEpisode plays the scripted chefs with item spawns and a chef joining halfway
+func recordEpisode(t *testing.T, steps int) *Trajectory {
+	t.Helper()
+	env := quietEnvironment()
+	env.Rand = rand.New(rand.NewSource(3))
+	trajectory := NewTrajectory(&env, 3)
+	for step := 1; step <= steps; step++ {
+		actions := ScriptedController{}.Actions(&env)
+		rewards, _ := env.Step(actions)
+		if step%10 == 0 {
+			env.EnvironmentSpawnRandomItemsForTraining()
+		}
+		if step == steps/2 {
+			pos, _ := env.freeCellNear(0, 0)
+			if err := env.AddAgent("a6", pos.X, pos.Y); err != nil {
+				t.Fatal(err)
+			}
+		}
+		trajectory.Record(&env, actions, rewards, step == steps)
+	}
+	return trajectory
+}
+
+// a trajectory written as JSON lines reads back the same
+func TestTrajectoryRoundTrip(t *testing.T) {
+	recorded := recordEpisode(t, 60)
+	if recorded.Deliveries() == 0 {
+		t.Fatalf("the scripted chefs delivered nothing, the episode doesn't test much")
+	}
+
+	var buf bytes.Buffer
+	if err := recorded.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	written := buf.String()
+	read, err := ReadTrajectory(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(read.Header, recorded.Header) {
+		t.Errorf("header = %+v, want %+v", read.Header, recorded.Header)
+	}
+	if !reflect.DeepEqual(read.Frames, recorded.Frames) {
+		t.Errorf("the frames read back differ from the recorded ones")
+	}
+	if !reflect.DeepEqual(read.Events(), recorded.Events()) {
+		t.Errorf("events = %v, want %v", read.Events(), recorded.Events())
+	}
+
+	var again bytes.Buffer
+	if err := read.Write(&again); err != nil {
+		t.Fatal(err)
+	}
+	if again.String() != written {
+		t.Errorf("writing what was read gives a different log")
+	}
+}
+
+// stepping the replayed state with the recorded actions earns the recorded rewards
+func TestTrajectoryReplayReproducesRewards(t *testing.T) {
+	var buf bytes.Buffer
+	if err := recordEpisode(t, 60).Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	trajectory, err := ReadTrajectory(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	replayer := NewTrajectoryReplayer(trajectory)
+	replayer.Env.Log = NewLogger(nil, LogQuiet)
+	total := 0.0
+	for _, frame := range trajectory.Frames {
+		env := replayer.Env.Clone()
+		rewards, _ := env.Step(frame.Actions)
+		if !reflect.DeepEqual(rewards, frame.Rewards) {
+			t.Fatalf("step %d: rewards %v, recorded %v", frame.Step, rewards, frame.Rewards)
+		}
+		for _, r := range rewards {
+			total += float64(r)
+		}
+		if !replayer.Next() {
+			t.Fatalf("step %d: the replayer ran out of frames", frame.Step)
+		}
+		// spawns and joins happen between steps, only moves can be checked against the replayer
+		if frame.Items == nil && !frame.rosterChanged() {
+			for i, agent := range env.Agents {
+				want := replayer.Env.Agents[i]
+				if agent.X != want.X || agent.Y != want.Y || agent.Inventory.Name != want.Inventory.Name {
+					t.Fatalf("step %d: %s at (%d,%d) holding %q, replayed at (%d,%d) holding %q", frame.Step,
+						agent.Name, agent.X, agent.Y, agent.Inventory.Name, want.X, want.Y, want.Inventory.Name)
+				}
+			}
+		}
+		if diff := total - replayer.Env.TotalReward; diff > 1e-4 || diff < -1e-4 {
+			t.Fatalf("step %d: the rewards add up to %v, the replayed total is %v", frame.Step, total, replayer.Env.TotalReward)
+		}
+	}
+	if replayer.Next() {
+		t.Errorf("the replayer has frames past the end")
+	}
+}
@@ -0,0 +1,217 @@
+package overcooker
+
+import (
+	"fmt"
+	"sync"
+)
+
+// VecStepResult is the batched outcome of stepping every environment once
+// indexed [env][agent], observations are taken after any auto-reset
+type VecStepResult struct {
+	Obs     [][][]float32
+	Rewards [][]float32
+	Dones   []bool
+
+	// FinalObs holds the last observation of episodes that just ended, nil otherwise,
+	// value learners bootstrap from it instead of the reset observation
+	FinalObs [][][]float32
+	// EpisodeReturns holds the total reward of episodes that just ended, 0 otherwise
+	EpisodeReturns []float64
+}
+
+// vecShard is the range of environments one worker goroutine owns
+type vecShard struct {
+	from, to int
+	jobs     chan [][]int
+}
+
+// VecEnv runs independent environments on worker goroutines
+// it batches actions, observations and rewards and resets finished episodes
+// Step is synchronous, StepAsync and StepWait let the caller work while the envs step
+type VecEnv struct {
+	NewEnv          func() Environment
+	Envs            []Environment
+	MaxEpisodeSteps int // 0 means episodes only end when an environment says so
+
+	// Returns collects the total reward of every finished episode
+	Returns []float64
+
+	episodeSteps   []int
+	episodeReturns []float64
+
+	shards  []vecShard
+	wg      sync.WaitGroup
+	result  VecStepResult
+	pending bool
+	closed  bool
+}
+
+// NewVecEnv creates n environments stepped by up to workers goroutines
+func NewVecEnv(newEnv func() Environment, n, workers int) *VecEnv {
+	if n < 1 {
+		n = 1
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > n {
+		workers = n
+	}
+	v := &VecEnv{
+		NewEnv:         newEnv,
+		Envs:           make([]Environment, n),
+		episodeSteps:   make([]int, n),
+		episodeReturns: make([]float64, n),
+	}
+	for i := range v.Envs {
+		v.Envs[i] = newEnv()
+	}
+	v.result = VecStepResult{
+		Obs:            make([][][]float32, n),
+		Rewards:        make([][]float32, n),
+		Dones:          make([]bool, n),
+		FinalObs:       make([][][]float32, n),
+		EpisodeReturns: make([]float64, n),
+	}
+
+	// contiguous shards, one goroutine each
+	per := (n + workers - 1) / workers
+	for from := 0; from < n; from += per {
+		to := from + per
+		if to > n {
+			to = n
+		}
+		shard := vecShard{from: from, to: to, jobs: make(chan [][]int)}
+		v.shards = append(v.shards, shard)
+		go v.work(shard)
+	}
+	return v
+}
+
+// Len returns the number of environments
+func (v *VecEnv) Len() int {
+	return len(v.Envs)
+}
+
+// work steps a shard's environments whenever actions arrive
+func (v *VecEnv) work(shard vecShard) {
+	for actions := range shard.jobs {
+		for i := shard.from; i < shard.to; i++ {
+			v.stepOne(i, actions[i])
+		}
+		v.wg.Done()
+	}
+}
+
+// stepOne steps environment i and fills its slot of the result
+func (v *VecEnv) stepOne(i int, actions []int) {
+	env := &v.Envs[i]
+	rewards, done := env.Step(actions)
+	v.episodeSteps[i]++
+	for _, r := range rewards {
+		v.episodeReturns[i] += float64(r)
+	}
+	if v.MaxEpisodeSteps > 0 && v.episodeSteps[i] >= v.MaxEpisodeSteps {
+		done = true
+	}
+
+	v.result.Rewards[i] = append([]float32(nil), rewards...) // Step reuses its slice
+	v.result.Dones[i] = done
+	v.result.FinalObs[i] = nil
+	v.result.EpisodeReturns[i] = 0
+	if done {
+		v.result.FinalObs[i] = observeAll(env)
+		v.result.EpisodeReturns[i] = v.episodeReturns[i]
+		v.Envs[i] = v.NewEnv()
+		v.episodeSteps[i] = 0
+		v.episodeReturns[i] = 0
+	}
+	v.result.Obs[i] = observeAll(&v.Envs[i])
+}
+
+// observeAll returns every agent's observation
+func observeAll(env *Environment) [][]float32 {
+	obs := make([][]float32, len(env.Agents))
+	for a := range obs {
+		obs[a] = env.Observe(a)
+	}
+	return obs
+}
+
+// Reset starts a new episode in every environment and returns the observations
+func (v *VecEnv) Reset() [][][]float32 {
+	if v.pending {
+		v.StepWait()
+	}
+	obs := make([][][]float32, len(v.Envs))
+	for i := range v.Envs {
+		v.Envs[i] = v.NewEnv()
+		v.episodeSteps[i] = 0
+		v.episodeReturns[i] = 0
+		obs[i] = observeAll(&v.Envs[i])
+	}
+	return obs
+}
+
+// Step steps every environment with actions[env][agent] and waits for all of them
+func (v *VecEnv) Step(actions [][]int) VecStepResult {
+	v.StepAsync(actions)
+	return v.StepWait()
+}
+
+// StepAsync hands the actions to the workers and returns immediately
+// call StepWait before reading the environments or stepping again
+func (v *VecEnv) StepAsync(actions [][]int) {
+	if v.closed {
+		panic("overcooker: step on a closed VecEnv")
+	}
+	if v.pending {
+		panic("overcooker: StepAsync called twice without StepWait")
+	}
+	if len(actions) != len(v.Envs) {
+		panic(fmt.Sprintf("overcooker: %d action lists for %d environments", len(actions), len(v.Envs)))
+	}
+	v.pending = true
+	v.wg.Add(len(v.shards))
+	for _, shard := range v.shards {
+		shard.jobs <- actions
+	}
+}
+
+// StepWait waits for the last StepAsync and returns its result
+func (v *VecEnv) StepWait() VecStepResult {
+	if !v.pending {
+		panic("overcooker: StepWait called without StepAsync")
+	}
+	v.wg.Wait()
+	v.pending = false
+
+	// copy the slot slices so the caller can keep results across steps
+	out := VecStepResult{
+		Obs:            append([][][]float32(nil), v.result.Obs...),
+		Rewards:        append([][]float32(nil), v.result.Rewards...),
+		Dones:          append([]bool(nil), v.result.Dones...),
+		FinalObs:       append([][][]float32(nil), v.result.FinalObs...),
+		EpisodeReturns: append([]float64(nil), v.result.EpisodeReturns...),
+	}
+	for i, done := range out.Dones {
+		if done {
+			v.Returns = append(v.Returns, out.EpisodeReturns[i])
+		}
+	}
+	return out
+}
+
+// Close stops the worker goroutines
+func (v *VecEnv) Close() {
+	if v.closed {
+		return
+	}
+	if v.pending {
+		v.StepWait()
+	}
+	for _, shard := range v.shards {
+		close(shard.jobs)
+	}
+	v.closed = true
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	ov "github.com/shanecandoit/go_overcooker/pkg/overcooker"
+)
+
+// episodeRecorder records every episode and keeps the ones worth looking at,
+// those with at least minDeliveries soups delivered, as dir/episode-NNNNN.jsonl
+type episodeRecorder struct {
+	dir           string
+	minDeliveries int
+	log           *ov.Logger
+
+	trajectory *ov.Trajectory
+	saved      int
+}
+
+func newEpisodeRecorder(dir string, minDeliveries int, log *ov.Logger) (*episodeRecorder, error) {
+	if dir == "" {
+		return nil, nil
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("creating record directory: %w", err)
+	}
+	return &episodeRecorder{dir: dir, minDeliveries: minDeliveries, log: log}, nil
+}
+
+func (r *episodeRecorder) start(env *ov.Environment, seed int64) {
+	r.trajectory = ov.NewTrajectory(env, seed)
+}
+
+func (r *episodeRecorder) step(env *ov.Environment, actions []int, rewards []float32, done bool) {
+	r.trajectory.Record(env, actions, rewards, done)
+}
+
+// finish saves the episode when it delivered enough soup
+func (r *episodeRecorder) finish(episode int) error {
+	deliveries := r.trajectory.Deliveries()
+	if deliveries < r.minDeliveries {
+		return nil
+	}
+	path := filepath.Join(r.dir, fmt.Sprintf("episode-%05d.jsonl", episode))
+	if err := r.trajectory.Save(path); err != nil {
+		return err
+	}
+	r.saved++
+	r.log.Infof("recorded %s, %d deliveries", path, deliveries)
+	return nil
+}